@@ -0,0 +1,158 @@
+// Package audit records configuration changes to an append-only JSON-lines
+// file and reads them back.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valueiron/vyos-api/vyos"
+)
+
+// Outcomes recorded in Event.Outcome.
+const (
+	Success = "success"
+	Failure = "failure"
+)
+
+// Actions recorded in Event.Action.
+const (
+	ActionLoad    = "load"
+	ActionConfirm = "confirm"
+)
+
+// Event is one configuration change sent to a device.
+type Event struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	// Principal and AuthMethod identify the caller; both are empty when API
+	// authentication is off.
+	Principal  string `json:"principal,omitempty"`
+	AuthMethod string `json:"auth_method,omitempty"`
+	Device     string `json:"device"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	// Resource is the resource kind of the request (see auth.ResourceOf).
+	Resource string `json:"resource"`
+	// Ops are the operations sent to the device, with secret values
+	// redacted. They are empty for an Action.
+	Ops []vyos.Op `json:"ops"`
+	// Action is set for a change made without set/delete operations:
+	// ActionLoad, which replaces the running configuration with File, or
+	// ActionConfirm, which keeps a pending commit-confirm.
+	Action         string    `json:"action,omitempty"`
+	File           string    `json:"file,omitempty"`
+	ConfirmMinutes int       `json:"confirm_minutes,omitempty"`
+	Snapshot       *Snapshot `json:"snapshot,omitempty"`
+	Outcome        string    `json:"outcome"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// Snapshot is the configuration under the deepest node all of an event's
+// ops share, read before and after the change, with secrets redacted. A nil
+// Before or After means the node did not exist. After is only read for
+// successful changes.
+type Snapshot struct {
+	Path   []string    `json:"path"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// Log appends events to a file. It is safe for concurrent use.
+type Log struct {
+	path string
+	mu   sync.Mutex
+	f    *os.File
+}
+
+// Open opens the audit file at path for appending, creating it with mode
+// 0600 if needed.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{path: path, f: f}, nil
+}
+
+// Close closes the file.
+func (l *Log) Close() error {
+	return l.f.Close()
+}
+
+// Record appends ev as one line and syncs it to disk.
+func (l *Log) Record(ev Event) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.Write(b); err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+// Filter selects events in Query. Zero fields match every event.
+type Filter struct {
+	Device string
+	// Resource matches the kind and the kinds below it, so "firewall"
+	// selects "firewall/policies/rules".
+	Resource string
+	Since    time.Time
+	// Limit keeps only the most recent matching events.
+	Limit int
+	// Visible, if set, drops the events of devices it returns false for.
+	Visible func(device string) bool
+}
+
+func (f Filter) match(ev *Event) bool {
+	if f.Device != "" && ev.Device != f.Device {
+		return false
+	}
+	if f.Visible != nil && !f.Visible(ev.Device) {
+		return false
+	}
+	if f.Resource != "" && ev.Resource != f.Resource && !strings.HasPrefix(ev.Resource, f.Resource+"/") {
+		return false
+	}
+	return f.Since.IsZero() || !ev.Time.Before(f.Since)
+}
+
+// Query returns the events matching f, oldest first. A line that cannot be
+// decoded, such as one still being written, is skipped.
+func (l *Log) Query(f Filter) ([]Event, error) {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	events := []Event{}
+	sc := bufio.NewScanner(file)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var ev Event
+		if json.Unmarshal(sc.Bytes(), &ev) != nil || !f.match(&ev) {
+			continue
+		}
+		events = append(events, ev)
+		if f.Limit > 0 && len(events) > 2*f.Limit {
+			events = append(events[:0], events[len(events)-f.Limit:]...)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", l.path, err)
+	}
+	if f.Limit > 0 && len(events) > f.Limit {
+		events = events[len(events)-f.Limit:]
+	}
+	return events, nil
+}
@@ -0,0 +1,72 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLog_RecordQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Time: t0, Device: "r1", Resource: "firewall/policies", Outcome: Success},
+		{Time: t0.Add(time.Minute), Device: "r2", Resource: "nat/rules", Outcome: Failure, Error: "commit failed"},
+		{Time: t0.Add(2 * time.Minute), Device: "r1", Resource: "firewall/policies/rules", Outcome: Success},
+		{Time: t0.Add(3 * time.Minute), Device: "r1", Resource: "firewallx", Outcome: Success},
+	}
+	for _, ev := range events {
+		if err := l.Record(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A torn final line is skipped.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time":"2024-05-01T12:`)
+	f.Close()
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []int // indexes into events
+	}{
+		{"all", Filter{}, []int{0, 1, 2, 3}},
+		{"device", Filter{Device: "r1"}, []int{0, 2, 3}},
+		{"resource prefix", Filter{Resource: "firewall"}, []int{0, 2}},
+		{"since", Filter{Since: t0.Add(time.Minute)}, []int{1, 2, 3}},
+		{"limit keeps newest", Filter{Device: "r1", Limit: 2}, []int{2, 3}},
+	}
+	for _, tt := range tests {
+		got, err := l.Query(tt.filter)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d events, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for i, idx := range tt.want {
+			if !got[i].Time.Equal(events[idx].Time) {
+				t.Errorf("%s: event %d at %v, want %v", tt.name, i, got[i].Time, events[idx].Time)
+			}
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,130 @@
+// Package auth authenticates callers of the service's own API. Each method
+// (static bearer tokens, mTLS client certificates, JWTs) is an Authenticator;
+// Chain combines them and Middleware enforces the result. Policy then
+// authorizes the authenticated principal by role.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/valueiron/vyos-api/logctx"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request carries
+// no credentials of its kind, so another method may still accept it.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Principal is an authenticated caller.
+type Principal struct {
+	// Name identifies the caller: the token name, certificate common name
+	// or JWT subject.
+	Name string
+	// Method is "token", "mtls" or "jwt".
+	Method string
+	// Roles are roles the credential itself carries (the JWT "roles"
+	// claim), in addition to those the Policy assigns by name.
+	Roles []string
+}
+
+// Authenticator checks one kind of credential. It returns ErrNoCredentials if
+// the request has none of that kind, and another error if they are invalid.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain accepts a request if any of its authenticators does.
+type Chain []Authenticator
+
+// Authenticate tries each authenticator in order and returns the first
+// principal. If none accepts the request, the error is ErrNoCredentials when
+// no credentials were presented at all, and the first other error otherwise.
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	var firstErr error
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if err == nil {
+			return p, nil
+		}
+		if firstErr == nil && !errors.Is(err, ErrNoCredentials) {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return nil, ErrNoCredentials
+}
+
+type ctxKey struct{}
+
+// PrincipalFrom returns the principal Middleware stored in ctx.
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(ctxKey{}).(*Principal)
+	return p, ok
+}
+
+// Middleware rejects requests that a does not authenticate with 401, except
+// for the exact paths in exempt (see exempted). The principal is stored in
+// the request context and added to its logger.
+func Middleware(a Authenticator, exempt ...string) func(http.Handler) http.Handler {
+	skip := make(map[string]bool, len(exempt))
+	for _, p := range exempt {
+		skip[p] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempted(skip, r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			p, err := a.Authenticate(r)
+			if err != nil {
+				msg := "authentication required"
+				if !errors.Is(err, ErrNoCredentials) {
+					msg = "invalid credentials"
+					logctx.From(r.Context()).Warn("authentication failed", "error", err)
+				}
+				w.Header().Set("WWW-Authenticate", `Bearer realm="vyos-api"`)
+				writeError(w, http.StatusUnauthorized, msg)
+				return
+			}
+			ctx := context.WithValue(r.Context(), ctxKey{}, p)
+			ctx = logctx.With(ctx, logctx.From(ctx).With("principal", p.Name, "auth", p.Method))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// exempted reports whether r is for one of the paths in skip and has no
+// query string. Parameters can widen what an exempt endpoint returns, as
+// /health?verbose=1 adds every device's URL and last error, so only the bare
+// path is let through.
+func exempted(skip map[string]bool, r *http.Request) bool {
+	return skip[r.URL.Path] && r.URL.RawQuery == ""
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	scheme, token, ok := strings.Cut(h, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// writeError writes the same error body as the handlers package.
+func writeError(w http.ResponseWriter, status int, message string) {
+	body := map[string]string{"error": message}
+	if id := w.Header().Get(logctx.Header); id != "" {
+		body["request_id"] = id
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
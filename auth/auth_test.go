@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile writes content to a file in a temp directory and returns its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func bearer(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/devices", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func hashHex(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestTokens(t *testing.T) {
+	path := writeFile(t, "tokens", "# provisioning\n"+hashHex("s3cret")+"  pipeline\n\n"+hashHex("other")+"\n")
+	tokens, err := LoadTokens(path)
+	if err != nil {
+		t.Fatalf("LoadTokens: %v", err)
+	}
+
+	p, err := tokens.Authenticate(bearer("s3cret"))
+	if err != nil || p.Name != "pipeline" || p.Method != "token" {
+		t.Errorf("valid token: %+v, %v", p, err)
+	}
+	if p, err := tokens.Authenticate(bearer("other")); err != nil || p.Name != "token-line-4" {
+		t.Errorf("unnamed token: %+v, %v", p, err)
+	}
+	if _, err := tokens.Authenticate(bearer("wrong")); err == nil || errors.Is(err, ErrNoCredentials) {
+		t.Errorf("wrong token: err = %v, want an invalid-credentials error", err)
+	}
+	if _, err := tokens.Authenticate(httptest.NewRequest(http.MethodGet, "/", nil)); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("no header: err = %v, want ErrNoCredentials", err)
+	}
+}
+
+func TestLoadTokens_Invalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"not hex":   "s3cret pipeline\n",
+		"too short": "abcd pipeline\n",
+		"empty":     "# nothing\n",
+	} {
+		if _, err := LoadTokens(writeFile(t, "tokens", content)); err == nil {
+			t.Errorf("%s: LoadTokens succeeded", name)
+		}
+	}
+}
+
+func TestClientCert(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, err := (ClientCert{}).Authenticate(r); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("plain HTTP: err = %v, want ErrNoCredentials", err)
+	}
+
+	r.TLS = &tls.ConnectionState{}
+	if _, err := (ClientCert{}).Authenticate(r); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("TLS without client cert: err = %v, want ErrNoCredentials", err)
+	}
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "provisioner"}}
+	r.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	if p, err := (ClientCert{}).Authenticate(r); err != nil || p.Name != "provisioner" || p.Method != "mtls" {
+		t.Errorf("verified cert: %+v, %v", p, err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tokens, err := LoadTokens(writeFile(t, "tokens", hashHex("s3cret")+" pipeline\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var who string
+	h := Middleware(Chain{tokens, ClientCert{}}, "/health")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := PrincipalFrom(r.Context()); ok {
+			who = p.Name
+		}
+	}))
+
+	tests := []struct {
+		name, path, token string
+		want              int
+		wantWho           string
+	}{
+		{"exempt", "/health", "", http.StatusOK, ""},
+		{"missing", "/devices", "", http.StatusUnauthorized, ""},
+		{"invalid", "/devices", "nope", http.StatusUnauthorized, ""},
+		{"valid", "/devices", "s3cret", http.StatusOK, "pipeline"},
+		{"exempt is exact", "/health/x", "", http.StatusUnauthorized, ""},
+		{"exempt without query", "/health?verbose=1", "", http.StatusUnauthorized, ""},
+		{"query authenticated", "/health?verbose=1", "s3cret", http.StatusOK, "pipeline"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			who = ""
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want || who != tt.wantWho {
+				t.Errorf("status %d, principal %q; want %d, %q\nbody: %s", w.Code, who, tt.want, tt.wantWho, w.Body)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtLeeway is the clock skew allowed when checking exp and nbf.
+const jwtLeeway = time.Minute
+
+// minRSABits is the smallest RSA modulus accepted from the JWKS.
+const minRSABits = 2048
+
+// jwtMethods are the accepted signing algorithms. Symmetric algs and "none"
+// are never accepted.
+var jwtMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+}
+
+// JWT authenticates bearer tokens that are JWTs signed by a key in a local
+// JWKS file. RS256/384/512, PS256/384/512 and ES256/384/512 are supported;
+// parsing and signature checks are done by golang-jwt.
+type JWT struct {
+	keys     map[string]crypto.PublicKey // by kid
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+// LoadJWKS reads a JWKS file (RFC 7517). If issuer or audience is set, tokens
+// must carry a matching iss or aud claim.
+func LoadJWKS(path, issuer, audience string) (*JWT, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	j := &JWT{keys: map[string]crypto.PublicKey{}, issuer: issuer, audience: audience, now: time.Now}
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %d (%q): %w", path, i, k.Kid, err)
+		}
+		j.keys[k.Kid] = pub
+	}
+	if len(j.keys) == 0 {
+		return nil, fmt.Errorf("%s: no signing keys", path)
+	}
+	return j, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err1 := b64Int(k.N)
+		e, err2 := b64Int(k.E)
+		if err1 != nil || err2 != nil || !e.IsInt64() {
+			return nil, errors.New("invalid RSA key")
+		}
+		if n.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key is %d bits, at least %d required", n.BitLen(), minRSABits)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err1 := b64Int(k.X)
+		y, err2 := b64Int(k.Y)
+		if err1 != nil || err2 != nil || !curve.IsOnCurve(x, y) {
+			return nil, errors.New("invalid EC key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func b64Int(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Authenticate accepts an "Authorization: Bearer" JWT with a valid signature,
+// unexpired, and with the configured issuer and audience. The principal is
+// the sub claim, with the roles of the optional "roles" claim. Bearer values
+// that are not JWTs are left to other methods.
+func (j *JWT) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok || strings.Count(token, ".") != 2 {
+		return nil, ErrNoCredentials
+	}
+	sub, roles, err := j.verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: %w", err)
+	}
+	return &Principal{Name: sub, Method: "jwt", Roles: roles}, nil
+}
+
+func (j *JWT) verify(token string) (sub string, roles []string, err error) {
+	var claims struct {
+		jwt.RegisteredClaims
+		Roles []string `json:"roles"`
+	}
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(jwtMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+		jwt.WithTimeFunc(j.now),
+	}
+	if j.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(j.issuer))
+	}
+	if j.audience != "" {
+		opts = append(opts, jwt.WithAudience(j.audience))
+	}
+	if _, err := jwt.ParseWithClaims(token, &claims, j.key, opts...); err != nil {
+		return "", nil, err
+	}
+	if claims.Subject == "" {
+		return "", nil, errors.New("missing sub")
+	}
+	return claims.Subject, claims.Roles, nil
+}
+
+// key returns the JWKS key named by the token's kid, provided its type fits
+// the token's alg; an ES alg must also match the key's curve.
+func (j *JWT) key(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := j.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch t.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			return k, nil
+		}
+	case *ecdsa.PublicKey:
+		if m, ok := t.Method.(*jwt.SigningMethodECDSA); ok && m.CurveBits == k.Curve.Params().BitSize {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("alg %q does not match key", t.Method.Alg())
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1_700_000_000, 0)
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func segment(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return b64(b)
+}
+
+// signJWT returns a token with the given header and claims, signed with key
+// (an *rsa.PrivateKey for RS256 or an *ecdsa.PrivateKey for ES256).
+func signJWT(t *testing.T, key crypto.Signer, header, claims map[string]interface{}) string {
+	t.Helper()
+	signed := segment(header) + "." + segment(claims)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + b64(sig)
+}
+
+func newTestJWT(t *testing.T) (*JWT, *rsa.PrivateKey, *ecdsa.PrivateKey) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+	}}
+	b, _ := json.Marshal(jwks)
+	j, err := LoadJWKS(writeFile(t, "jwks.json", string(b)), "https://idp.example", "vyos-api")
+	if err != nil {
+		t.Fatalf("LoadJWKS: %v", err)
+	}
+	j.now = func() time.Time { return testNow }
+	return j, rsaKey, ecKey
+}
+
+func TestJWT(t *testing.T) {
+	j, rsaKey, ecKey := newTestJWT(t)
+	claims := func(mod func(map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "ci-bot", "iss": "https://idp.example", "aud": []string{"other", "vyos-api"},
+			"exp": testNow.Add(time.Hour).Unix(),
+		}
+		if mod != nil {
+			mod(c)
+		}
+		return c
+	}
+	rs := map[string]interface{}{"alg": "RS256", "kid": "rsa1"}
+	es := map[string]interface{}{"alg": "ES256", "kid": "ec1"}
+
+	valid := []struct {
+		name  string
+		token string
+	}{
+		{"RS256", signJWT(t, rsaKey, rs, claims(nil))},
+		{"ES256", signJWT(t, ecKey, es, claims(nil))},
+		{"string aud", signJWT(t, rsaKey, rs, claims(func(c map[string]interface{}) { c["aud"] = "vyos-api" }))},
+	}
+	for _, tt := range valid {
+		p, err := j.Authenticate(bearer(tt.token))
+		if err != nil || p.Name != "ci-bot" || p.Method != "jwt" {
+			t.Errorf("%s: %+v, %v", tt.name, p, err)
+		}
+	}
+
+	tampered := signJWT(t, rsaKey, rs, claims(nil))
+	tampered = tampered[:len(tampered)-4] + "AAAA"
+	// A valid signature over different claims.
+	parts := strings.Split(signJWT(t, rsaKey, rs, claims(nil)), ".")
+	forged := parts[0] + "." + segment(claims(func(c map[string]interface{}) { c["sub"] = "admin" })) + "." + parts[2]
+	// HS256 keyed with the RSA public key, the classic alg confusion attack.
+	hsSigned := segment(map[string]string{"alg": "HS256", "kid": "rsa1"}) + "." + segment(claims(nil))
+	mac := hmac.New(sha256.New, rsaKey.PublicKey.N.Bytes())
+	mac.Write([]byte(hsSigned))
+	hs := hsSigned + "." + b64(mac.Sum(nil))
+	invalid := []struct {
+		name  string
+		token string
+	}{
+		{"expired", signJWT(t, rsaKey, rs, claims(func(c map[string]interface{}) { c["exp"] = testNow.Add(-time.Hour).Unix() }))},
+		{"no exp", signJWT(t, rsaKey, rs, claims(func(c map[string]interface{}) { delete(c, "exp") }))},
+		{"not yet valid", signJWT(t, rsaKey, rs, claims(func(c map[string]interface{}) { c["nbf"] = testNow.Add(time.Hour).Unix() }))},
+		{"wrong issuer", signJWT(t, rsaKey, rs, claims(func(c map[string]interface{}) { c["iss"] = "https://evil.example" }))},
+		{"wrong audience", signJWT(t, rsaKey, rs, claims(func(c map[string]interface{}) { c["aud"] = "other" }))},
+		{"unknown kid", signJWT(t, rsaKey, map[string]interface{}{"alg": "RS256", "kid": "nope"}, claims(nil))},
+		{"alg mismatch", signJWT(t, rsaKey, map[string]interface{}{"alg": "ES256", "kid": "rsa1"}, claims(nil))},
+		{"alg none", segment(map[string]string{"alg": "none", "kid": "rsa1"}) + "." + segment(claims(nil)) + "."},
+		{"alg HS256", hs},
+		{"RS alg on EC key", signJWT(t, ecKey, map[string]interface{}{"alg": "RS256", "kid": "ec1"}, claims(nil))},
+		{"ES384 on P-256 key", signJWT(t, ecKey, map[string]interface{}{"alg": "ES384", "kid": "ec1"}, claims(nil))},
+		{"tampered", tampered},
+		{"tampered claims", forged},
+		{"no sub", signJWT(t, rsaKey, rs, claims(func(c map[string]interface{}) { delete(c, "sub") }))},
+	}
+	for _, tt := range invalid {
+		if _, err := j.Authenticate(bearer(tt.token)); err == nil || errors.Is(err, ErrNoCredentials) {
+			t.Errorf("%s: err = %v, want an invalid-credentials error", tt.name, err)
+		}
+	}
+
+	if _, err := j.Authenticate(bearer("opaque-token")); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("non-JWT bearer: err = %v, want ErrNoCredentials", err)
+	}
+}
+
+func TestLoadJWKS_SmallRSAKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "weak", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())},
+	}}
+	b, _ := json.Marshal(jwks)
+	if _, err := LoadJWKS(writeFile(t, "jwks.json", string(b)), "", ""); err == nil || !strings.Contains(err.Error(), "1024 bits") {
+		t.Errorf("err = %v, want a key size error", err)
+	}
+}
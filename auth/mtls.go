@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// ClientCert authenticates TLS client certificates. The server verifies the
+// certificate against its client CA during the handshake (see
+// ServerTLSConfig); ClientCert only accepts requests whose certificate was
+// verified.
+type ClientCert struct{}
+
+// Authenticate accepts a request made over a connection with a verified
+// client certificate. The principal is the certificate's common name, or its
+// first DNS name if the common name is empty.
+func (ClientCert) Authenticate(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	name := cert.Subject.CommonName
+	if name == "" && len(cert.DNSNames) > 0 {
+		name = cert.DNSNames[0]
+	}
+	return &Principal{Name: name, Method: "mtls"}, nil
+}
+
+// ServerTLSConfig returns the listener TLS settings for serving certFile and
+// keyFile. If clientCAFile is set, client certificates signed by it are
+// requested and verified, but not required, so callers without one can still
+// use another authentication method.
+func ServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", clientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/logctx"
+)
+
+// Policy grants authenticated principals access by role. A request is allowed
+// if any rule of any of the principal's roles matches its method, resource
+// and device.
+type Policy struct {
+	// Roles maps a role name to its rules.
+	Roles map[string][]Rule `json:"roles"`
+	// Subjects maps principal names, or glob patterns of them, to roles.
+	// JWT principals also get the roles in their "roles" claim.
+	Subjects map[string][]string `json:"subjects"`
+}
+
+// Rule is one grant within a role.
+type Rule struct {
+	// Devices are glob patterns of device IDs, and Tags device tags; the rule
+	// applies to a device matching either. With neither set it applies to
+	// every device.
+	Devices []string `json:"devices,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	// Resources are resource kinds (see ResourceOf). A kind also covers the
+	// kinds below it, so "firewall" grants "firewall/policies/rules". "*"
+	// grants everything.
+	Resources []string `json:"resources"`
+	// Methods are HTTP methods, or "*" for all. GET also grants HEAD.
+	Methods []string `json:"methods"`
+}
+
+// LoadPolicy reads and validates a policy file.
+func LoadPolicy(path string) (*Policy, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &p, nil
+}
+
+func (p *Policy) validate() error {
+	for name, rules := range p.Roles {
+		for i, r := range rules {
+			if len(r.Resources) == 0 || len(r.Methods) == 0 {
+				return fmt.Errorf("role %q rule %d: resources and methods are required", name, i)
+			}
+			for _, g := range r.Devices {
+				if _, err := path.Match(g, ""); err != nil {
+					return fmt.Errorf("role %q rule %d: bad device pattern %q", name, i, g)
+				}
+			}
+		}
+	}
+	for subject, roles := range p.Subjects {
+		if _, err := path.Match(subject, ""); err != nil {
+			return fmt.Errorf("bad subject pattern %q", subject)
+		}
+		for _, role := range roles {
+			if _, ok := p.Roles[role]; !ok {
+				return fmt.Errorf("subject %q: unknown role %q", subject, role)
+			}
+		}
+	}
+	return nil
+}
+
+// RolesOf returns the defined roles of pr, sorted.
+func (p *Policy) RolesOf(pr *Principal) []string {
+	set := map[string]bool{}
+	for subject, roles := range p.Subjects {
+		if ok, _ := path.Match(subject, pr.Name); ok {
+			for _, r := range roles {
+				set[r] = true
+			}
+		}
+	}
+	for _, r := range pr.Roles {
+		if _, ok := p.Roles[r]; ok {
+			set[r] = true
+		}
+	}
+	out := make([]string, 0, len(set))
+	for r := range set {
+		out = append(out, r)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Request is what a rule is matched against.
+type Request struct {
+	Method   string
+	Resource string
+	// Device is empty for requests not scoped to a device, such as
+	// GET /devices; the device selectors of rules are then ignored.
+	Device string
+	Tags   []string
+}
+
+// Allowed reports whether pr may make req.
+func (p *Policy) Allowed(pr *Principal, req Request) bool {
+	for _, role := range p.RolesOf(pr) {
+		for _, r := range p.Roles[role] {
+			if r.matches(req) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r Rule) matches(req Request) bool {
+	return r.allowsMethod(req.Method) && r.allowsResource(req.Resource) &&
+		(req.Device == "" || r.AppliesTo(req.Device, req.Tags))
+}
+
+func (r Rule) allowsMethod(m string) bool {
+	for _, want := range r.Methods {
+		want = strings.ToUpper(want)
+		if want == "*" || want == m || (want == http.MethodGet && m == http.MethodHead) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) allowsResource(kind string) bool {
+	for _, want := range r.Resources {
+		if want == "*" || want == kind || strings.HasPrefix(kind, want+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// AppliesTo reports whether the rule covers the device with the given ID
+// and tags.
+func (r Rule) AppliesTo(id string, tags []string) bool {
+	if len(r.Devices) == 0 && len(r.Tags) == 0 {
+		return true
+	}
+	for _, g := range r.Devices {
+		if ok, _ := path.Match(g, id); ok {
+			return true
+		}
+	}
+	for _, want := range r.Tags {
+		for _, t := range tags {
+			if t == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ResourceOf returns the resource kind and device ID of a request, from its
+// mux route template. Under /devices/{device_id}/ the kind is the rest of the
+// template without path variables, e.g. "dhcp/servers" for
+// /devices/{device_id}/dhcp/servers/{name} and "nat/rules" for
+// /devices/{device_id}/nat/{nat_type}/rules. /devices and
+// /devices/{device_id} are "devices"; other routes are their first segment,
+// e.g. "metrics".
+func ResourceOf(r *http.Request) (kind, device string) {
+	tpl := r.URL.Path
+	if cr := mux.CurrentRoute(r); cr != nil {
+		if t, err := cr.GetPathTemplate(); err == nil {
+			tpl = t
+		}
+	}
+	device = mux.Vars(r)["device_id"]
+
+	var segs []string
+	for _, s := range strings.Split(strings.Trim(tpl, "/"), "/") {
+		if !strings.HasPrefix(s, "{") {
+			segs = append(segs, s)
+		}
+	}
+	if len(segs) == 0 {
+		return "", device
+	}
+	if segs[0] == "devices" && len(segs) > 1 {
+		return strings.Join(segs[1:], "/"), device
+	}
+	return segs[0], device
+}
+
+// Middleware rejects requests the principal from auth.Middleware may not make
+// with 403, except for the exact paths in exempt (see exempted). tags returns
+// the tags of a registered device.
+func (p *Policy) Middleware(tags func(id string) []string, exempt ...string) func(http.Handler) http.Handler {
+	skip := make(map[string]bool, len(exempt))
+	for _, e := range exempt {
+		skip[e] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempted(skip, r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			pr, ok := PrincipalFrom(r.Context())
+			kind, device := ResourceOf(r)
+			req := Request{Method: r.Method, Resource: kind, Device: device}
+			if device != "" {
+				req.Tags = tags(device)
+			}
+			if !ok || !p.Allowed(pr, req) {
+				logctx.From(r.Context()).Warn("request forbidden by policy", "resource", kind, "device", device)
+				writeError(w, http.StatusForbidden, fmt.Sprintf("not permitted to %s %s", r.Method, describeTarget(kind, device)))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func describeTarget(kind, device string) string {
+	if device == "" {
+		return kind
+	}
+	return kind + " on device " + device
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+const testPolicy = `{
+  "roles": {
+    "admin":    [{"resources": ["*"], "methods": ["*"]}],
+    "operator": [
+      {"devices": ["edge-*"], "resources": ["firewall", "nat"], "methods": ["GET", "PUT"]},
+      {"tags": ["lab"], "resources": ["*"], "methods": ["*"]}
+    ],
+    "viewer":   [{"resources": ["*"], "methods": ["GET"]}]
+  },
+  "subjects": {
+    "alice":    ["admin"],
+    "svc-*":    ["operator"],
+    "auditor":  ["viewer"]
+  }
+}`
+
+func loadTestPolicy(t *testing.T) *Policy {
+	t.Helper()
+	p, err := LoadPolicy(writeFile(t, "policy.json", testPolicy))
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	return p
+}
+
+func TestResourceOf(t *testing.T) {
+	tests := []struct {
+		tpl, path, kind, device string
+	}{
+		{"/devices", "/devices", "devices", ""},
+		{"/devices/{device_id}", "/devices/r1", "devices", "r1"},
+		{"/devices/{device_id}/firewall/policies/{policy}/rules", "/devices/r1/firewall/policies/in/rules", "firewall/policies/rules", "r1"},
+		{"/devices/{device_id}/nat/{nat_type}/rules/{rule}", "/devices/r1/nat/source/rules/10", "nat/rules", "r1"},
+		{"/metrics", "/metrics", "metrics", ""},
+	}
+	for _, tt := range tests {
+		var kind, device string
+		r := mux.NewRouter()
+		r.HandleFunc(tt.tpl, func(w http.ResponseWriter, req *http.Request) {
+			kind, device = ResourceOf(req)
+		})
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if kind != tt.kind || device != tt.device {
+			t.Errorf("%s: got (%q, %q), want (%q, %q)", tt.path, kind, device, tt.kind, tt.device)
+		}
+	}
+}
+
+func TestPolicy_Allowed(t *testing.T) {
+	p := loadTestPolicy(t)
+	tests := []struct {
+		name string
+		pr   Principal
+		req  Request
+		want bool
+	}{
+		{"admin anything", Principal{Name: "alice"}, Request{Method: "DELETE", Resource: "devices", Device: "core1"}, true},
+		{"viewer get", Principal{Name: "auditor"}, Request{Method: "GET", Resource: "interfaces", Device: "core1"}, true},
+		{"viewer head", Principal{Name: "auditor"}, Request{Method: "HEAD", Resource: "interfaces", Device: "core1"}, true},
+		{"viewer put", Principal{Name: "auditor"}, Request{Method: "PUT", Resource: "interfaces", Device: "core1"}, false},
+		{"glob subject and device", Principal{Name: "svc-deploy"}, Request{Method: "PUT", Resource: "firewall/policies/rules", Device: "edge-1"}, true},
+		{"resource prefix is per segment", Principal{Name: "svc-deploy"}, Request{Method: "GET", Resource: "firewallx", Device: "edge-1"}, false},
+		{"device not matched", Principal{Name: "svc-deploy"}, Request{Method: "PUT", Resource: "nat/rules", Device: "core1"}, false},
+		{"method not granted", Principal{Name: "svc-deploy"}, Request{Method: "DELETE", Resource: "nat/rules", Device: "edge-1"}, false},
+		{"tag matched", Principal{Name: "svc-deploy"}, Request{Method: "DELETE", Resource: "vrf", Device: "lab3", Tags: []string{"lab"}}, true},
+		{"no device ignores selectors", Principal{Name: "svc-deploy"}, Request{Method: "GET", Resource: "firewall"}, true},
+		{"jwt role claim", Principal{Name: "bob", Roles: []string{"viewer", "undefined"}}, Request{Method: "GET", Resource: "devices"}, true},
+		{"no roles", Principal{Name: "mallory"}, Request{Method: "GET", Resource: "devices"}, false},
+	}
+	for _, tt := range tests {
+		if got := p.Allowed(&tt.pr, tt.req); got != tt.want {
+			t.Errorf("%s: Allowed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	roles := p.RolesOf(&Principal{Name: "bob", Roles: []string{"viewer", "undefined"}})
+	if len(roles) != 1 || roles[0] != "viewer" {
+		t.Errorf("RolesOf = %v, want [viewer]", roles)
+	}
+}
+
+func TestLoadPolicy_Invalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown role":    `{"roles": {}, "subjects": {"alice": ["admin"]}}`,
+		"missing methods": `{"roles": {"r": [{"resources": ["*"]}]}}`,
+		"bad glob":        `{"roles": {"r": [{"devices": ["["], "resources": ["*"], "methods": ["*"]}]}}`,
+		"unknown field":   `{"roles": {"r": [{"resource": ["*"], "methods": ["*"]}]}}`,
+		"not json":        `roles: {}`,
+	} {
+		if _, err := LoadPolicy(writeFile(t, "policy.json", content)); err == nil {
+			t.Errorf("%s: LoadPolicy succeeded", name)
+		}
+	}
+}
+
+func TestPolicy_Middleware(t *testing.T) {
+	p := loadTestPolicy(t)
+	tags := map[string][]string{"lab3": {"lab"}}
+	r := mux.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if name := req.Header.Get("X-Test-Principal"); name != "" {
+				req = req.WithContext(context.WithValue(req.Context(), ctxKey{}, &Principal{Name: name}))
+			}
+			next.ServeHTTP(w, req)
+		})
+	})
+	r.Use(p.Middleware(func(id string) []string { return tags[id] }, "/whoami"))
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r.HandleFunc("/whoami", ok)
+	r.HandleFunc("/devices/{device_id}/nat/{nat_type}/rules", ok)
+
+	tests := []struct {
+		name, principal, method, path string
+		want                          int
+	}{
+		{"exempt", "", http.MethodGet, "/whoami", http.StatusOK},
+		{"exempt without query", "", http.MethodGet, "/whoami?x=1", http.StatusForbidden},
+		{"no principal", "", http.MethodGet, "/devices/edge-1/nat/source/rules", http.StatusForbidden},
+		{"allowed", "svc-deploy", http.MethodPut, "/devices/edge-1/nat/source/rules", http.StatusOK},
+		{"wrong device", "svc-deploy", http.MethodPut, "/devices/core1/nat/source/rules", http.StatusForbidden},
+		{"by tag", "svc-deploy", http.MethodDelete, "/devices/lab3/nat/source/rules", http.StatusOK},
+		{"viewer write", "auditor", http.MethodPost, "/devices/core1/nat/source/rules", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.principal != "" {
+			req.Header.Set("X-Test-Principal", tt.principal)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d\nbody: %s", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+}
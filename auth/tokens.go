@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Tokens authenticates static bearer tokens. Only SHA-256 hashes of the
+// tokens are held, so the tokens file does not grant access if it leaks.
+type Tokens struct {
+	hashes []tokenHash
+}
+
+type tokenHash struct {
+	sum  [sha256.Size]byte
+	name string
+}
+
+// LoadTokens reads a tokens file: one token per line as the hex SHA-256 of
+// the token followed by a name for logs, i.e. the output of
+//
+//	printf %s "$TOKEN" | sha256sum
+//
+// with "-" replaced by the name. Blank lines and lines starting with # are
+// ignored. A line without a name is named after its line number.
+func LoadTokens(path string) (*Tokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t := &Tokens{}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		b, err := hex.DecodeString(fields[0])
+		if err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("%s:%d: expected a hex SHA-256 hash", path, n)
+		}
+		h := tokenHash{name: fmt.Sprintf("token-line-%d", n)}
+		copy(h.sum[:], b)
+		if len(fields) > 1 && fields[1] != "-" {
+			h.name = fields[1]
+		}
+		t.hashes = append(t.hashes, h)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(t.hashes) == 0 {
+		return nil, fmt.Errorf("%s: no tokens", path)
+	}
+	return t, nil
+}
+
+// Authenticate accepts an "Authorization: Bearer" token whose hash is listed.
+func (t *Tokens) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	sum := sha256.Sum256([]byte(token))
+	// Compare against every hash so the time taken does not reveal which,
+	// if any, matched.
+	var match *tokenHash
+	for i := range t.hashes {
+		if subtle.ConstantTimeCompare(sum[:], t.hashes[i].sum[:]) == 1 {
+			match = &t.hashes[i]
+		}
+	}
+	if match == nil {
+		return nil, errors.New("unknown bearer token")
+	}
+	return &Principal{Name: match.name, Method: "token"}, nil
+}
@@ -2,11 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
-	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/vyos"
 )
 
 // AddressGroupInfo is the API representation of a VyOS firewall address group.
@@ -30,6 +30,10 @@ type UpdateAddressGroupRequest struct {
 	Description string   `json:"description,omitempty"`
 }
 
+func addressGroupPath(name string) []string {
+	return []string{"firewall", "group", "address-group", name}
+}
+
 // ListAddressGroups handles GET /devices/{device_id}/firewall/address-groups.
 func (h *Handler) ListAddressGroups(w http.ResponseWriter, r *http.Request) {
 	c, ok := h.getClient(w, r)
@@ -37,18 +41,10 @@ func (h *Handler) ListAddressGroups(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	out, _, err := c.Conf.Get(r.Context(), "firewall group address-group", nil)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
-		return
-	}
-	if !out.Success {
-		// No address groups configured: VyOS returns "Configuration under specified path is empty"
-		if strings.Contains(fmt.Sprint(out.Error), "empty") {
-			writeJSON(w, http.StatusOK, []AddressGroupInfo{})
-			return
-		}
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
+	out, err := c.Conf.GetPath(r.Context(), []string{"firewall", "group", "address-group"})
+	// A missing path means no address groups are configured yet.
+	if err != nil && !errors.Is(err, vyos.ErrPathNotFound) {
+		writeDeviceError(w, err)
 		return
 	}
 
@@ -63,6 +59,7 @@ func (h *Handler) ListAddressGroups(w http.ResponseWriter, r *http.Request) {
 		result = append(result, parseAddressGroupData(name, data))
 	}
 
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, result)
 }
 
@@ -78,49 +75,45 @@ func (h *Handler) CreateAddressGroup(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid JSON body")
 		return
 	}
-	if req.Name == "" {
-		writeError(w, http.StatusBadRequest, "name is required")
+	if err := req.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// Add each address member.
+	b := c.Conf.Batch()
+	created := req.build(b)
+	if !h.commit(w, r, b) {
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (req CreateAddressGroupRequest) validate() error {
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func (req CreateAddressGroupRequest) build(b *vyos.Batch) interface{} {
+	base := addressGroupPath(req.Name)
+
+	// Add each address member, or create an empty group if none were given.
 	for _, addr := range req.Addresses {
-		path := fmt.Sprintf("firewall group address-group %s address %s", req.Name, addr)
-		out, _, err := c.Conf.Set(r.Context(), path)
-		if err != nil {
-			writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
-			return
-		}
-		if !out.Success {
-			writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
-			return
-		}
-	}
-
-	// If no addresses provided, create an empty group.
+		b.Set(subPath(base, "address", addr))
+	}
 	if len(req.Addresses) == 0 {
-		path := fmt.Sprintf("firewall group address-group %s", req.Name)
-		out, _, err := c.Conf.Set(r.Context(), path)
-		if err != nil {
-			writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
-			return
-		}
-		if !out.Success {
-			writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
-			return
-		}
+		b.Set(base)
 	}
-
 	if req.Description != "" {
-		descPath := fmt.Sprintf("firewall group address-group %s description %s", req.Name, req.Description)
-		c.Conf.Set(r.Context(), descPath) //nolint:errcheck
+		b.Set(subPath(base, "description", req.Description))
 	}
-
-	writeJSON(w, http.StatusCreated, AddressGroupInfo{
+	return AddressGroupInfo{
 		Name:        req.Name,
 		Addresses:   req.Addresses,
 		Description: req.Description,
-	})
+	}
 }
 
 // GetAddressGroup handles GET /devices/{device_id}/firewall/address-groups/{group}.
@@ -132,16 +125,17 @@ func (h *Handler) GetAddressGroup(w http.ResponseWriter, r *http.Request) {
 
 	group := mux.Vars(r)["group"]
 
-	out, _, err := c.Conf.Get(r.Context(), fmt.Sprintf("firewall group address-group %s", group), nil)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	out, err := c.Conf.GetPath(r.Context(), addressGroupPath(group))
+	if errors.Is(err, vyos.ErrPathNotFound) {
+		writeError(w, http.StatusNotFound, "address group not found")
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusNotFound, "address group not found")
+	if err != nil {
+		writeDeviceError(w, err)
 		return
 	}
 
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, parseAddressGroupData(group, out.Data))
 }
 
@@ -161,26 +155,32 @@ func (h *Handler) UpdateAddressGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Full replace: delete existing address list then re-add.
-	delPath := fmt.Sprintf("firewall group address-group %s address", group)
-	c.Conf.Delete(r.Context(), delPath) //nolint:errcheck
+	base := addressGroupPath(group)
+	if !ifMatch(w, r, c, base) {
+		return
+	}
 
-	for _, addr := range req.Addresses {
-		path := fmt.Sprintf("firewall group address-group %s address %s", group, addr)
-		out, _, err := c.Conf.Set(r.Context(), path)
-		if err != nil {
-			writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
-			return
-		}
-		if !out.Success {
-			writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
-			return
-		}
+	cur, err := c.Conf.GetPath(r.Context(), base)
+	if err != nil && !errors.Is(err, vyos.ErrPathNotFound) {
+		writeDeviceError(w, err)
+		return
 	}
 
+	// Full replace: delete existing address list then re-add. Deleting a
+	// missing node would fail the whole commit, so only delete when the group
+	// currently has addresses.
+	b := c.Conf.Batch()
+	if cfg, _ := cur.Data.(map[string]interface{}); cur.Success && cfg["address"] != nil {
+		b.Delete(subPath(base, "address"))
+	}
+	for _, addr := range req.Addresses {
+		b.Set(subPath(base, "address", addr))
+	}
 	if req.Description != "" {
-		descPath := fmt.Sprintf("firewall group address-group %s description %s", group, req.Description)
-		c.Conf.Set(r.Context(), descPath) //nolint:errcheck
+		b.Set(subPath(base, "description", req.Description))
+	}
+	if !h.commit(w, r, b) {
+		return
 	}
 
 	writeJSON(w, http.StatusOK, AddressGroupInfo{
@@ -198,14 +198,11 @@ func (h *Handler) DeleteAddressGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	group := mux.Vars(r)["group"]
-
-	out, _, err := c.Conf.Delete(r.Context(), fmt.Sprintf("firewall group address-group %s", group))
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	if !ifMatch(w, r, c, addressGroupPath(group)) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
+
+	if !h.commit(w, r, c.Conf.Batch().Delete(addressGroupPath(group))) {
 		return
 	}
 
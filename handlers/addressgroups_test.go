@@ -41,8 +41,8 @@ func TestListAddressGroups_DeviceNotFound(t *testing.T) {
 }
 
 func TestCreateAddressGroup_OK(t *testing.T) {
-	// Two Set calls (one per address), success for each.
-	_, _, client := newMockVyOS(t, successResp(), successResp())
+	// One batch with a Set per address.
+	m, _, client := newMockVyOS(t, successResp())
 	h := newHandler(client)
 
 	body := map[string]interface{}{
@@ -61,6 +61,9 @@ func TestCreateAddressGroup_OK(t *testing.T) {
 	if len(addrs) != 2 {
 		t.Errorf("got %d addresses, want 2", len(addrs))
 	}
+	if len(m.Received) != 2 {
+		t.Errorf("got %d ops in batch, want 2", len(m.Received))
+	}
 }
 
 func TestCreateAddressGroup_Empty(t *testing.T) {
@@ -127,8 +130,9 @@ func TestGetAddressGroup_NotFound(t *testing.T) {
 }
 
 func TestUpdateAddressGroup_OK(t *testing.T) {
-	// Delete existing addresses, then two Set calls (one per new address).
-	_, _, client := newMockVyOS(t, successResp(), successResp(), successResp())
+	// Get the current group, then one batch: Delete existing addresses + a Set per new address.
+	current := map[string]interface{}{"address": "10.9.9.9"}
+	_, _, client := newMockVyOS(t, dataResp(current), successResp())
 	h := newHandler(client)
 
 	body := map[string]interface{}{"addresses": []string{"10.0.0.1", "10.0.0.2"}}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/audit"
+	"github.com/valueiron/vyos-api/auth"
+	"github.com/valueiron/vyos-api/logctx"
+	"github.com/valueiron/vyos-api/vyos"
+)
+
+// minSnapshotDepth is the shortest config path an audit snapshot is read
+// from, so a batch touching unrelated sections does not copy the whole
+// configuration into the audit log.
+const minSnapshotDepth = 2
+
+// defaultAuditLimit is the number of events GET /audit returns without a
+// limit parameter.
+const defaultAuditLimit = 1000
+
+// SetAuditLog records every configuration change sent through the handlers
+// to l, and serves it from GET /audit.
+func (h *Handler) SetAuditLog(l *audit.Log) {
+	h.audit = l
+}
+
+// snapshotPath returns the deepest config node every op of b is under, not
+// counting the value of set ops, or false if it is shallower than
+// minSnapshotDepth.
+func snapshotPath(b *vyos.Batch) ([]string, bool) {
+	var prefix []string
+	for i, op := range b.Ops() {
+		p := op.Path
+		if op.Op == "set" && len(p) > 0 {
+			p = p[:len(p)-1]
+		}
+		if i == 0 {
+			prefix = p
+			continue
+		}
+		n := 0
+		for n < len(prefix) && n < len(p) && prefix[n] == p[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	if len(prefix) < minSnapshotDepth {
+		return nil, false
+	}
+	return subPath(prefix), true
+}
+
+// readSnapshot returns the redacted config at path, nil if it does not
+// exist, or false if it could not be read.
+func readSnapshot(r *http.Request, c *vyos.Client, path []string) (interface{}, bool) {
+	resp, err := c.Conf.GetPath(r.Context(), path)
+	if errors.Is(err, vyos.ErrPathNotFound) {
+		return nil, true
+	}
+	if err != nil {
+		logctx.From(r.Context()).Warn("audit snapshot failed", "path", vyos.RedactPath(path), "error", err)
+		return nil, false
+	}
+	return vyos.RedactConfig(path, resp.Data), true
+}
+
+// auditBefore reads the before half of the snapshot for b, if audit is on.
+func (h *Handler) auditBefore(r *http.Request, b *vyos.Batch) *audit.Snapshot {
+	if h.audit == nil || b.Len() == 0 {
+		return nil
+	}
+	path, ok := snapshotPath(b)
+	if !ok {
+		return nil
+	}
+	d, ok := h.devices.Get(mux.Vars(r)["device_id"])
+	if !ok {
+		return nil
+	}
+	before, ok := readSnapshot(r, d.Client, path)
+	if !ok {
+		return nil
+	}
+	return &audit.Snapshot{Path: vyos.RedactPath(path), Before: before}
+}
+
+// auditRecord records the commit of b, which failed with err if it is not
+// nil, completing snap with the configuration after a successful change.
+func (h *Handler) auditRecord(r *http.Request, b *vyos.Batch, confirmMinutes int, snap *audit.Snapshot, err error) {
+	if h.audit == nil || b.Len() == 0 {
+		return
+	}
+	ev := auditEvent(r, err)
+	ev.ConfirmMinutes = confirmMinutes
+	for _, op := range b.Ops() {
+		ev.Ops = append(ev.Ops, vyos.Op{Op: op.Op, Path: vyos.RedactPath(op.Path)})
+	}
+	if err == nil && snap != nil {
+		if d, ok := h.devices.Get(ev.Device); ok {
+			after, ok := readSnapshot(r, d.Client, snap.Path)
+			if ok {
+				snap.After = after
+			} else {
+				snap = nil
+			}
+		}
+	}
+	ev.Snapshot = snap
+	h.recordAudit(r, ev)
+}
+
+// auditAction records a change made without set/delete operations, such as
+// a config-file load, which failed with err if it is not nil.
+func (h *Handler) auditAction(r *http.Request, action, file string, err error) {
+	if h.audit == nil {
+		return
+	}
+	ev := auditEvent(r, err)
+	ev.Ops = []vyos.Op{}
+	ev.Action, ev.File = action, file
+	h.recordAudit(r, ev)
+}
+
+// auditEvent returns the event for a change requested by r, with the
+// outcome of err.
+func auditEvent(r *http.Request, err error) audit.Event {
+	resource, _ := auth.ResourceOf(r)
+	ev := audit.Event{
+		Time:      time.Now().UTC(),
+		RequestID: logctx.RequestID(r.Context()),
+		Device:    mux.Vars(r)["device_id"],
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Resource:  resource,
+		Outcome:   audit.Success,
+	}
+	if pr, ok := auth.PrincipalFrom(r.Context()); ok {
+		ev.Principal, ev.AuthMethod = pr.Name, pr.Method
+	}
+	if err != nil {
+		ev.Outcome, ev.Error = audit.Failure, err.Error()
+	}
+	return ev
+}
+
+func (h *Handler) recordAudit(r *http.Request, ev audit.Event) {
+	if err := h.audit.Record(ev); err != nil {
+		logctx.From(r.Context()).Error("failed to write audit event", "error", err)
+	}
+}
+
+// visibleDevices returns, under a policy, the check for which devices' events
+// the caller of r may read: those a rule granting the request also applies
+// to, so a role limited to some devices does not see the others' changes.
+// Retired devices are matched by ID alone. Without a policy it returns nil.
+func (h *Handler) visibleDevices(r *http.Request) func(device string) bool {
+	if h.policy == nil {
+		return nil
+	}
+	pr, ok := auth.PrincipalFrom(r.Context())
+	kind, _ := auth.ResourceOf(r)
+	seen := map[string]bool{}
+	return func(device string) bool {
+		if !ok {
+			return false
+		}
+		allowed, done := seen[device]
+		if !done {
+			req := auth.Request{Method: r.Method, Resource: kind, Device: device}
+			if d, ok := h.devices.Get(device); ok {
+				req.Tags = d.Tags
+			}
+			allowed = h.policy.Allowed(pr, req)
+			seen[device] = allowed
+		}
+		return allowed
+	}
+}
+
+// Audit handles GET /audit.
+// Returns recorded configuration changes, oldest first, optionally filtered
+// by device, resource kind and start time.
+func (h *Handler) Audit(w http.ResponseWriter, r *http.Request) {
+	if h.audit == nil {
+		writeError(w, http.StatusNotFound, "audit log not enabled")
+		return
+	}
+	q := r.URL.Query()
+	f := audit.Filter{Device: q.Get("device"), Resource: q.Get("resource"), Limit: defaultAuditLimit}
+	if v := q.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "since must be an RFC 3339 time")
+			return
+		}
+		f.Since = t
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		f.Limit = n
+	}
+	f.Visible = h.visibleDevices(r)
+	events, err := h.audit.Query(f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "reading audit log: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, events)
+}
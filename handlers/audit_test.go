@@ -0,0 +1,187 @@
+package handlers_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/audit"
+	"github.com/valueiron/vyos-api/auth"
+	"github.com/valueiron/vyos-api/handlers"
+	"github.com/valueiron/vyos-api/vyos"
+)
+
+// auditHandler returns a handler for router1 with an audit log, and a router
+// serving its VRF and audit routes.
+func auditHandler(t *testing.T, client *vyos.Client) (*handlers.Handler, *mux.Router) {
+	t.Helper()
+	l, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	h := newHandler(client)
+	h.SetAuditLog(l)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/devices/{device_id}/vrfs", h.CreateVRF).Methods(http.MethodPost)
+	r.HandleFunc("/devices/{device_id}/vrfs/{vrf}", h.DeleteVRF).Methods(http.MethodDelete)
+	r.HandleFunc("/devices/{device_id}/config/load", h.LoadConfig).Methods(http.MethodPost)
+	r.HandleFunc("/devices/{device_id}/config/confirm", h.ConfirmConfig).Methods(http.MethodPost)
+	r.HandleFunc("/audit", h.Audit).Methods(http.MethodGet)
+	return h, r
+}
+
+func serve(r http.Handler, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestAudit_RecordsChanges(t *testing.T) {
+	before := map[string]interface{}{"table": "100", "description": "mgmt"}
+	mock, _, client := newMockVyOS(t,
+		// Delete MGMT: snapshot, commit, snapshot of the now absent node.
+		dataResp(before),
+		successResp(),
+		failResp("Configuration under specified path is empty"),
+		// Delete PROD: snapshot, rejected commit.
+		successResp(),
+		failResp("Commit failed"),
+	)
+	_, r := auditHandler(t, client)
+
+	assertStatus(t, serve(r, http.MethodDelete, "/devices/router1/vrfs/MGMT"), http.StatusNoContent)
+	assertStatus(t, serve(r, http.MethodDelete, "/devices/router1/vrfs/PROD"), http.StatusUnprocessableEntity)
+	if len(mock.Received) != 5 {
+		t.Fatalf("device got %d requests, want 5", len(mock.Received))
+	}
+
+	w := serve(r, http.MethodGet, "/audit?device=router1&resource=vrfs")
+	assertStatus(t, w, http.StatusOK)
+	var events []audit.Event
+	decodeJSON(t, w, &events)
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+
+	ev := events[0]
+	if ev.Outcome != audit.Success || ev.Resource != "vrfs" || ev.Method != http.MethodDelete || ev.Device != "router1" {
+		t.Errorf("event = %+v", ev)
+	}
+	wantOps := []vyos.Op{{Op: "delete", Path: []string{"vrf", "name", "MGMT"}}}
+	if !reflect.DeepEqual(ev.Ops, wantOps) {
+		t.Errorf("ops = %v, want %v", ev.Ops, wantOps)
+	}
+	if ev.Snapshot == nil || !reflect.DeepEqual(ev.Snapshot.Before, before) || ev.Snapshot.After != nil {
+		t.Errorf("snapshot = %+v, want before %v and no after", ev.Snapshot, before)
+	}
+
+	if events[1].Outcome != audit.Failure || events[1].Error == "" {
+		t.Errorf("failed change: %+v", events[1])
+	}
+
+	w = serve(r, http.MethodGet, "/audit?resource=nat")
+	decodeJSON(t, w, &events)
+	if len(events) != 0 {
+		t.Errorf("resource=nat: got %d events, want 0", len(events))
+	}
+}
+
+func TestAudit_RecordsLoadAndConfirm(t *testing.T) {
+	_, _, client := newMockVyOS(t, successResp(), failResp("No confirm pending"))
+	_, r := auditHandler(t, client)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/devices/router1/config/load", strings.NewReader(`{"file":"/config/old.boot"}`)))
+	assertStatus(t, w, http.StatusOK)
+	assertStatus(t, serve(r, http.MethodPost, "/devices/router1/config/confirm"), http.StatusUnprocessableEntity)
+
+	w = serve(r, http.MethodGet, "/audit?resource=config")
+	var events []audit.Event
+	decodeJSON(t, w, &events)
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if ev := events[0]; ev.Action != audit.ActionLoad || ev.File != "/config/old.boot" || ev.Outcome != audit.Success || ev.Resource != "config/load" {
+		t.Errorf("load event = %+v", ev)
+	}
+	if ev := events[1]; ev.Action != audit.ActionConfirm || ev.Outcome != audit.Failure || ev.Error == "" {
+		t.Errorf("confirm event = %+v", ev)
+	}
+}
+
+func TestAudit_PolicyLimitsDevices(t *testing.T) {
+	_, _, client := newMockVyOS(t)
+	h := handlers.New(map[string]*handlers.Device{
+		"edge-1": {ID: "edge-1", Client: client},
+		"core1":  {ID: "core1", Client: client, Tags: []string{"lab"}},
+	})
+	l, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	h.SetAuditLog(l)
+	for _, d := range []string{"edge-1", "core1", "retired"} {
+		if err := l.Record(audit.Event{Device: d, Resource: "vrfs", Outcome: audit.Success}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+	sum := sha256.Sum256([]byte("s3cret"))
+	tokensPath := filepath.Join(dir, "tokens")
+	policyPath := filepath.Join(dir, "policy.json")
+	if err := os.WriteFile(tokensPath, []byte(hex.EncodeToString(sum[:])+" svc-edge\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy := `{"roles": {"edge": [{"devices": ["edge-*"], "resources": ["audit"], "methods": ["GET"]}]}, "subjects": {"svc-edge": ["edge"]}}`
+	if err := os.WriteFile(policyPath, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.LoadTokens(tokensPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := auth.LoadPolicy(policyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetPolicy(p)
+
+	r := mux.NewRouter()
+	r.Use(auth.Middleware(tokens), p.Middleware(func(string) []string { return nil }))
+	r.HandleFunc("/audit", h.Audit)
+	req := httptest.NewRequest(http.MethodGet, "/audit", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assertStatus(t, w, http.StatusOK)
+	var events []audit.Event
+	decodeJSON(t, w, &events)
+	if len(events) != 1 || events[0].Device != "edge-1" {
+		t.Errorf("events = %+v, want only edge-1's", events)
+	}
+}
+
+func TestAudit_BadQuery(t *testing.T) {
+	_, _, client := newMockVyOS(t)
+	_, r := auditHandler(t, client)
+	assertStatus(t, serve(r, http.MethodGet, "/audit?since=yesterday"), http.StatusBadRequest)
+	assertStatus(t, serve(r, http.MethodGet, "/audit?limit=0"), http.StatusBadRequest)
+}
+
+func TestAudit_Disabled(t *testing.T) {
+	_, _, client := newMockVyOS(t)
+	h := newHandler(client)
+	w := do(t, http.MethodGet, "/audit", nil, nil, h.Audit)
+	assertStatus(t, w, http.StatusNotFound)
+}
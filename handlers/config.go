@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/valueiron/vyos-api/audit"
+	"github.com/valueiron/vyos-api/vyos"
+)
+
+// ConfigFileRequest is the JSON body for POST /devices/{device_id}/config/save
+// and /config/load.
+type ConfigFileRequest struct {
+	// File is a path on the device. For save it is optional and defaults to
+	// the boot config (/config/config.boot); for load it is required.
+	File string `json:"file,omitempty"`
+}
+
+// ConfigFileResponse is returned by the save and load endpoints.
+type ConfigFileResponse struct {
+	Op   string `json:"op"`
+	File string `json:"file"`
+}
+
+// SaveConfig handles POST /devices/{device_id}/config/save.
+// Persists the running config so that changes survive a reboot. The body is optional.
+func (h *Handler) SaveConfig(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.getClient(w, r)
+	if !ok {
+		return
+	}
+	if !noDryRun(w, r) {
+		return
+	}
+
+	var req ConfigFileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	_, err := c.ConfigFile.Save(r.Context(), req.File)
+	if err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+
+	file := req.File
+	if file == "" {
+		file = "/config/config.boot"
+	}
+	writeJSON(w, http.StatusOK, ConfigFileResponse{Op: "save", File: file})
+}
+
+// LoadConfig handles POST /devices/{device_id}/config/load.
+// Replaces the running config with the given file on the device and commits it.
+func (h *Handler) LoadConfig(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.getClient(w, r)
+	if !ok {
+		return
+	}
+	if !noDryRun(w, r) {
+		return
+	}
+
+	var req ConfigFileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.File == "" {
+		writeError(w, http.StatusBadRequest, "file is required")
+		return
+	}
+
+	h.snapshotBefore(r)
+	_, err := c.ConfigFile.Load(r.Context(), req.File)
+	h.auditAction(r, audit.ActionLoad, req.File, err)
+	if err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ConfigFileResponse{Op: "load", File: req.File})
+}
+
+// BatchRequest is the JSON body for POST /devices/{device_id}/config/batch.
+type BatchRequest struct {
+	// Operations are applied in order as one commit.
+	Operations []vyos.Op `json:"operations"`
+	// ConfirmMinutes, if set, sends the batch as a commit-confirm. It may be
+	// given as the confirm_minutes query parameter instead, but not as both
+	// with different values.
+	ConfirmMinutes int `json:"confirm_minutes,omitempty"`
+}
+
+// BatchResponse is returned by the batch endpoint.
+type BatchResponse struct {
+	Operations     []vyos.Op `json:"operations"`
+	ConfirmMinutes int       `json:"confirm_minutes,omitempty"`
+}
+
+// BatchConfig handles POST /devices/{device_id}/config/batch.
+// Applies arbitrary set/delete operations as a single commit.
+func (h *Handler) BatchConfig(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.getClient(w, r)
+	if !ok {
+		return
+	}
+
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if len(req.Operations) == 0 {
+		writeError(w, http.StatusBadRequest, "operations is required")
+		return
+	}
+	if req.ConfirmMinutes < 0 {
+		writeError(w, http.StatusBadRequest, "confirm_minutes must be a positive integer")
+		return
+	}
+	minutes, ok := confirmMinutes(w, r)
+	if !ok {
+		return
+	}
+	switch {
+	case minutes == 0:
+		minutes = req.ConfirmMinutes
+	case req.ConfirmMinutes != 0 && req.ConfirmMinutes != minutes:
+		writeError(w, http.StatusBadRequest, "confirm_minutes differs between the query and the body")
+		return
+	}
+
+	b := c.Conf.Batch()
+	for i, op := range req.Operations {
+		if len(op.Path) == 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("operations[%d]: path is required", i))
+			return
+		}
+		switch op.Op {
+		case "set":
+			b.Set(op.Path)
+		case "delete":
+			b.Delete(op.Path)
+		default:
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("operations[%d]: op must be set or delete", i))
+			return
+		}
+	}
+	if !h.apply(w, r, b, minutes) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, BatchResponse{Operations: b.Ops(), ConfirmMinutes: minutes})
+}
+
+// ConfirmConfig handles POST /devices/{device_id}/config/confirm.
+// Accepts a pending commit-confirm so the device keeps the change. Devices
+// with AutoSave are saved afterwards, since the pending commit was not.
+func (h *Handler) ConfirmConfig(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.getClient(w, r)
+	if !ok {
+		return
+	}
+	if !noDryRun(w, r) {
+		return
+	}
+
+	_, err := c.Conf.Confirm(r.Context())
+	h.auditAction(r, audit.ActionConfirm, "", err)
+	if err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+	if !h.autoSave(w, r) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
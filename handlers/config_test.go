@@ -0,0 +1,250 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/valueiron/vyos-api/handlers"
+)
+
+func TestSaveConfig_DefaultFile(t *testing.T) {
+	m, _, client := newMockVyOS(t, successResp())
+	h := newHandler(client)
+
+	w := do(t, http.MethodPost, "/", nil, deviceVars(), h.SaveConfig)
+	assertStatus(t, w, http.StatusOK)
+
+	var result map[string]string
+	decodeJSON(t, w, &result)
+	if result["file"] != "/config/config.boot" {
+		t.Errorf("file = %q, want /config/config.boot", result["file"])
+	}
+	if len(m.Received) != 1 || m.Received[0].Op != "save" {
+		t.Errorf("received = %+v, want one save op", m.Received)
+	}
+}
+
+func TestSaveConfig_Rejected(t *testing.T) {
+	_, _, client := newMockVyOS(t, failResp("permission denied"))
+	h := newHandler(client)
+	w := do(t, http.MethodPost, "/", map[string]string{"file": "/root/x"}, deviceVars(), h.SaveConfig)
+	assertStatus(t, w, http.StatusUnprocessableEntity)
+}
+
+func TestLoadConfig_OK(t *testing.T) {
+	m, _, client := newMockVyOS(t, successResp())
+	h := newHandler(client)
+
+	w := do(t, http.MethodPost, "/", map[string]string{"file": "/config/backup.config"}, deviceVars(), h.LoadConfig)
+	assertStatus(t, w, http.StatusOK)
+	if len(m.Received) != 1 || m.Received[0].Op != "load" {
+		t.Errorf("received = %+v, want one load op", m.Received)
+	}
+}
+
+func TestLoadConfig_MissingFile(t *testing.T) {
+	_, _, client := newMockVyOS(t)
+	h := newHandler(client)
+	w := do(t, http.MethodPost, "/", map[string]string{}, deviceVars(), h.LoadConfig)
+	assertStatus(t, w, http.StatusBadRequest)
+}
+
+func TestAutoSave_SavesAfterCommit(t *testing.T) {
+	m, _, client := newMockVyOS(t, successResp(), successResp())
+	h := handlers.New(map[string]*handlers.Device{
+		"router1": {ID: "router1", URL: "http://test-device", Client: client, AutoSave: true},
+	})
+
+	w := do(t, http.MethodDelete, "/", nil, deviceVars("vrf", "MGMT"), h.DeleteVRF)
+	assertStatus(t, w, http.StatusNoContent)
+
+	if len(m.Received) != 2 || m.Received[0].Op != "delete" || m.Received[1].Op != "save" {
+		t.Errorf("received = %+v, want delete then save", m.Received)
+	}
+}
+
+func TestAutoSave_SaveFailureReported(t *testing.T) {
+	_, _, client := newMockVyOS(t, successResp(), failResp("disk full"))
+	h := handlers.New(map[string]*handlers.Device{
+		"router1": {ID: "router1", URL: "http://test-device", Client: client, AutoSave: true},
+	})
+
+	w := do(t, http.MethodDelete, "/", nil, deviceVars("vrf", "MGMT"), h.DeleteVRF)
+	assertStatus(t, w, http.StatusUnprocessableEntity)
+}
+
+func TestAutoSave_SkippedWhenCommitRejected(t *testing.T) {
+	m, _, client := newMockVyOS(t, failResp("VRF not found"))
+	h := handlers.New(map[string]*handlers.Device{
+		"router1": {ID: "router1", URL: "http://test-device", Client: client, AutoSave: true},
+	})
+
+	w := do(t, http.MethodDelete, "/", nil, deviceVars("vrf", "NOPE"), h.DeleteVRF)
+	assertStatus(t, w, http.StatusUnprocessableEntity)
+	if len(m.Received) != 1 {
+		t.Errorf("got %d device ops, want 1 (no save)", len(m.Received))
+	}
+}
+
+// --------------------------------------------------------------------------
+// Commit-confirm
+// --------------------------------------------------------------------------
+
+func TestCommitConfirm_QueryParam(t *testing.T) {
+	m, _, client := newMockVyOS(t, successResp())
+	h := newHandler(client)
+
+	w := do(t, http.MethodDelete, "/?confirm_minutes=5", nil, deviceVars("vrf", "MGMT"), h.DeleteVRF)
+	assertStatus(t, w, http.StatusNoContent)
+
+	if got := w.Header().Get(handlers.ConfirmHeader); got != "5" {
+		t.Errorf("%s = %q, want 5", handlers.ConfirmHeader, got)
+	}
+	if len(m.Received) != 1 || m.Received[0].ConfirmTime != 5 {
+		t.Errorf("received = %+v, want one op with confirm_time 5", m.Received)
+	}
+}
+
+func TestCommitConfirm_InvalidMinutes(t *testing.T) {
+	m, _, client := newMockVyOS(t)
+	h := newHandler(client)
+
+	w := do(t, http.MethodDelete, "/?confirm_minutes=0", nil, deviceVars("vrf", "MGMT"), h.DeleteVRF)
+	assertStatus(t, w, http.StatusBadRequest)
+	if len(m.Received) != 0 {
+		t.Errorf("device received %d ops, want 0", len(m.Received))
+	}
+}
+
+func TestCommitConfirm_SkipsAutoSave(t *testing.T) {
+	// Saving a pending commit would make it survive the revert.
+	m, _, client := newMockVyOS(t, successResp())
+	h := handlers.New(map[string]*handlers.Device{
+		"router1": {ID: "router1", URL: "http://test-device", Client: client, AutoSave: true},
+	})
+
+	w := do(t, http.MethodDelete, "/?confirm_minutes=2", nil, deviceVars("vrf", "MGMT"), h.DeleteVRF)
+	assertStatus(t, w, http.StatusNoContent)
+	if len(m.Received) != 1 {
+		t.Errorf("received = %+v, want only the commit", m.Received)
+	}
+}
+
+func TestConfirmConfig_OK(t *testing.T) {
+	m, _, client := newMockVyOS(t, successResp())
+	h := newHandler(client)
+
+	w := do(t, http.MethodPost, "/", nil, deviceVars(), h.ConfirmConfig)
+	assertStatus(t, w, http.StatusNoContent)
+	if len(m.Received) != 1 || m.Received[0].Op != "confirm" {
+		t.Errorf("received = %+v, want one confirm op", m.Received)
+	}
+}
+
+func TestConfirmConfig_AutoSave(t *testing.T) {
+	m, _, client := newMockVyOS(t, successResp(), successResp())
+	h := handlers.New(map[string]*handlers.Device{
+		"router1": {ID: "router1", URL: "http://test-device", Client: client, AutoSave: true},
+	})
+
+	w := do(t, http.MethodPost, "/", nil, deviceVars(), h.ConfirmConfig)
+	assertStatus(t, w, http.StatusNoContent)
+	if len(m.Received) != 2 || m.Received[1].Op != "save" {
+		t.Errorf("received = %+v, want confirm then save", m.Received)
+	}
+}
+
+func TestConfirmConfig_NothingPending(t *testing.T) {
+	_, _, client := newMockVyOS(t, failResp("No confirm pending"))
+	h := newHandler(client)
+	w := do(t, http.MethodPost, "/", nil, deviceVars(), h.ConfirmConfig)
+	assertStatus(t, w, http.StatusUnprocessableEntity)
+}
+
+// --------------------------------------------------------------------------
+// BatchConfig
+// --------------------------------------------------------------------------
+
+func TestBatchConfig_OK(t *testing.T) {
+	m, _, client := newMockVyOS(t, successResp())
+	h := newHandler(client)
+
+	body := map[string]interface{}{
+		"operations": []map[string]interface{}{
+			{"op": "set", "path": []string{"interfaces", "ethernet", "eth1", "description", "new uplink"}},
+			{"op": "delete", "path": []string{"interfaces", "ethernet", "eth1", "address", "10.0.0.1/24"}},
+		},
+		"confirm_minutes": 3,
+	}
+	w := do(t, http.MethodPost, "/", body, deviceVars(), h.BatchConfig)
+	assertStatus(t, w, http.StatusOK)
+
+	if len(m.Received) != 2 || m.Received[0].ConfirmTime != 3 || m.Received[1].Op != "delete" {
+		t.Errorf("received = %+v, want set then delete with confirm_time 3", m.Received)
+	}
+	if got := w.Header().Get(handlers.ConfirmHeader); got != "3" {
+		t.Errorf("%s = %q, want 3", handlers.ConfirmHeader, got)
+	}
+}
+
+func TestBatchConfig_ConfirmMinutesQuery(t *testing.T) {
+	body := map[string]interface{}{
+		"operations": []map[string]interface{}{
+			{"op": "set", "path": []string{"interfaces", "ethernet", "eth1", "description", "new uplink"}},
+		},
+	}
+	for _, tt := range []struct {
+		name, query string
+		body        int
+		status      int
+		confirm     int
+	}{
+		{"query only", "?confirm_minutes=4", 0, http.StatusOK, 4},
+		{"both agree", "?confirm_minutes=4", 4, http.StatusOK, 4},
+		{"both differ", "?confirm_minutes=4", 5, http.StatusBadRequest, 0},
+		{"invalid query", "?confirm_minutes=x", 0, http.StatusBadRequest, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, client := newMockVyOS(t, successResp())
+			h := newHandler(client)
+			body["confirm_minutes"] = tt.body
+			w := do(t, http.MethodPost, "/"+tt.query, body, deviceVars(), h.BatchConfig)
+			assertStatus(t, w, tt.status)
+			if tt.status != http.StatusOK {
+				if len(m.Received) != 0 {
+					t.Errorf("device received %d ops, want 0", len(m.Received))
+				}
+				return
+			}
+			var resp handlers.BatchResponse
+			decodeJSON(t, w, &resp)
+			if len(m.Received) != 1 || m.Received[0].ConfirmTime != tt.confirm || resp.ConfirmMinutes != tt.confirm {
+				t.Errorf("received = %+v, response confirm_minutes %d, want %d", m.Received, resp.ConfirmMinutes, tt.confirm)
+			}
+		})
+	}
+}
+
+func TestBatchConfig_InvalidOp(t *testing.T) {
+	m, _, client := newMockVyOS(t)
+	h := newHandler(client)
+
+	body := map[string]interface{}{
+		"operations": []map[string]interface{}{
+			{"op": "set", "path": []string{"system", "host-name", "r1"}},
+			{"op": "rename", "path": []string{"system", "host-name"}},
+		},
+	}
+	w := do(t, http.MethodPost, "/", body, deviceVars(), h.BatchConfig)
+	assertStatus(t, w, http.StatusBadRequest)
+	if len(m.Received) != 0 {
+		t.Errorf("device received %d ops, want 0", len(m.Received))
+	}
+}
+
+func TestBatchConfig_Empty(t *testing.T) {
+	_, _, client := newMockVyOS(t)
+	h := newHandler(client)
+	w := do(t, http.MethodPost, "/", map[string]interface{}{"operations": []interface{}{}}, deviceVars(), h.BatchConfig)
+	assertStatus(t, w, http.StatusBadRequest)
+}
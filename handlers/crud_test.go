@@ -22,11 +22,12 @@ import (
 //   go test -v -run 'TestCRUD_VRFs/Update' ./handlers
 //
 // If a step fails, the mock may be out of sync with the number of VyOS API calls
-// the handler makes (e.g. CreateVRF sends 2 calls when description is set).
+// the handler makes. Each mutation sends its ops as one batch (one call), and
+// replace-style updates read the current config first (e.g. UpdateAddressGroup).
 // Adjust the newMockVyOS response queue in that test accordingly.
 
 func TestCRUD_Networks(t *testing.T) {
-	// Queue: List(Get interfaces), Create(Set), Get(Get iface), Update(Delete+Set), Delete(Delete)
+	// Queue: List(Get interfaces), Create(batch), Get(Get iface), Update(Get iface + batch), Delete(batch)
 	listData := map[string]interface{}{
 		"ethernet": map[string]interface{}{
 			"eth0": map[string]interface{}{"address": "192.168.1.1/24", "description": "LAN"},
@@ -35,10 +36,10 @@ func TestCRUD_Networks(t *testing.T) {
 	getCfg := map[string]interface{}{"address": "192.168.1.1/24", "description": "LAN"}
 	_, _, client := newMockVyOS(t,
 		dataResp(listData),   // ListNetworks
-		successResp(),        // CreateNetwork (Set address)
+		successResp(),        // CreateNetwork (batch: Set address)
 		dataResp(getCfg),     // GetNetwork
-		successResp(),        // UpdateNetwork (Delete address)
-		successResp(),        // UpdateNetwork (Set new address)
+		dataResp(getCfg),     // UpdateNetwork (Get current)
+		successResp(),        // UpdateNetwork (batch: Delete address + Set new address)
 		successResp(),        // DeleteNetwork
 	)
 	h := newHandler(client)
@@ -110,11 +111,9 @@ func TestCRUD_VRFs(t *testing.T) {
 	updatedCfg := map[string]interface{}{"table": "101", "description": "updated-desc"}
 	_, _, client := newMockVyOS(t,
 		dataResp(listData),   // ListVRFs
-		successResp(),        // CreateVRF (Set table)
-		successResp(),        // CreateVRF (Set description)
+		successResp(),        // CreateVRF (batch: Set table + description)
 		dataResp(getCfg),     // GetVRF
-		successResp(),        // UpdateVRF (Set table)
-		successResp(),        // UpdateVRF (Set description)
+		successResp(),        // UpdateVRF (batch: Set table + description)
 		dataResp(updatedCfg), // UpdateVRF (Get for response)
 		successResp(),        // DeleteVRF
 	)
@@ -182,10 +181,10 @@ func TestCRUD_VLANs(t *testing.T) {
 	getVif := map[string]interface{}{"address": "10.100.0.1/24", "description": "vlan100"}
 	_, _, client := newMockVyOS(t,
 		dataResp(listData),   // ListVLANs
-		successResp(),        // CreateVLAN (Set vif with address)
+		successResp(),        // CreateVLAN (batch: Set vif with address)
 		dataResp(getVif),     // GetVLAN
-		successResp(),        // UpdateVLAN (Delete address)
-		successResp(),        // UpdateVLAN (Set new address)
+		dataResp(getVif),     // UpdateVLAN (Get current)
+		successResp(),        // UpdateVLAN (batch: Delete address + Set new address + description)
 		successResp(),        // DeleteVLAN
 	)
 	h := newHandler(client)
@@ -257,11 +256,9 @@ func TestCRUD_FirewallPolicies(t *testing.T) {
 		successResp(),          // ListPolicies base chain: output (no config)
 		successResp(),          // CreatePolicy
 		dataResp(getPolicy),     // GetPolicy
-		successResp(),          // UpdatePolicy (Set default-action)
-		successResp(),          // UpdatePolicy (Set description)
+		successResp(),          // UpdatePolicy (batch: Set default-action + description)
 		dataResp(updatedPolicy), // UpdatePolicy (Get for response)
-		successResp(),          // AddRule (Set action)
-		successResp(),          // AddRule (Set source address)
+		successResp(),          // AddRule (batch: Set action + source address)
 		successResp(),          // DeleteRule
 		successResp(),          // DeletePolicy
 	)
@@ -348,12 +345,10 @@ func TestCRUD_AddressGroups(t *testing.T) {
 	}
 	_, _, client := newMockVyOS(t,
 		dataResp(listData),   // ListAddressGroups
-		successResp(),        // CreateAddressGroup (Set address 1)
-		successResp(),        // CreateAddressGroup (Set address 2)
+		successResp(),        // CreateAddressGroup (batch: Set address 1 + 2)
 		dataResp(getCfg),     // GetAddressGroup
-		successResp(),        // UpdateAddressGroup (Delete address)
-		successResp(),        // UpdateAddressGroup (Set addr 1)
-		successResp(),        // UpdateAddressGroup (Set addr 2)
+		dataResp(getCfg),     // UpdateAddressGroup (Get current)
+		successResp(),        // UpdateAddressGroup (batch: Delete address + Set addr 1 + 2)
 		successResp(),        // DeleteAddressGroup
 	)
 	h := newHandler(client)
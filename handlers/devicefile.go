@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/valueiron/vyos-api/vyos"
+)
+
+// DeviceFile is the JSON devices file named by VYOS_DEVICES_FILE.
+//
+//	{
+//	  "devices": [
+//	    {
+//	      "name": "router1",
+//	      "url": "https://192.168.1.1:443",
+//	      "key_file": "keys/router1.key",
+//	      "tls": { "fingerprint": "AB:CD:..." },
+//	      "timeout": "10s",
+//	      "tags": ["core", "dc1"],
+//	      "description": "Core router, rack 4"
+//	    }
+//	  ]
+//	}
+type DeviceFile struct {
+	Devices []DeviceEntry `json:"devices"`
+}
+
+// DeviceEntry is one device in a DeviceFile.
+type DeviceEntry struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// KeyFile holds the API key. Relative paths are resolved against the
+	// devices file's directory. Key is an inline alternative for
+	// development; exactly one of the two must be set.
+	KeyFile string `json:"key_file,omitempty"`
+	Key     string `json:"key,omitempty"`
+
+	TLS DeviceTLS `json:"tls,omitempty"`
+	// Timeout bounds each request to the device, as a Go duration
+	// ("10s"). Empty means no limit.
+	Timeout     string   `json:"timeout,omitempty"`
+	AutoSave    bool     `json:"auto_save,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+// DeviceTLS is the "tls" object of a DeviceEntry; see vyos.TLSConfig. File
+// paths are resolved like DeviceEntry.KeyFile; CA, Cert and Key are inline
+// PEM.
+type DeviceTLS struct {
+	CAFile      string `json:"ca_file,omitempty"`
+	CA          string `json:"ca,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	CertFile    string `json:"cert_file,omitempty"`
+	KeyFile     string `json:"key_file,omitempty"`
+	Cert        string `json:"cert,omitempty"`
+	Key         string `json:"key,omitempty"`
+	ServerName  string `json:"server_name,omitempty"`
+	Insecure    bool   `json:"insecure,omitempty"`
+}
+
+// LoadDeviceFile reads the devices file at path and builds a device map for
+// Registry.Replace. Any invalid entry fails the whole load, so a bad edit
+// never partially applies.
+func LoadDeviceFile(path string) (map[string]*Device, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f DeviceFile
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	devices := make(map[string]*Device, len(f.Devices))
+	for i, e := range f.Devices {
+		d, err := e.build(dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: devices[%d]: %w", path, i, err)
+		}
+		if _, dup := devices[d.ID]; dup {
+			return nil, fmt.Errorf("%s: devices[%d]: duplicate name %q", path, i, d.ID)
+		}
+		devices[d.ID] = d
+	}
+	return devices, nil
+}
+
+// Retry and circuit breaker policies of device clients; see SetClientPolicies.
+var (
+	retryPolicy   vyos.RetryPolicy
+	breakerPolicy vyos.BreakerPolicy
+)
+
+// SetClientPolicies sets the retry and circuit breaker policies of device
+// clients built afterwards by NewDeviceClient. Until it is called, requests
+// are not retried and there is no breaker.
+func SetClientPolicies(retry vyos.RetryPolicy, breaker vyos.BreakerPolicy) {
+	retryPolicy, breakerPolicy = retry, breaker
+}
+
+// NewDeviceClient returns a client for the device with the given name,
+// reporting to the upstream metrics and using the policies set by
+// SetClientPolicies.
+func NewDeviceClient(name, url, key string) *vyos.Client {
+	return vyos.NewClient(nil).WithName(name).WithURL(url).WithToken(key).
+		WithObserver(UpstreamObserver(name)).WithRetry(retryPolicy).WithBreaker(breakerPolicy)
+}
+
+// build validates e and constructs its Device, resolving relative paths
+// against dir.
+func (e DeviceEntry) build(dir string) (*Device, error) {
+	if e.Name == "" || e.URL == "" {
+		return nil, errors.New("name and url are required")
+	}
+	if (e.Key == "") == (e.KeyFile == "") {
+		return nil, fmt.Errorf("%s: exactly one of key and key_file is required", e.Name)
+	}
+
+	key := e.Key
+	if e.KeyFile != "" {
+		b, err := os.ReadFile(resolve(dir, e.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("%s: read key file: %w", e.Name, err)
+		}
+		key = strings.TrimSpace(string(b))
+	}
+
+	var timeout time.Duration
+	if e.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(e.Timeout); err != nil || timeout < 0 {
+			return nil, fmt.Errorf("%s: invalid timeout %q", e.Name, e.Timeout)
+		}
+	}
+
+	tlsCfg := vyos.TLSConfig{
+		CAFile:      resolve(dir, e.TLS.CAFile),
+		Fingerprint: e.TLS.Fingerprint,
+		CertFile:    resolve(dir, e.TLS.CertFile),
+		KeyFile:     resolve(dir, e.TLS.KeyFile),
+		CA:          e.TLS.CA,
+		Cert:        e.TLS.Cert,
+		Key:         e.TLS.Key,
+		ServerName:  e.TLS.ServerName,
+		Insecure:    e.TLS.Insecure,
+	}
+	client, err := NewDeviceClient(e.Name, e.URL, key).WithTimeout(timeout).WithTLS(tlsCfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", e.Name, err)
+	}
+
+	// The spec covers everything the client was built from, including the
+	// key itself, so rotating a key file counts as a change.
+	spec, _ := json.Marshal(struct {
+		Entry DeviceEntry
+		Key   string
+	}{e, key})
+
+	return &Device{
+		ID:          e.Name,
+		URL:         strings.TrimSuffix(e.URL, "/"),
+		Client:      client,
+		AutoSave:    e.AutoSave,
+		TLS:         tlsCfg,
+		Description: e.Description,
+		Tags:        e.Tags,
+		entry:       &e,
+		spec:        string(spec),
+	}, nil
+}
+
+// WriteDeviceFile writes devices to path in the DeviceFile format. Devices
+// not built from an entry (those from VYOS_HOSTS) are left out. The file is
+// replaced atomically and, since entries may hold inline keys, is readable
+// only by its owner.
+func WriteDeviceFile(path string, devices []*Device) error {
+	f := DeviceFile{Devices: []DeviceEntry{}}
+	for _, d := range devices {
+		if d.entry != nil {
+			f.Devices = append(f.Devices, *d.entry)
+		}
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // no-op after a successful rename
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close() //nolint:errcheck
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// resolve returns p relative to dir, leaving empty and absolute paths alone.
+func resolve(dir, p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(dir, p)
+}
@@ -0,0 +1,116 @@
+package handlers_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/valueiron/vyos-api/handlers"
+)
+
+// writeDevicesFile writes a devices file and a key file for router1 into a
+// temporary directory and returns the devices file path.
+func writeDevicesFile(t *testing.T, body string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "router1.key"), []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "devices.json")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDeviceFile(t *testing.T) {
+	path := writeDevicesFile(t, `{"devices":[
+		{"name":"router1","url":"https://192.168.1.1:443/","key_file":"router1.key",
+		 "tls":{"insecure":true},"timeout":"5s","auto_save":true,
+		 "tags":["core"],"description":"Core router"},
+		{"name":"router2","url":"https://10.0.0.1","key":"inline"}
+	]}`)
+
+	devices, err := handlers.LoadDeviceFile(path)
+	if err != nil {
+		t.Fatalf("LoadDeviceFile: %v", err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("got %d devices, want 2", len(devices))
+	}
+	d := devices["router1"]
+	if d == nil {
+		t.Fatal("router1 missing")
+	}
+	if d.URL != "https://192.168.1.1:443" {
+		t.Errorf("URL = %q, want trailing slash trimmed", d.URL)
+	}
+	if !d.AutoSave || !d.TLS.Insecure || d.Description != "Core router" || len(d.Tags) != 1 {
+		t.Errorf("router1 settings not applied: %+v", d)
+	}
+	if devices["router2"].TLS.Mode() != "verify" {
+		t.Errorf("router2 TLS mode = %q, want verify", devices["router2"].TLS.Mode())
+	}
+}
+
+func TestLoadDeviceFile_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"malformed":      `{"devices":[`,
+		"unknown field":  `{"devices":[{"name":"r","url":"https://r","key":"k","port":443}]}`,
+		"missing url":    `{"devices":[{"name":"r","key":"k"}]}`,
+		"no key":         `{"devices":[{"name":"r","url":"https://r"}]}`,
+		"both keys":      `{"devices":[{"name":"r","url":"https://r","key":"k","key_file":"router1.key"}]}`,
+		"missing key":    `{"devices":[{"name":"r","url":"https://r","key_file":"nope.key"}]}`,
+		"bad timeout":    `{"devices":[{"name":"r","url":"https://r","key":"k","timeout":"soon"}]}`,
+		"bad tls":        `{"devices":[{"name":"r","url":"https://r","key":"k","tls":{"insecure":true,"fingerprint":"00"}}]}`,
+		"duplicate name": `{"devices":[{"name":"r","url":"https://a","key":"k"},{"name":"r","url":"https://b","key":"k"}]}`,
+	}
+	for name, body := range tests {
+		if _, err := handlers.LoadDeviceFile(writeDevicesFile(t, body)); err == nil {
+			t.Errorf("%s: LoadDeviceFile succeeded, want error", name)
+		}
+	}
+}
+
+func TestRegistryReplace_KeepsUnchangedDevices(t *testing.T) {
+	body := `{"devices":[
+		{"name":"router1","url":"https://a","key":"k"},
+		{"name":"router2","url":"https://b","key":"k"}
+	]}`
+	path := writeDevicesFile(t, body)
+	first, err := handlers.LoadDeviceFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := handlers.NewRegistry(first)
+
+	changed := strings.Replace(body, "https://b", "https://c", 1)
+	if err := os.WriteFile(path, []byte(changed), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	second, err := handlers.LoadDeviceFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.Replace(second)
+
+	if d, _ := reg.Get("router1"); d != first["router1"] {
+		t.Error("unchanged router1 was replaced")
+	}
+	if d, _ := reg.Get("router2"); d != second["router2"] || d.URL != "https://c" {
+		t.Error("changed router2 was not replaced")
+	}
+}
+
+func TestRegistryReplace_RemovesDevices(t *testing.T) {
+	reg := handlers.NewRegistry(map[string]*handlers.Device{"router1": {ID: "router1"}})
+	reg.Replace(map[string]*handlers.Device{"router2": {ID: "router2"}})
+
+	if _, ok := reg.Get("router1"); ok {
+		t.Error("router1 still registered")
+	}
+	if got := reg.List(); len(got) != 1 || got[0].ID != "router2" {
+		t.Errorf("List = %v, want [router2]", got)
+	}
+}
@@ -1,40 +1,201 @@
 package handlers
 
 import (
-	"context"
+	"encoding/json"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/logctx"
 )
 
 // DeviceInfo is the API representation of a registered VyOS device.
 type DeviceInfo struct {
-	ID      string `json:"id"`
-	URL     string `json:"url"`
-	Healthy bool   `json:"healthy"`
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	TLS string `json:"tls"` // verify, pinned or insecure
+
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+
+	DeviceHealth
 }
 
 // ListDevices handles GET /devices.
-// Returns all registered devices with a connectivity probe result.
+// Returns all registered devices, sorted by ID, with the health monitor's
+// latest result for each. It never contacts the devices.
 func (h *Handler) ListDevices(w http.ResponseWriter, r *http.Request) {
-	result := make([]DeviceInfo, 0, len(h.devices))
-	for _, d := range h.devices {
-		healthy := probe(r.Context(), d)
-		result = append(result, DeviceInfo{
-			ID:      d.ID,
-			URL:     d.URL,
-			Healthy: healthy,
-		})
+	devices := h.devices.List()
+	result := make([]DeviceInfo, 0, len(devices))
+	for _, d := range devices {
+		result = append(result, h.deviceInfo(d))
 	}
 	writeJSON(w, http.StatusOK, result)
 }
 
-// probe attempts a lightweight retrieve against the device to check connectivity.
-func probe(ctx context.Context, d *Device) bool {
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-	out, _, err := d.Client.Conf.Get(ctx, "system host-name", nil)
+func (h *Handler) deviceInfo(d *Device) DeviceInfo {
+	return DeviceInfo{
+		ID:  d.ID,
+		URL: d.URL,
+		TLS: d.TLS.Mode(),
+
+		Description: d.Description,
+		Tags:        d.Tags,
+
+		DeviceHealth: h.monitor.Health(d),
+	}
+}
+
+// CreateDevice handles POST /devices/{device_id}.
+// Enrols a new device described by a devices file entry (the name comes from
+// the path), with the API key and any TLS material inline. The device must answer a connectivity check before it is
+// registered. Returns 409 if the ID is already registered.
+func (h *Handler) CreateDevice(w http.ResponseWriter, r *http.Request) {
+	h.putDevice(w, r, false)
+}
+
+// UpdateDevice handles PUT /devices/{device_id}.
+// Registers the device, replacing any existing device with the same ID.
+// Requests already running against the old device finish against it.
+func (h *Handler) UpdateDevice(w http.ResponseWriter, r *http.Request) {
+	h.putDevice(w, r, true)
+}
+
+func (h *Handler) putDevice(w http.ResponseWriter, r *http.Request, replace bool) {
+	if !noDryRun(w, r) {
+		return
+	}
+	id := mux.Vars(r)["device_id"]
+	var e DeviceEntry
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&e); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if e.Name != "" && e.Name != id {
+		writeError(w, http.StatusBadRequest, "name must match the device_id in the path")
+		return
+	}
+	e.Name = id
+	// Paths would let a caller have the service read any file it can and
+	// send it to a URL of the caller's choosing, so they are left to the
+	// devices file.
+	if e.KeyFile != "" || e.TLS.CAFile != "" || e.TLS.CertFile != "" || e.TLS.KeyFile != "" {
+		writeError(w, http.StatusBadRequest, "key_file, tls.ca_file, tls.cert_file and tls.key_file are only accepted in the devices file; give key, tls.ca, tls.cert and tls.key inline")
+		return
+	}
+
+	d, err := e.build("")
 	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Check outside enrolMu: an unreachable device can take the full probe
+	// timeout, and other enrolments should not wait on it.
+	start := time.Now()
+	if err := checkDevice(r.Context(), d); err != nil {
+		status, msg := deviceError(err)
+		writeError(w, status, "connectivity check failed: "+msg)
+		return
+	}
+	// Seed the monitor with the check so the device reports healthy before
+	// its first background probe.
+	h.monitor.record(d, time.Since(start), nil)
+
+	h.enrolMu.Lock()
+	defer h.enrolMu.Unlock()
+	_, exists := h.devices.Get(id)
+	if exists && !replace {
+		writeError(w, http.StatusConflict, "device already registered: "+id)
+		return
+	}
+	if h.autoSaveAll || h.autoSaveIDs[id] {
+		d.AutoSave = true
+	}
+	if !h.persistDevices(w, func(next map[string]*Device) { next[id] = d }) {
+		return
+	}
+	if h.persist {
+		h.devices.Put(d)
+	} else {
+		// Not in the devices file, so keep it across reloads of the file.
+		h.devices.Override(id, d)
+	}
+	logctx.From(r.Context()).Info("device registered", "name", id, "url", d.URL, "tls", d.TLS.Mode(), "replaced", exists)
+
+	status := http.StatusCreated
+	if exists {
+		status = http.StatusOK
+	}
+	writeJSON(w, status, h.deviceInfo(d))
+}
+
+// DeleteDevice handles DELETE /devices/{device_id}.
+// Unregisters the device. Requests already running against it finish.
+func (h *Handler) DeleteDevice(w http.ResponseWriter, r *http.Request) {
+	if !noDryRun(w, r) {
+		return
+	}
+	id := mux.Vars(r)["device_id"]
+
+	h.enrolMu.Lock()
+	defer h.enrolMu.Unlock()
+	if _, ok := h.devices.Get(id); !ok {
+		writeError(w, http.StatusNotFound, "device not found: "+id)
+		return
+	}
+	if !h.persistDevices(w, func(next map[string]*Device) { delete(next, id) }) {
+		return
+	}
+	if h.persist {
+		h.devices.Delete(id)
+	} else {
+		h.devices.Override(id, nil)
+	}
+	logctx.From(r.Context()).Info("device unregistered", "name", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetAutoSave enables AutoSave on devices enrolled or replaced through the
+// API whose ID is in ids, or on all of them if ids holds "*", as
+// VYOS_AUTOSAVE does for the configured devices.
+func (h *Handler) SetAutoSave(ids []string) {
+	h.autoSaveIDs = map[string]bool{}
+	for _, id := range ids {
+		switch id = strings.TrimSpace(id); id {
+		case "":
+		case "*":
+			h.autoSaveAll = true
+		default:
+			h.autoSaveIDs[id] = true
+		}
+	}
+}
+
+// persistDevices writes the registry, with change applied, back to the
+// devices file when persistence is enabled. It runs before the registry is
+// updated so a failed write leaves both unchanged. On failure it writes a 500
+// and returns false. The caller must hold enrolMu.
+func (h *Handler) persistDevices(w http.ResponseWriter, change func(map[string]*Device)) bool {
+	if !h.persist {
+		return true
+	}
+	next := make(map[string]*Device)
+	for _, d := range h.devices.List() {
+		next[d.ID] = d
+	}
+	change(next)
+	list := make([]*Device, 0, len(next))
+	for _, d := range next {
+		list = append(list, d)
+	}
+	sortDevices(list)
+	if err := WriteDeviceFile(h.devicesFile, list); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to persist devices: "+err.Error())
 		return false
 	}
-	return out.Success
+	return true
 }
@@ -1,8 +1,10 @@
 package handlers_test
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 
 	"github.com/valueiron/vyos-api/handlers"
@@ -25,6 +27,7 @@ func TestListDevices_Empty(t *testing.T) {
 func TestListDevices_Healthy(t *testing.T) {
 	_, _, client := newMockVyOS(t, successResp())
 	h := newHandler(client)
+	h.Monitor().Check(context.Background())
 
 	r := httptest.NewRequest(http.MethodGet, "/devices", nil)
 	w := httptest.NewRecorder()
@@ -42,12 +45,16 @@ func TestListDevices_Healthy(t *testing.T) {
 	if result[0]["healthy"] != true {
 		t.Errorf("healthy = %v, want true", result[0]["healthy"])
 	}
+	if result[0]["last_seen"] == nil {
+		t.Error("last_seen not set after a successful probe")
+	}
 }
 
 func TestListDevices_Unhealthy(t *testing.T) {
 	_, srv, client := newMockVyOS(t)
 	srv.Close()
 	h := newHandler(client)
+	h.Monitor().Check(context.Background())
 
 	r := httptest.NewRequest(http.MethodGet, "/devices", nil)
 	w := httptest.NewRecorder()
@@ -62,4 +69,189 @@ func TestListDevices_Unhealthy(t *testing.T) {
 	if result[0]["healthy"] != false {
 		t.Errorf("healthy = %v, want false", result[0]["healthy"])
 	}
+	if result[0]["consecutive_failures"] != float64(1) || result[0]["last_error"] == nil {
+		t.Errorf("failure not recorded: %v", result[0])
+	}
+}
+
+func TestListDevices_NotYetProbed(t *testing.T) {
+	m, _, client := newMockVyOS(t)
+	h := newHandler(client)
+
+	w := do(t, http.MethodGet, "/devices", nil, nil, h.ListDevices)
+	assertStatus(t, w, http.StatusOK)
+	var result []map[string]interface{}
+	decodeJSON(t, w, &result)
+	if result[0]["healthy"] != false || result[0]["last_checked"] != nil {
+		t.Errorf("unprobed device = %v, want unhealthy and never checked", result[0])
+	}
+	if len(m.Received) != 0 {
+		t.Errorf("ListDevices contacted the device %d times", len(m.Received))
+	}
+}
+
+func TestCreateDevice(t *testing.T) {
+	_, srv, _ := newMockVyOS(t, dataResp("vyos"))
+	h := handlers.New(nil)
+
+	vars := map[string]string{"device_id": "router2"}
+	body := map[string]interface{}{"url": srv.URL, "key": "k", "tags": []string{"edge"}}
+	w := do(t, http.MethodPost, "/devices/router2", body, vars, h.CreateDevice)
+	assertStatus(t, w, http.StatusCreated)
+
+	var info map[string]interface{}
+	decodeJSON(t, w, &info)
+	if info["id"] != "router2" || info["healthy"] != true {
+		t.Errorf("response = %v", info)
+	}
+	if _, ok := h.Devices().Get("router2"); !ok {
+		t.Error("router2 not registered")
+	}
+}
+
+func TestCreateDevice_AutoSave(t *testing.T) {
+	_, srv, _ := newMockVyOS(t)
+	h := handlers.New(nil)
+	h.SetAutoSave([]string{"router2", " router3"})
+
+	for id, want := range map[string]bool{"router2": true, "router3": true, "router4": false} {
+		body := map[string]interface{}{"url": srv.URL, "key": "k"}
+		w := do(t, http.MethodPost, "/devices/"+id, body, map[string]string{"device_id": id}, h.CreateDevice)
+		assertStatus(t, w, http.StatusCreated)
+		if d, _ := h.Devices().Get(id); d.AutoSave != want {
+			t.Errorf("%s: AutoSave = %v, want %v", id, d.AutoSave, want)
+		}
+	}
+}
+
+func TestDevices_SurviveReload(t *testing.T) {
+	_, srv, client := newMockVyOS(t)
+	h := handlers.New(map[string]*handlers.Device{
+		"router1": {ID: "router1", Client: client},
+		"router3": {ID: "router3", Client: client},
+	})
+
+	body := map[string]interface{}{"url": srv.URL, "key": "k"}
+	w := do(t, http.MethodPost, "/devices/router2", body, map[string]string{"device_id": "router2"}, h.CreateDevice)
+	assertStatus(t, w, http.StatusCreated)
+	w = do(t, http.MethodDelete, "/devices/router3", nil, map[string]string{"device_id": "router3"}, h.DeleteDevice)
+	assertStatus(t, w, http.StatusNoContent)
+
+	// Without persistence the devices file still lists router1 and router3.
+	h.Devices().Replace(map[string]*handlers.Device{
+		"router1": {ID: "router1", Client: client},
+		"router3": {ID: "router3", Client: client},
+	})
+	var ids []string
+	for _, d := range h.Devices().List() {
+		ids = append(ids, d.ID)
+	}
+	if len(ids) != 2 || ids[0] != "router1" || ids[1] != "router2" {
+		t.Errorf("devices after reload = %v, want [router1 router2]", ids)
+	}
+}
+
+func TestCreateDevice_Conflict(t *testing.T) {
+	_, srv, client := newMockVyOS(t)
+	h := newHandler(client)
+
+	body := map[string]interface{}{"url": srv.URL, "key": "k"}
+	w := do(t, http.MethodPost, "/devices/router1", body, deviceVars(), h.CreateDevice)
+	assertStatus(t, w, http.StatusConflict)
+}
+
+func TestCreateDevice_Unreachable(t *testing.T) {
+	_, srv, _ := newMockVyOS(t)
+	srv.Close()
+	h := handlers.New(nil)
+
+	vars := map[string]string{"device_id": "router2"}
+	body := map[string]interface{}{"url": srv.URL, "key": "k"}
+	w := do(t, http.MethodPost, "/devices/router2", body, vars, h.CreateDevice)
+	assertStatus(t, w, http.StatusBadGateway)
+	if _, ok := h.Devices().Get("router2"); ok {
+		t.Error("unreachable device was registered")
+	}
+}
+
+func TestCreateDevice_HostNameUnset(t *testing.T) {
+	_, srv, _ := newMockVyOS(t, failResp("Configuration under specified path is empty"))
+	h := handlers.New(nil)
+
+	vars := map[string]string{"device_id": "router2"}
+	body := map[string]interface{}{"url": srv.URL, "key": "k"}
+	w := do(t, http.MethodPost, "/devices/router2", body, vars, h.CreateDevice)
+	assertStatus(t, w, http.StatusCreated)
+}
+
+func TestCreateDevice_Invalid(t *testing.T) {
+	h := handlers.New(nil)
+	vars := map[string]string{"device_id": "router2"}
+	tests := map[string]map[string]interface{}{
+		"no key":         {"url": "https://r"},
+		"no url":         {"key": "k"},
+		"name mismatch":  {"name": "router3", "url": "https://r", "key": "k"},
+		"unknown field":  {"url": "https://r", "key": "k", "port": 443},
+		"bad tls config": {"url": "https://r", "key": "k", "tls": map[string]interface{}{"cert": "c"}},
+		"key file":       {"url": "https://r", "key_file": "/etc/vyos-api/keys/router1.key"},
+		"tls ca file":    {"url": "https://r", "key": "k", "tls": map[string]interface{}{"ca_file": "/etc/ssl/ca.pem"}},
+		"tls cert file":  {"url": "https://r", "key": "k", "tls": map[string]interface{}{"cert_file": "c.pem", "key_file": "../k.pem"}},
+	}
+	for name, body := range tests {
+		w := do(t, http.MethodPost, "/devices/router2", body, vars, h.CreateDevice)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, w.Code)
+		}
+	}
+}
+
+func TestUpdateDevice_Replaces(t *testing.T) {
+	_, srv, client := newMockVyOS(t)
+	h := newHandler(client)
+
+	body := map[string]interface{}{"url": srv.URL, "key": "k", "description": "replaced"}
+	w := do(t, http.MethodPut, "/devices/router1", body, deviceVars(), h.UpdateDevice)
+	assertStatus(t, w, http.StatusOK)
+
+	d, _ := h.Devices().Get("router1")
+	if d.Description != "replaced" {
+		t.Errorf("description = %q, want replaced", d.Description)
+	}
+}
+
+func TestDeleteDevice(t *testing.T) {
+	_, _, client := newMockVyOS(t)
+	h := newHandler(client)
+
+	w := do(t, http.MethodDelete, "/devices/router1", nil, deviceVars(), h.DeleteDevice)
+	assertStatus(t, w, http.StatusNoContent)
+	if _, ok := h.Devices().Get("router1"); ok {
+		t.Error("router1 still registered")
+	}
+
+	w = do(t, http.MethodDelete, "/devices/router1", nil, deviceVars(), h.DeleteDevice)
+	assertStatus(t, w, http.StatusNotFound)
+}
+
+func TestDevicePersistence(t *testing.T) {
+	_, srv, _ := newMockVyOS(t)
+	path := filepath.Join(t.TempDir(), "devices.json")
+	h := handlers.New(nil)
+	h.SetDevicesFile(path, true)
+
+	for _, id := range []string{"router1", "router2"} {
+		body := map[string]interface{}{"url": srv.URL, "key": "k"}
+		w := do(t, http.MethodPost, "/devices/"+id, body, map[string]string{"device_id": id}, h.CreateDevice)
+		assertStatus(t, w, http.StatusCreated)
+	}
+	w := do(t, http.MethodDelete, "/devices/router1", nil, deviceVars(), h.DeleteDevice)
+	assertStatus(t, w, http.StatusNoContent)
+
+	devices, err := handlers.LoadDeviceFile(path)
+	if err != nil {
+		t.Fatalf("LoadDeviceFile: %v", err)
+	}
+	if len(devices) != 1 || devices["router2"] == nil {
+		t.Errorf("persisted devices = %v, want only router2", devices)
+	}
 }
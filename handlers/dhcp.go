@@ -1,9 +1,8 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 	"strings"
 
@@ -48,33 +47,33 @@ type UpdateDHCPServerRequest struct {
 	Lease         string   `json:"lease,omitempty"`
 }
 
-func dhcpBasePath(name string) string {
-	return fmt.Sprintf("service dhcp-server shared-network-name %s", name)
+func dhcpBasePath(name string) []string {
+	return []string{"service", "dhcp-server", "shared-network-name", name}
 }
 
-func dhcpSubnetPath(name, subnet string) string {
-	return fmt.Sprintf("%s subnet %s", dhcpBasePath(name), subnet)
+func dhcpSubnetPath(name, subnet string) []string {
+	return subPath(dhcpBasePath(name), "subnet", subnet)
 }
 
-// setDHCPSubnetFields applies optional DHCP subnet fields after the subnet node exists.
-func setDHCPSubnetFields(ctx context.Context, c *vyos.Client, subnetPath, defaultRouter string, dnsServers []string, rangeStart, rangeStop, lease string) {
+// addDHCPSubnetFields queues sets for the optional DHCP subnet fields.
+func addDHCPSubnetFields(b *vyos.Batch, subnetPath []string, defaultRouter string, dnsServers []string, rangeStart, rangeStop, lease string) {
 	if defaultRouter != "" {
-		c.Conf.Set(ctx, fmt.Sprintf("%s default-router %s", subnetPath, defaultRouter)) //nolint:errcheck
+		b.Set(subPath(subnetPath, "default-router", defaultRouter))
 	}
 	for _, ns := range dnsServers {
 		ns = strings.TrimSpace(ns)
 		if ns != "" {
-			c.Conf.Set(ctx, fmt.Sprintf("%s name-server %s", subnetPath, ns)) //nolint:errcheck
+			b.Set(subPath(subnetPath, "name-server", ns))
 		}
 	}
 	if rangeStart != "" {
-		c.Conf.Set(ctx, fmt.Sprintf("%s range 0 start %s", subnetPath, rangeStart)) //nolint:errcheck
+		b.Set(subPath(subnetPath, "range", "0", "start", rangeStart))
 	}
 	if rangeStop != "" {
-		c.Conf.Set(ctx, fmt.Sprintf("%s range 0 stop %s", subnetPath, rangeStop)) //nolint:errcheck
+		b.Set(subPath(subnetPath, "range", "0", "stop", rangeStop))
 	}
 	if lease != "" {
-		c.Conf.Set(ctx, fmt.Sprintf("%s lease %s", subnetPath, lease)) //nolint:errcheck
+		b.Set(subPath(subnetPath, "lease", lease))
 	}
 }
 
@@ -85,31 +84,24 @@ func (h *Handler) ListDHCPServers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	out, _, err := c.Conf.Get(r.Context(), "service dhcp-server shared-network-name", nil)
-	if err != nil {
-		if strings.Contains(err.Error(), "unexpected status 400") {
-			writeJSON(w, http.StatusOK, []DHCPServerInfo{})
-			return
-		}
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	out, err := c.Conf.GetPath(r.Context(), []string{"service", "dhcp-server", "shared-network-name"})
+	// A missing path means no DHCP servers are configured yet.
+	if err != nil && !errors.Is(err, vyos.ErrPathNotFound) {
+		writeDeviceError(w, err)
 		return
 	}
 
 	result := []DHCPServerInfo{}
-	if out.Success {
-		rawMap, _ := out.Data.(map[string]interface{})
-		netMap := rawMap
-		if inner, ok := rawMap["shared-network-name"].(map[string]interface{}); ok {
-			netMap = inner
-		}
-		for name, nData := range netMap {
-			result = append(result, parseDHCPServerData(name, nData))
-		}
-	} else if !strings.Contains(errMsg(out.Error), "empty") {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
-		return
+	rawMap, _ := out.Data.(map[string]interface{})
+	netMap := rawMap
+	if inner, ok := rawMap["shared-network-name"].(map[string]interface{}); ok {
+		netMap = inner
+	}
+	for name, nData := range netMap {
+		result = append(result, parseDHCPServerData(name, nData))
 	}
 
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, result)
 }
 
@@ -125,26 +117,33 @@ func (h *Handler) CreateDHCPServer(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid JSON body")
 		return
 	}
-	if req.Name == "" || req.Subnet == "" {
-		writeError(w, http.StatusBadRequest, "name and subnet are required")
+	if err := req.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	subnetPath := dhcpSubnetPath(req.Name, req.Subnet)
-
-	out, _, err := c.Conf.Set(r.Context(), subnetPath)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	b := c.Conf.Batch()
+	created := req.build(b)
+	if !h.commit(w, r, b) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
-		return
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (req CreateDHCPServerRequest) validate() error {
+	if req.Name == "" || req.Subnet == "" {
+		return errors.New("name and subnet are required")
 	}
+	return nil
+}
 
-	setDHCPSubnetFields(r.Context(), c, subnetPath, req.DefaultRouter, req.DNSServers, req.RangeStart, req.RangeStop, req.Lease)
+func (req CreateDHCPServerRequest) build(b *vyos.Batch) interface{} {
+	subnetPath := dhcpSubnetPath(req.Name, req.Subnet)
 
-	writeJSON(w, http.StatusCreated, DHCPServerInfo{
+	b.Set(subnetPath)
+	addDHCPSubnetFields(b, subnetPath, req.DefaultRouter, req.DNSServers, req.RangeStart, req.RangeStop, req.Lease)
+	return DHCPServerInfo{
 		Name: req.Name,
 		Subnets: []DHCPSubnetInfo{{
 			Subnet:        req.Subnet,
@@ -154,7 +153,7 @@ func (h *Handler) CreateDHCPServer(w http.ResponseWriter, r *http.Request) {
 			RangeStop:     req.RangeStop,
 			Lease:         req.Lease,
 		}},
-	})
+	}
 }
 
 // GetDHCPServer handles GET /devices/{device_id}/dhcp/servers/{name}.
@@ -165,16 +164,17 @@ func (h *Handler) GetDHCPServer(w http.ResponseWriter, r *http.Request) {
 	}
 
 	name := mux.Vars(r)["name"]
-	out, _, err := c.Conf.Get(r.Context(), dhcpBasePath(name), nil)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	out, err := c.Conf.GetPath(r.Context(), dhcpBasePath(name))
+	if errors.Is(err, vyos.ErrPathNotFound) {
+		writeError(w, http.StatusNotFound, "DHCP server not found")
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusNotFound, "DHCP server not found")
+	if err != nil {
+		writeDeviceError(w, err)
 		return
 	}
 
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, parseDHCPServerData(name, out.Data))
 }
 
@@ -197,25 +197,24 @@ func (h *Handler) UpdateDHCPServer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	subnetPath := dhcpSubnetPath(name, req.Subnet)
-
-	out, _, err := c.Conf.Set(r.Context(), subnetPath)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	if !ifMatch(w, r, c, dhcpBasePath(name)) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
+
+	subnetPath := dhcpSubnetPath(name, req.Subnet)
+
+	b := c.Conf.Batch().Set(subnetPath)
+	addDHCPSubnetFields(b, subnetPath, req.DefaultRouter, req.DNSServers, req.RangeStart, req.RangeStop, req.Lease)
+	if !h.commit(w, r, b) {
 		return
 	}
 
-	setDHCPSubnetFields(r.Context(), c, subnetPath, req.DefaultRouter, req.DNSServers, req.RangeStart, req.RangeStop, req.Lease)
-
-	getOut, _, err := c.Conf.Get(r.Context(), dhcpBasePath(name), nil)
+	getOut, err := c.Conf.GetPath(r.Context(), dhcpBasePath(name))
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+		writeDeviceError(w, err)
 		return
 	}
+	setETag(w, getOut.Data)
 	writeJSON(w, http.StatusOK, parseDHCPServerData(name, getOut.Data))
 }
 
@@ -227,13 +226,10 @@ func (h *Handler) DeleteDHCPServer(w http.ResponseWriter, r *http.Request) {
 	}
 
 	name := mux.Vars(r)["name"]
-	out, _, err := c.Conf.Delete(r.Context(), dhcpBasePath(name))
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	if !ifMatch(w, r, c, dhcpBasePath(name)) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
+	if !h.commit(w, r, c.Conf.Batch().Delete(dhcpBasePath(name))) {
 		return
 	}
 
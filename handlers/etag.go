@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/valueiron/vyos-api/vyos"
+)
+
+// etag returns a strong entity tag for config data as returned by GetPath.
+// encoding/json sorts map keys, so the tag depends only on the config and not
+// on the order the device listed it in.
+func etag(data interface{}) string {
+	b, _ := json.Marshal(data) // decoded JSON always re-encodes
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// setETag sets the ETag header of a response built from data.
+func setETag(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("ETag", etag(data))
+}
+
+// ifMatch evaluates the request's If-Match header against the config at path,
+// the subtree whose ETag the caller was given. Without the header it returns
+// true without contacting the device. Otherwise it re-reads path, and if the
+// subtree is gone or its tag matches none of those listed it writes a 412,
+// with the current ETag if there is one, and returns false. Mutations run
+// behind SerializeWrites, so nothing else writes through this API between
+// the check and the commit.
+func ifMatch(w http.ResponseWriter, r *http.Request, c *vyos.Client, path []string) bool {
+	if len(r.Header.Values("If-Match")) == 0 {
+		return true
+	}
+	_, ok := readIfMatch(w, r, c, path)
+	return ok
+}
+
+// readIfMatch is ifMatch for handlers that read path before changing it
+// anyway: it always reads it, once, and returns the config found there, nil
+// if there is none.
+func readIfMatch(w http.ResponseWriter, r *http.Request, c *vyos.Client, path []string) (interface{}, bool) {
+	header := strings.Join(r.Header.Values("If-Match"), ",")
+	out, err := c.Conf.GetPath(r.Context(), path)
+	if errors.Is(err, vyos.ErrPathNotFound) {
+		if header != "" {
+			writeError(w, http.StatusPreconditionFailed, "precondition failed: resource no longer exists on device")
+			return nil, false
+		}
+		return nil, true
+	}
+	if err != nil {
+		writeDeviceError(w, err)
+		return nil, false
+	}
+	if header == "" {
+		return out.Data, true
+	}
+	current := etag(out.Data)
+	if matchETag(header, current) {
+		return out.Data, true
+	}
+	w.Header().Set("ETag", current)
+	writeError(w, http.StatusPreconditionFailed, "precondition failed: configuration changed on device")
+	return nil, false
+}
+
+// matchETag reports whether an If-Match value lists tag or is "*". Comparison
+// is strong, so weak (W/) tags never match.
+func matchETag(header, tag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		if t = strings.TrimSpace(t); t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
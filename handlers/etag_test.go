@@ -0,0 +1,119 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// doIfMatch is like do but sends an If-Match header.
+func doIfMatch(t *testing.T, method, ifMatch string, body interface{}, vars map[string]string, fn http.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			t.Fatalf("marshal body: %v", err)
+		}
+	}
+	r := httptest.NewRequest(method, "/", bytes.NewReader(b))
+	r.Header.Set("If-Match", ifMatch)
+	r = mux.SetURLVars(r, vars)
+	w := httptest.NewRecorder()
+	fn(w, r)
+	return w
+}
+
+// vrfETag returns the ETag GetVRF reports for data.
+func vrfETag(t *testing.T, data interface{}) string {
+	t.Helper()
+	_, _, client := newMockVyOS(t, dataResp(data))
+	w := do(t, http.MethodGet, "/", nil, deviceVars("vrf", "MGMT"), newHandler(client).GetVRF)
+	assertStatus(t, w, http.StatusOK)
+	tag := w.Header().Get("ETag")
+	if tag == "" {
+		t.Fatal("GET response has no ETag")
+	}
+	return tag
+}
+
+func TestETag_TracksConfig(t *testing.T) {
+	a := vrfETag(t, map[string]interface{}{"table": "100", "description": "mgmt"})
+	b := vrfETag(t, map[string]interface{}{"description": "mgmt", "table": "100"})
+	c := vrfETag(t, map[string]interface{}{"table": "101", "description": "mgmt"})
+	if a != b {
+		t.Errorf("same config gave ETags %s and %s", a, b)
+	}
+	if a == c {
+		t.Errorf("changed config kept ETag %s", a)
+	}
+}
+
+func TestIfMatch_Matches(t *testing.T) {
+	cur := map[string]interface{}{"table": "100"}
+	tag := vrfETag(t, cur)
+
+	m, _, client := newMockVyOS(t,
+		dataResp(cur), // If-Match re-read
+		successResp(), // commit
+		dataResp(map[string]interface{}{"table": "100", "description": "new"}),
+	)
+	h := newHandler(client)
+	w := doIfMatch(t, http.MethodPut, tag, map[string]string{"description": "new"}, deviceVars("vrf", "MGMT"), h.UpdateVRF)
+	assertStatus(t, w, http.StatusOK)
+	if got := w.Header().Get("ETag"); got == "" || got == tag {
+		t.Errorf("ETag after update = %q, want a new tag", got)
+	}
+	if len(m.Received) < 2 || m.Received[1].Op != "set" {
+		t.Errorf("ops = %+v, want the re-read followed by the set", m.Received)
+	}
+}
+
+func TestIfMatch_Stale(t *testing.T) {
+	tag := vrfETag(t, map[string]interface{}{"table": "100"})
+
+	m, _, client := newMockVyOS(t, dataResp(map[string]interface{}{"table": "200"}))
+	h := newHandler(client)
+	w := doIfMatch(t, http.MethodDelete, tag, nil, deviceVars("vrf", "MGMT"), h.DeleteVRF)
+	assertStatus(t, w, http.StatusPreconditionFailed)
+	if got := w.Header().Get("ETag"); got == "" || got == tag {
+		t.Errorf("ETag = %q, want the current tag", got)
+	}
+	if len(m.Received) != 1 {
+		t.Errorf("device got %d ops, want only the re-read", len(m.Received))
+	}
+}
+
+func TestIfMatch_Gone(t *testing.T) {
+	m, _, client := newMockVyOS(t, failResp("Configuration under specified path is empty"))
+	h := newHandler(client)
+	w := doIfMatch(t, http.MethodDelete, "*", nil, deviceVars("prefix", "10.0.0.0", "mask", "8"), h.DeleteRoute)
+	assertStatus(t, w, http.StatusPreconditionFailed)
+	if len(m.Received) != 1 {
+		t.Errorf("device got %d ops, want only the re-read", len(m.Received))
+	}
+}
+
+func TestIfMatch_Wildcard(t *testing.T) {
+	m, _, client := newMockVyOS(t, dataResp(map[string]interface{}{"action": "accept"}), successResp())
+	h := newHandler(client)
+	w := doIfMatch(t, http.MethodPut, `W/"weak", *`, nil, deviceVars("policy", "WAN", "rule_id", "10"), h.DisableRule)
+	assertStatus(t, w, http.StatusOK)
+	if len(m.Received) != 2 || m.Received[1].Op != "set" {
+		t.Errorf("ops = %+v, want the re-read followed by the set", m.Received)
+	}
+}
+
+func TestIfMatch_Absent(t *testing.T) {
+	m, _, client := newMockVyOS(t, successResp())
+	h := newHandler(client)
+	w := do(t, http.MethodDelete, "/", nil, deviceVars("vrf", "MGMT"), h.DeleteVRF)
+	assertStatus(t, w, http.StatusNoContent)
+	if len(m.Received) != 1 || m.Received[0].Op != "delete" {
+		t.Errorf("ops = %+v, want just the delete", m.Received)
+	}
+}
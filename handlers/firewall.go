@@ -2,17 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/vyos"
 )
 
-// errMsg returns a string form of the VyOS API error field (which may be string or other).
-func errMsg(e interface{}) string { return fmt.Sprint(e) }
-
 // PolicyInfo is the API representation of a VyOS IPv4 firewall policy.
 type PolicyInfo struct {
 	Name          string              `json:"name"`
@@ -60,11 +57,31 @@ type AddRuleRequest struct {
 // Base chain path suffixes (firewall ipv4 <dir> filter).
 var baseChainPaths = []struct {
 	name string
-	path string
+	path []string
 }{
-	{"forward", "firewall ipv4 forward filter"},
-	{"input", "firewall ipv4 input filter"},
-	{"output", "firewall ipv4 output filter"},
+	{"forward", []string{"firewall", "ipv4", "forward", "filter"}},
+	{"input", []string{"firewall", "ipv4", "input", "filter"}},
+	{"output", []string{"firewall", "ipv4", "output", "filter"}},
+}
+
+func policyPath(name string) []string {
+	return []string{"firewall", "ipv4", "name", name}
+}
+
+// policyReadPath returns the path GetPolicy reads for name: the base chain
+// for forward, input and output, otherwise policyPath. If-Match checks read
+// the same path, so they compare against the ETag GetPolicy returned.
+func policyReadPath(name string) []string {
+	for _, bc := range baseChainPaths {
+		if bc.name == name {
+			return bc.path
+		}
+	}
+	return policyPath(name)
+}
+
+func rulePath(policy string, ruleID int) []string {
+	return subPath(policyPath(policy), "rule", strconv.Itoa(ruleID))
 }
 
 // ListPolicies handles GET /devices/{device_id}/firewall/policies.
@@ -78,31 +95,35 @@ func (h *Handler) ListPolicies(w http.ResponseWriter, r *http.Request) {
 	var result []PolicyInfo
 
 	// Named policies under firewall ipv4 name
-	out, _, err := c.Conf.Get(r.Context(), "firewall ipv4 name", nil)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	out, err := c.Conf.GetPath(r.Context(), []string{"firewall", "ipv4", "name"})
+	// A missing path means no named policies are configured yet.
+	if err != nil && !errors.Is(err, vyos.ErrPathNotFound) {
+		writeDeviceError(w, err)
 		return
 	}
-	if out.Success {
-		rawMap, _ := out.Data.(map[string]interface{})
-		policyMap := rawMap
-		if inner, ok := rawMap["name"].(map[string]interface{}); ok {
-			policyMap = inner
-		}
-		for name, data := range policyMap {
-			result = append(result, parsePolicyData(name, data))
-		}
-	} else if !strings.Contains(errMsg(out.Error), "empty") {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
-		return
+	rawMap, _ := out.Data.(map[string]interface{})
+	policyMap := rawMap
+	if inner, ok := rawMap["name"].(map[string]interface{}); ok {
+		policyMap = inner
+	}
+	for name, data := range policyMap {
+		result = append(result, parsePolicyData(name, data))
 	}
+	// The ETag covers every subtree the list was built from.
+	read := []interface{}{out.Data}
 
 	// Base chains (forward, input, output) — include if they have config
 	for _, bc := range baseChainPaths {
-		out2, _, err2 := c.Conf.Get(r.Context(), bc.path, nil)
-		if err2 != nil || !out2.Success {
+		out2, err2 := c.Conf.GetPath(r.Context(), bc.path)
+		if errors.Is(err2, vyos.ErrPathNotFound) {
+			read = append(read, nil)
 			continue
 		}
+		if err2 != nil {
+			writeDeviceError(w, err2)
+			return
+		}
+		read = append(read, out2.Data)
 		rawMap, _ := out2.Data.(map[string]interface{})
 		data := rawMap
 		if inner, ok := rawMap["filter"].(map[string]interface{}); ok {
@@ -113,6 +134,7 @@ func (h *Handler) ListPolicies(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	setETag(w, read)
 	writeJSON(w, http.StatusOK, result)
 }
 
@@ -142,32 +164,38 @@ func (h *Handler) CreatePolicy(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid JSON body")
 		return
 	}
-	if req.Name == "" || req.DefaultAction == "" {
-		writeError(w, http.StatusBadRequest, "name and default_action are required")
+	if err := req.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	path := fmt.Sprintf("firewall ipv4 name %s default-action %s", req.Name, req.DefaultAction)
-	out, _, err := c.Conf.Set(r.Context(), path)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	b := c.Conf.Batch()
+	created := req.build(b)
+	if !h.commit(w, r, b) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
-		return
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (req CreatePolicyRequest) validate() error {
+	if req.Name == "" || req.DefaultAction == "" {
+		return errors.New("name and default_action are required")
 	}
+	return nil
+}
 
+func (req CreatePolicyRequest) build(b *vyos.Batch) interface{} {
+	base := policyPath(req.Name)
+	b.Set(subPath(base, "default-action", req.DefaultAction))
 	if req.Description != "" {
-		descPath := fmt.Sprintf("firewall ipv4 name %s description %s", req.Name, req.Description)
-		c.Conf.Set(r.Context(), descPath) //nolint:errcheck
+		b.Set(subPath(base, "description", req.Description))
 	}
-
-	writeJSON(w, http.StatusCreated, PolicyInfo{
+	return PolicyInfo{
 		Name:          req.Name,
 		DefaultAction: req.DefaultAction,
 		Description:   req.Description,
-	})
+	}
 }
 
 // GetPolicy handles GET /devices/{device_id}/firewall/policies/{policy}.
@@ -180,40 +208,35 @@ func (h *Handler) GetPolicy(w http.ResponseWriter, r *http.Request) {
 
 	policy := mux.Vars(r)["policy"]
 
-	var path string
-	for _, bc := range baseChainPaths {
-		if bc.name == policy {
-			path = bc.path
-			break
-		}
-	}
-	if path == "" {
-		path = fmt.Sprintf("firewall ipv4 name %s", policy)
-	}
-
-	out, _, err := c.Conf.Get(r.Context(), path, nil)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	out, err := c.Conf.GetPath(r.Context(), policyReadPath(policy))
+	if errors.Is(err, vyos.ErrPathNotFound) {
+		writeError(w, http.StatusNotFound, "policy not found")
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusNotFound, "policy not found")
+	if err != nil {
+		writeDeviceError(w, err)
 		return
 	}
 
-	data := out.Data
-	if rawMap, ok := out.Data.(map[string]interface{}); ok {
+	setETag(w, out.Data)
+	writeJSON(w, http.StatusOK, parsePolicyData(policy, unwrapPolicy(policy, out.Data)))
+}
+
+// unwrapPolicy returns the policy's own config from data read at its
+// policyReadPath or policyPath, which some VyOS versions wrap in the last
+// path segment.
+func unwrapPolicy(policy string, data interface{}) interface{} {
+	if rawMap, ok := data.(map[string]interface{}); ok {
 		if inner, ok := rawMap["filter"].(map[string]interface{}); ok {
-			data = inner
+			return inner
 		} else if inner, ok := rawMap["name"].(map[string]interface{}); ok {
 			// single named policy get might return {"name": {"POLICY": {...}}} in some versions
 			if policyData, ok := inner[policy].(map[string]interface{}); ok {
-				data = policyData
+				return policyData
 			}
 		}
 	}
-
-	writeJSON(w, http.StatusOK, parsePolicyData(policy, data))
+	return data
 }
 
 // UpdatePolicy handles PUT /devices/{device_id}/firewall/policies/{policy}.
@@ -231,32 +254,31 @@ func (h *Handler) UpdatePolicy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.DefaultAction != "" {
-		path := fmt.Sprintf("firewall ipv4 name %s default-action %s", policy, req.DefaultAction)
-		out, _, err := c.Conf.Set(r.Context(), path)
-		if err != nil {
-			writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
-			return
-		}
-		if !out.Success {
-			writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
-			return
-		}
+	base := policyPath(policy)
+	if !ifMatch(w, r, c, policyReadPath(policy)) {
+		return
 	}
 
+	b := c.Conf.Batch()
+	if req.DefaultAction != "" {
+		b.Set(subPath(base, "default-action", req.DefaultAction))
+	}
 	if req.Description != "" {
-		descPath := fmt.Sprintf("firewall ipv4 name %s description %s", policy, req.Description)
-		c.Conf.Set(r.Context(), descPath) //nolint:errcheck
+		b.Set(subPath(base, "description", req.Description))
+	}
+	if !h.commit(w, r, b) {
+		return
 	}
 
 	// Return updated state.
-	out, _, err := c.Conf.Get(r.Context(), fmt.Sprintf("firewall ipv4 name %s", policy), nil)
+	out, err := c.Conf.GetPath(r.Context(), base)
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+		writeDeviceError(w, err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, parsePolicyData(policy, out.Data))
+	setETag(w, out.Data)
+	writeJSON(w, http.StatusOK, parsePolicyData(policy, unwrapPolicy(policy, out.Data)))
 }
 
 // DeletePolicy handles DELETE /devices/{device_id}/firewall/policies/{policy}.
@@ -267,14 +289,11 @@ func (h *Handler) DeletePolicy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	policy := mux.Vars(r)["policy"]
-
-	out, _, err := c.Conf.Delete(r.Context(), fmt.Sprintf("firewall ipv4 name %s", policy))
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	if !ifMatch(w, r, c, policyReadPath(policy)) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
+
+	if !h.commit(w, r, c.Conf.Batch().Delete(policyPath(policy))) {
 		return
 	}
 
@@ -295,46 +314,60 @@ func (h *Handler) AddRule(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid JSON body")
 		return
 	}
-	if req.RuleID == 0 || req.Action == "" {
-		writeError(w, http.StatusBadRequest, "rule_id and action are required")
+	add := addRule{policy: policy, AddRuleRequest: req}
+	if err := add.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// Set action.
-	path := fmt.Sprintf("firewall ipv4 name %s rule %d action %s", policy, req.RuleID, req.Action)
-	out, _, err := c.Conf.Set(r.Context(), path)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	b := c.Conf.Batch()
+	created := add.build(b)
+	if !h.commit(w, r, b) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
-		return
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// addRule is an AddRuleRequest for the policy named in the request path.
+type addRule struct {
+	policy string
+	AddRuleRequest
+}
+
+func (req addRule) validate() error {
+	if req.policy == "" {
+		return errors.New("policy is required")
 	}
+	if req.RuleID == 0 || req.Action == "" {
+		return errors.New("rule_id and action are required")
+	}
+	return nil
+}
+
+func (req addRule) build(b *vyos.Batch) interface{} {
+	base := rulePath(req.policy, req.RuleID)
+
+	b.Set(subPath(base, "action", req.Action))
 
 	if req.Source != "" {
-		srcPath := fmt.Sprintf("firewall ipv4 name %s rule %d source address %s", policy, req.RuleID, req.Source)
-		c.Conf.Set(r.Context(), srcPath) //nolint:errcheck
+		b.Set(subPath(base, "source", "address", req.Source))
 	} else if req.SourceGroup != "" {
-		srcPath := fmt.Sprintf("firewall ipv4 name %s rule %d source group address-group %s", policy, req.RuleID, req.SourceGroup)
-		c.Conf.Set(r.Context(), srcPath) //nolint:errcheck
+		b.Set(subPath(base, "source", "group", "address-group", req.SourceGroup))
 	}
 
 	if req.Destination != "" {
-		dstPath := fmt.Sprintf("firewall ipv4 name %s rule %d destination address %s", policy, req.RuleID, req.Destination)
-		c.Conf.Set(r.Context(), dstPath) //nolint:errcheck
+		b.Set(subPath(base, "destination", "address", req.Destination))
 	} else if req.DestinationGroup != "" {
-		dstPath := fmt.Sprintf("firewall ipv4 name %s rule %d destination group address-group %s", policy, req.RuleID, req.DestinationGroup)
-		c.Conf.Set(r.Context(), dstPath) //nolint:errcheck
+		b.Set(subPath(base, "destination", "group", "address-group", req.DestinationGroup))
 	}
 
 	if req.Description != "" {
-		descPath := fmt.Sprintf("firewall ipv4 name %s rule %d description %s", policy, req.RuleID, req.Description)
-		c.Conf.Set(r.Context(), descPath) //nolint:errcheck
+		b.Set(subPath(base, "description", req.Description))
 	}
 
-	writeJSON(w, http.StatusCreated, map[string]interface{}{
-		"policy":            policy,
+	return map[string]interface{}{
+		"policy":            req.policy,
 		"rule_id":           req.RuleID,
 		"action":            req.Action,
 		"source":            req.Source,
@@ -342,7 +375,7 @@ func (h *Handler) AddRule(w http.ResponseWriter, r *http.Request) {
 		"destination":       req.Destination,
 		"destination_group": req.DestinationGroup,
 		"description":       req.Description,
-	})
+	}
 }
 
 // DeleteRule handles DELETE /devices/{device_id}/firewall/policies/{policy}/rules/{rule_id}.
@@ -360,15 +393,13 @@ func (h *Handler) DeleteRule(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "rule_id must be an integer")
 		return
 	}
-
-	path := fmt.Sprintf("firewall ipv4 name %s rule %d", policy, ruleID)
-	out, _, err := c.Conf.Delete(r.Context(), path)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	// Rules are part of the policy's representation, so the precondition
+	// is on the policy's ETag.
+	if !ifMatch(w, r, c, policyReadPath(policy)) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
+
+	if !h.commit(w, r, c.Conf.Batch().Delete(rulePath(policy, ruleID))) {
 		return
 	}
 
@@ -432,14 +463,10 @@ func (h *Handler) DisablePolicy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	policy := mux.Vars(r)["policy"]
-	path := fmt.Sprintf("firewall ipv4 name %s disable", policy)
-	out, _, err := c.Conf.Set(r.Context(), path)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	if !ifMatch(w, r, c, policyReadPath(policy)) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
+	if !h.commit(w, r, c.Conf.Batch().Set(subPath(policyPath(policy), "disable"))) {
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]bool{"disabled": true})
@@ -452,14 +479,10 @@ func (h *Handler) EnablePolicy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	policy := mux.Vars(r)["policy"]
-	path := fmt.Sprintf("firewall ipv4 name %s disable", policy)
-	out, _, err := c.Conf.Delete(r.Context(), path)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	if !ifMatch(w, r, c, policyReadPath(policy)) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
+	if !h.commit(w, r, c.Conf.Batch().Delete(subPath(policyPath(policy), "disable"))) {
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]bool{"disabled": false})
@@ -478,14 +501,10 @@ func (h *Handler) DisableRule(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "rule_id must be an integer")
 		return
 	}
-	path := fmt.Sprintf("firewall ipv4 name %s rule %d disable", policy, ruleID)
-	out, _, err := c.Conf.Set(r.Context(), path)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	if !ifMatch(w, r, c, policyReadPath(policy)) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
+	if !h.commit(w, r, c.Conf.Batch().Set(subPath(rulePath(policy, ruleID), "disable"))) {
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]bool{"disabled": true})
@@ -504,14 +523,10 @@ func (h *Handler) EnableRule(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "rule_id must be an integer")
 		return
 	}
-	path := fmt.Sprintf("firewall ipv4 name %s rule %d disable", policy, ruleID)
-	out, _, err := c.Conf.Delete(r.Context(), path)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	if !ifMatch(w, r, c, policyReadPath(policy)) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
+	if !h.commit(w, r, c.Conf.Batch().Delete(subPath(rulePath(policy, ruleID), "disable"))) {
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]bool{"disabled": false})
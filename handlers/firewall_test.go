@@ -2,7 +2,11 @@ package handlers_test
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"testing"
+
+	"github.com/valueiron/vyos-api/vyos"
 )
 
 func TestListPolicies_OK(t *testing.T) {
@@ -41,6 +45,47 @@ func TestListPolicies_DeviceNotFound(t *testing.T) {
 	assertStatus(t, w, http.StatusNotFound)
 }
 
+func TestListPolicies_BaseChainUnreachable(t *testing.T) {
+	// The named policies are read; the device then stops answering with a
+	// VyOS envelope before the base chains are.
+	m := &mockVyOS{responses: []vyosResp{dataResp(map[string]interface{}{})}}
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls++; calls > 1 {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		m.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	h := newHandler(vyos.NewClient(nil).WithURL(srv.URL).WithToken("testkey"))
+
+	w := do(t, http.MethodGet, "/", nil, deviceVars(), h.ListPolicies)
+	assertStatus(t, w, http.StatusBadGateway)
+}
+
+func TestIfMatch_BaseChain(t *testing.T) {
+	forward := map[string]interface{}{"default-action": "accept", "rule": map[string]interface{}{"10": map[string]interface{}{"action": "drop"}}}
+	_, _, client := newMockVyOS(t, dataResp(forward))
+	w := do(t, http.MethodGet, "/", nil, deviceVars("policy", "forward"), newHandler(client).GetPolicy)
+	assertStatus(t, w, http.StatusOK)
+	tag := w.Header().Get("ETag")
+
+	m, _, client := newMockVyOS(t, dataResp(forward), successResp())
+	h := newHandler(client)
+	w = doIfMatch(t, http.MethodPut, tag, nil, deviceVars("policy", "forward"), h.DisablePolicy)
+	assertStatus(t, w, http.StatusOK)
+	// The precondition is read where GetPolicy read it; the change itself
+	// still goes to the policy path.
+	want := []vyosReq{
+		{Op: "showConfig", Path: []string{"firewall", "ipv4", "forward", "filter"}},
+		{Op: "set", Path: []string{"firewall", "ipv4", "name", "forward", "disable"}},
+	}
+	if !reflect.DeepEqual(m.Received, want) {
+		t.Errorf("device got %+v, want %+v", m.Received, want)
+	}
+}
+
 func TestCreatePolicy_OK(t *testing.T) {
 	_, _, client := newMockVyOS(t, successResp())
 	h := newHandler(client)
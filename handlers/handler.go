@@ -2,9 +2,16 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"sync"
 
+	"github.com/valueiron/vyos-api/audit"
+	"github.com/valueiron/vyos-api/auth"
+	"github.com/valueiron/vyos-api/logctx"
+	"github.com/valueiron/vyos-api/snapshot"
 	"github.com/valueiron/vyos-api/vyos"
 	"github.com/gorilla/mux"
 )
@@ -14,28 +21,249 @@ type Device struct {
 	ID     string
 	URL    string
 	Client *vyos.Client
+	// AutoSave saves the running config to the boot config after every
+	// successful mutation, trading an extra device round-trip for durability
+	// across reboots.
+	AutoSave bool
+	// TLS is the certificate verification the client was built with.
+	TLS vyos.TLSConfig
+	// Description and Tags are free-form metadata from the devices file or
+	// the enrolment request.
+	Description string
+	Tags        []string
+
+	// entry is the devices file entry the device was built from, written
+	// back when the registry is persisted. Nil for VYOS_HOSTS devices.
+	entry *DeviceEntry
+	// spec identifies the settings the device was built from, so a reload
+	// can tell whether it changed. Empty for devices not loaded from a file.
+	spec string
 }
 
 // Handler holds shared dependencies for all HTTP handlers.
 type Handler struct {
-	devices map[string]*Device
+	devices *Registry
+	monitor *Monitor
+
+	// enrolMu serialises runtime device changes so each persisted file
+	// reflects a single, complete registry.
+	enrolMu sync.Mutex
+	// devicesFile and persist are set by SetDevicesFile.
+	devicesFile string
+	persist     bool
+	// autoSaveAll and autoSaveIDs are set by SetAutoSave.
+	autoSaveAll bool
+	autoSaveIDs map[string]bool
+	// readyPolicy is set by SetReadyPolicy.
+	readyPolicy ReadyPolicy
+	// metrics serves GET /metrics.
+	metrics http.Handler
+	// policy is set by SetPolicy.
+	policy *auth.Policy
+	// audit, if set, records every configuration change.
+	audit *audit.Log
+	// writes serializes configuration changes per device.
+	writes *writeQueue
+	// idempotency stores responses by Idempotency-Key; nil if disabled.
+	idempotency *idempotencyStore
+	// snapshots, if set, keeps configuration snapshots.
+	snapshots *snapshot.Store
 }
 
 // New returns a Handler backed by the given device map (keyed by device ID).
 func New(devices map[string]*Device) *Handler {
-	return &Handler{devices: devices}
+	reg := NewRegistry(devices)
+	h := &Handler{
+		devices:     reg,
+		monitor:     NewMonitor(reg),
+		writes:      newWriteQueue(DefaultWriteQueueDepth, DefaultWriteTimeout),
+		idempotency: newIdempotencyStore(DefaultIdempotencyKeys, DefaultIdempotencyTTL),
+	}
+	h.metrics = h.metricsHandler()
+	return h
+}
+
+// Devices returns the handler's device registry, e.g. to reload it.
+func (h *Handler) Devices() *Registry {
+	return h.devices
+}
+
+// Monitor returns the handler's device health monitor. The caller starts it
+// with Monitor.Run.
+func (h *Handler) Monitor() *Monitor {
+	return h.monitor
+}
+
+// SetDevicesFile records the devices file the registry was loaded from.
+// Relative paths in enrolment requests resolve against its directory, and if
+// persist is true every runtime change is written back to it.
+func (h *Handler) SetDevicesFile(path string, persist bool) {
+	h.devicesFile = path
+	h.persist = persist
 }
 
 // getClient extracts the device_id path variable, looks up the client, and
 // writes a 404 if not found. Returns (client, true) on success.
 func (h *Handler) getClient(w http.ResponseWriter, r *http.Request) (*vyos.Client, bool) {
+	d, ok := h.getDevice(w, r)
+	if !ok {
+		return nil, false
+	}
+	return d.Client, true
+}
+
+// getDevice is like getClient but returns the whole Device.
+func (h *Handler) getDevice(w http.ResponseWriter, r *http.Request) (*Device, bool) {
 	id := mux.Vars(r)["device_id"]
-	d, ok := h.devices[id]
+	d, ok := h.devices.Get(id)
 	if !ok {
 		writeError(w, http.StatusNotFound, "device not found: "+id)
 		return nil, false
 	}
-	return d.Client, true
+	return d, true
+}
+
+// CommitError is the 422 response body for a rejected batch. Operations lists
+// every op of the request: the ones VyOS named as rejected, with its reason,
+// and the rest as discarded. VyOS drops the whole session when any op fails,
+// so none of the operations remain applied.
+type CommitError struct {
+	Error      string          `json:"error"`
+	Operations []vyos.OpResult `json:"operations"`
+}
+
+// commit sends b to the device as a single commit. If the request carries a
+// confirm_minutes query parameter the commit is sent as a commit-confirm. On
+// failure it writes the error response and returns false.
+func (h *Handler) commit(w http.ResponseWriter, r *http.Request, b *vyos.Batch) bool {
+	minutes, ok := confirmMinutes(w, r)
+	if !ok {
+		return false
+	}
+	return h.apply(w, r, b, minutes)
+}
+
+// apply is commit with an explicit confirm window; zero means a plain commit.
+// A commit-confirm is not auto-saved: saving would make the pending change
+// survive the revert. ConfirmConfig saves once the change is accepted. The
+// commit is recorded in the audit log, if one is set.
+func (h *Handler) apply(w http.ResponseWriter, r *http.Request, b *vyos.Batch, confirmMinutes int) bool {
+	return h.applyOr(w, r, b, confirmMinutes, func(msg string) any {
+		return CommitError{
+			Error:      "device rejected operation: " + msg,
+			Operations: b.Explain(msg),
+		}
+	})
+}
+
+// applyOr is apply with the 422 body for a rejected commit built by rejected
+// from the device's error message. With snapshots on, the device's
+// configuration is snapshotted first. A request that asks for a dry run gets
+// the plan for b instead, and nothing is committed; applyOr then returns
+// false like any other response it has written.
+func (h *Handler) applyOr(w http.ResponseWriter, r *http.Request, b *vyos.Batch, confirmMinutes int, rejected func(msg string) any) bool {
+	plan, ok := dryRun(w, r)
+	if !ok {
+		return false
+	}
+	if plan {
+		h.writePlan(w, r, b, confirmMinutes)
+		return false
+	}
+
+	h.snapshotBefore(r)
+	snap := h.auditBefore(r, b)
+	var err error
+	if confirmMinutes > 0 {
+		_, err = b.CommitConfirm(r.Context(), confirmMinutes)
+	} else {
+		_, err = b.Commit(r.Context())
+	}
+	h.auditRecord(r, b, confirmMinutes, snap, err)
+	if errors.Is(err, vyos.ErrCommitFailed) {
+		writeJSON(w, http.StatusUnprocessableEntity, rejected(vyos.Message(err)))
+		return false
+	}
+	if err != nil {
+		writeDeviceError(w, err)
+		return false
+	}
+
+	if confirmMinutes > 0 {
+		w.Header().Set(ConfirmHeader, strconv.Itoa(confirmMinutes))
+		return true
+	}
+	return h.autoSave(w, r)
+}
+
+// autoSave saves the running config if the request's device has AutoSave
+// set. On failure it writes the error response and returns false.
+func (h *Handler) autoSave(w http.ResponseWriter, r *http.Request) bool {
+	d, ok := h.devices.Get(mux.Vars(r)["device_id"])
+	if !ok || !d.AutoSave {
+		return true
+	}
+	if _, err := d.Client.ConfigFile.Save(r.Context(), ""); err != nil {
+		status, msg := deviceError(err)
+		writeError(w, status, "change committed but not saved: "+msg)
+		return false
+	}
+	return true
+}
+
+// ConfirmHeader is set on mutation responses that were committed with
+// commit-confirm. Its value is the confirm window in minutes; the change is
+// reverted unless POST /devices/{device_id}/config/confirm is called in time.
+const ConfirmHeader = "X-Confirm-Minutes"
+
+// confirmMinutes parses the optional confirm_minutes query parameter. It
+// writes a 400 and returns false if the value is not a positive integer.
+func confirmMinutes(w http.ResponseWriter, r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("confirm_minutes")
+	if v == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		writeError(w, http.StatusBadRequest, "confirm_minutes must be a positive integer")
+		return 0, false
+	}
+	return n, true
+}
+
+// subPath returns a new config path made of base followed by segs. It always
+// copies, so several paths can safely be derived from the same base.
+func subPath(base []string, segs ...string) []string {
+	out := make([]string, 0, len(base)+len(segs))
+	out = append(out, base...)
+	return append(out, segs...)
+}
+
+// deviceError maps an error from the vyos client to an HTTP status and
+// message. Errors the device reported carry its own message; anything else
+// means the device could not be reached or answered garbage.
+func deviceError(err error) (int, string) {
+	switch {
+	case errors.Is(err, vyos.ErrPathNotFound):
+		return http.StatusNotFound, "not found on device: " + vyos.Message(err)
+	case errors.Is(err, vyos.ErrConfigLocked):
+		return http.StatusConflict, "device configuration locked: " + vyos.Message(err)
+	case errors.Is(err, vyos.ErrAuth):
+		return http.StatusBadGateway, "device authentication failed: check the API key"
+	case errors.Is(err, vyos.ErrCircuitOpen):
+		return http.StatusServiceUnavailable, "device unavailable: " + err.Error()
+	case errors.Is(err, vyos.ErrCommitFailed), errors.Is(err, vyos.ErrRejected):
+		return http.StatusUnprocessableEntity, "device rejected operation: " + vyos.Message(err)
+	default:
+		return http.StatusBadGateway, "device communication error: " + err.Error()
+	}
+}
+
+// writeDeviceError writes the error response for an error from the vyos
+// client; see deviceError.
+func writeDeviceError(w http.ResponseWriter, err error) {
+	status, msg := deviceError(err)
+	writeError(w, status, msg)
 }
 
 func writeJSON(w http.ResponseWriter, status int, v any) {
@@ -46,6 +274,13 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 	}
 }
 
+// writeError writes {"error": message}, with the request ID when
+// logctx.Middleware has assigned one, so a caller can quote it when
+// reporting the failure.
 func writeError(w http.ResponseWriter, status int, message string) {
-	writeJSON(w, status, map[string]string{"error": message})
+	body := map[string]string{"error": message}
+	if id := w.Header().Get(logctx.Header); id != "" {
+		body["request_id"] = id
+	}
+	writeJSON(w, status, body)
 }
@@ -0,0 +1,27 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/handlers"
+	"github.com/valueiron/vyos-api/logctx"
+)
+
+func TestErrorBody_IncludesRequestID(t *testing.T) {
+	h := handlers.New(nil)
+	r := httptest.NewRequest(http.MethodGet, "/devices/nope/vrfs", nil)
+	r.Header.Set(logctx.Header, "req-42")
+	r = mux.SetURLVars(r, map[string]string{"device_id": "nope"})
+	w := httptest.NewRecorder()
+	logctx.Middleware(http.HandlerFunc(h.ListVRFs)).ServeHTTP(w, r)
+
+	assertStatus(t, w, http.StatusNotFound)
+	var body map[string]string
+	decodeJSON(t, w, &body)
+	if body["request_id"] != "req-42" || w.Header().Get(logctx.Header) != "req-42" {
+		t.Errorf("body = %v, header = %q; want request_id req-42 in both", body, w.Header().Get(logctx.Header))
+	}
+}
@@ -2,13 +2,116 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 )
 
+// ReadyPolicy decides how many devices must be up for the service to be ready.
+type ReadyPolicy string
+
+const (
+	// ReadyAny requires at least one device to be up.
+	ReadyAny ReadyPolicy = "any"
+	// ReadyAll requires every device to be up.
+	ReadyAll ReadyPolicy = "all"
+	// ReadyQuorum requires more than half of the devices to be up.
+	ReadyQuorum ReadyPolicy = "quorum"
+)
+
+// ParseReadyPolicy parses "any", "all" or "quorum". An empty string yields
+// ReadyAny.
+func ParseReadyPolicy(s string) (ReadyPolicy, error) {
+	switch p := ReadyPolicy(s); p {
+	case "":
+		return ReadyAny, nil
+	case ReadyAny, ReadyAll, ReadyQuorum:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid ready policy %q (want any, all or quorum)", s)
+}
+
+// met reports whether up of total devices satisfies the policy. With no
+// devices registered there is nothing to reach, so every policy is met.
+func (p ReadyPolicy) met(up, total int) bool {
+	if total == 0 {
+		return true
+	}
+	switch p {
+	case ReadyAll:
+		return up == total
+	case ReadyQuorum:
+		return up*2 > total
+	default:
+		return up > 0
+	}
+}
+
+// Readiness is the body of GET /ready and GET /health?verbose=1.
+type Readiness struct {
+	Status       string       `json:"status"`
+	Ready        bool         `json:"ready"`
+	Policy       ReadyPolicy  `json:"policy"`
+	DevicesUp    int          `json:"devices_up"`
+	DevicesTotal int          `json:"devices_total"`
+	Devices      []DeviceInfo `json:"devices"`
+}
+
+// SetReadyPolicy sets the policy GET /ready applies. The default is ReadyAny.
+func (h *Handler) SetReadyPolicy(p ReadyPolicy) {
+	h.readyPolicy = p
+}
+
 // Health handles GET /health.
-// Returns {"status":"ok"} when the service is running.
+// Returns {"status":"ok"} when the service is running. With ?verbose=1 the
+// body also carries the readiness report; the status code stays 200, since
+// the process is alive either way.
 func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
+	if verbose, _ := strconv.ParseBool(r.URL.Query().Get("verbose")); verbose {
+		rd := h.readiness()
+		rd.Status = "ok"
+		writeJSON(w, http.StatusOK, rd)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
+
+// Ready handles GET /ready.
+// Returns 200 when enough devices are up for the ready policy and 503
+// otherwise, with per-device health from the monitor in both cases.
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	rd := h.readiness()
+	status := http.StatusOK
+	if !rd.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, rd)
+}
+
+func (h *Handler) readiness() Readiness {
+	policy := h.readyPolicy
+	if policy == "" {
+		policy = ReadyAny
+	}
+	devices := h.devices.List()
+	rd := Readiness{
+		Policy:       policy,
+		DevicesTotal: len(devices),
+		Devices:      make([]DeviceInfo, 0, len(devices)),
+	}
+	for _, d := range devices {
+		info := h.deviceInfo(d)
+		if info.Healthy {
+			rd.DevicesUp++
+		}
+		rd.Devices = append(rd.Devices, info)
+	}
+	rd.Ready = policy.met(rd.DevicesUp, rd.DevicesTotal)
+	rd.Status = "ready"
+	if !rd.Ready {
+		rd.Status = "not ready"
+	}
+	return rd
+}
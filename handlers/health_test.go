@@ -1,6 +1,7 @@
 package handlers_test
 
 import (
+	"context"
 	"net/http"
 	"testing"
 
@@ -19,3 +20,79 @@ func TestHealth_OK(t *testing.T) {
 		t.Errorf("status = %q, want ok", result["status"])
 	}
 }
+
+func TestHealth_Verbose(t *testing.T) {
+	_, srv, client := newMockVyOS(t)
+	srv.Close()
+	h := newHandler(client)
+	h.Monitor().Check(context.Background())
+
+	w := do(t, http.MethodGet, "/health?verbose=1", nil, nil, h.Health)
+	assertStatus(t, w, http.StatusOK)
+	var result handlers.Readiness
+	decodeJSON(t, w, &result)
+	if result.Status != "ok" || result.Ready || len(result.Devices) != 1 {
+		t.Errorf("verbose health = %+v, want status ok, not ready, one device", result)
+	}
+}
+
+func TestReady(t *testing.T) {
+	_, _, upClient := newMockVyOS(t)
+	_, downSrv, downClient := newMockVyOS(t)
+	downSrv.Close()
+
+	tests := []struct {
+		policy handlers.ReadyPolicy
+		down   int // of three devices
+		want   int
+	}{
+		{handlers.ReadyAny, 2, http.StatusOK},
+		{handlers.ReadyAny, 3, http.StatusServiceUnavailable},
+		{handlers.ReadyQuorum, 1, http.StatusOK},
+		{handlers.ReadyQuorum, 2, http.StatusServiceUnavailable},
+		{handlers.ReadyAll, 0, http.StatusOK},
+		{handlers.ReadyAll, 1, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		devices := map[string]*handlers.Device{}
+		for i, id := range []string{"r1", "r2", "r3"} {
+			client := upClient
+			if i < tt.down {
+				client = downClient
+			}
+			devices[id] = &handlers.Device{ID: id, Client: client}
+		}
+		h := handlers.New(devices)
+		h.SetReadyPolicy(tt.policy)
+		h.Monitor().Check(context.Background())
+
+		w := do(t, http.MethodGet, "/ready", nil, nil, h.Ready)
+		if w.Code != tt.want {
+			t.Errorf("policy %s with %d/3 down: status %d, want %d", tt.policy, tt.down, w.Code, tt.want)
+		}
+		var result handlers.Readiness
+		decodeJSON(t, w, &result)
+		if result.DevicesUp != 3-tt.down || result.DevicesTotal != 3 {
+			t.Errorf("policy %s: up %d/%d, want %d/3", tt.policy, result.DevicesUp, result.DevicesTotal, 3-tt.down)
+		}
+	}
+}
+
+func TestReady_NoDevices(t *testing.T) {
+	h := handlers.New(nil)
+	h.SetReadyPolicy(handlers.ReadyAll)
+	w := do(t, http.MethodGet, "/ready", nil, nil, h.Ready)
+	assertStatus(t, w, http.StatusOK)
+}
+
+func TestParseReadyPolicy(t *testing.T) {
+	if p, err := handlers.ParseReadyPolicy(""); err != nil || p != handlers.ReadyAny {
+		t.Errorf(`ParseReadyPolicy("") = %q, %v; want any`, p, err)
+	}
+	if p, err := handlers.ParseReadyPolicy("quorum"); err != nil || p != handlers.ReadyQuorum {
+		t.Errorf(`ParseReadyPolicy("quorum") = %q, %v`, p, err)
+	}
+	if _, err := handlers.ParseReadyPolicy("most"); err == nil {
+		t.Error(`ParseReadyPolicy("most") succeeded, want error`)
+	}
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/valueiron/vyos-api/auth"
+)
+
+// Defaults for SetIdempotency.
+const (
+	DefaultIdempotencyKeys = 10000
+	DefaultIdempotencyTTL  = 24 * time.Hour
+)
+
+const (
+	// IdempotencyHeader carries a caller-chosen key that makes a POST safe
+	// to retry: a repeat of the request with the same key gets the stored
+	// response instead of running again.
+	IdempotencyHeader = "Idempotency-Key"
+	// ReplayedHeader is set to "true" on responses replayed from the store.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKey = 255
+	// maxStoredBody bounds the response kept per key; larger responses are
+	// not stored, so their key can be retried.
+	maxStoredBody = 1 << 20
+)
+
+// idempotencyStore remembers the requests made with each idempotency key and,
+// once they finish, their responses. It holds at most max keys, dropping the
+// oldest first, and each for ttl. Every key lives for the same ttl, so the
+// oldest entry is also the first to expire.
+type idempotencyStore struct {
+	max int
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	order   *list.List // of *idempotencyEntry, oldest first
+}
+
+type idempotencyEntry struct {
+	key     string
+	hash    [sha256.Size]byte
+	expires time.Time
+	elem    *list.Element
+
+	// Set by finish; done is false while the first request is running.
+	done   bool
+	status int
+	header http.Header
+	body   []byte
+}
+
+type idempotencyState int
+
+const (
+	idempotencyNew        idempotencyState = iota // run the request and finish the entry
+	idempotencyReplay                             // the entry holds the response to send
+	idempotencyInProgress                         // the first request has not finished
+	idempotencyMismatch                           // the key was used for another request
+)
+
+func newIdempotencyStore(max int, ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{max: max, ttl: ttl, now: time.Now, entries: map[string]*idempotencyEntry{}, order: list.New()}
+}
+
+// begin looks up key for a request with the given hash, adding an entry if
+// the key is new.
+func (s *idempotencyStore) begin(key string, hash [sha256.Size]byte) (*idempotencyEntry, idempotencyState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for e := s.order.Front(); e != nil && !e.Value.(*idempotencyEntry).expires.After(now); e = s.order.Front() {
+		s.remove(e.Value.(*idempotencyEntry))
+	}
+
+	if e, ok := s.entries[key]; ok {
+		switch {
+		case e.hash != hash:
+			return e, idempotencyMismatch
+		case !e.done:
+			return e, idempotencyInProgress
+		}
+		return e, idempotencyReplay
+	}
+
+	for s.order.Len() >= s.max {
+		s.remove(s.order.Front().Value.(*idempotencyEntry))
+	}
+	e := &idempotencyEntry{key: key, hash: hash, expires: now.Add(s.ttl)}
+	e.elem = s.order.PushBack(e)
+	s.entries[key] = e
+	return e, idempotencyNew
+}
+
+// finish stores the response rec recorded for e. Responses that may not
+// reflect the request's final outcome are dropped instead, so a retry runs
+// the request again: server and device errors, 409s (a held config lock or a
+// busy write queue), responses too large to keep, and handlers that wrote
+// nothing, which includes a panic.
+func (s *idempotencyStore) finish(e *idempotencyEntry, rec *idempotencyRecorder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries[e.key] != e {
+		return // evicted while the request ran
+	}
+	if rec.status == 0 || rec.status >= 500 || rec.status == http.StatusConflict || rec.overflow {
+		s.remove(e)
+		return
+	}
+	e.done = true
+	e.status = rec.status
+	e.header = rec.header
+	e.body = rec.body.Bytes()
+}
+
+func (s *idempotencyStore) remove(e *idempotencyEntry) {
+	s.order.Remove(e.elem)
+	delete(s.entries, e.key)
+}
+
+// idempotencyRecorder passes a response through while keeping a copy of its
+// status, body and the headers the handler set.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	// before holds the headers set by earlier middleware, such as the request
+	// ID, which belong to each request rather than to the stored response.
+	before   http.Header
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (rw *idempotencyRecorder) WriteHeader(code int) {
+	if rw.status == 0 {
+		rw.status = code
+		rw.header = http.Header{}
+		for k, v := range rw.Header() {
+			if !slices.Equal(rw.before[k], v) {
+				rw.header[k] = slices.Clone(v)
+			}
+		}
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *idempotencyRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if !rw.overflow {
+		if rw.body.Len()+len(b) > maxStoredBody {
+			rw.overflow = true
+			rw.body = bytes.Buffer{}
+		} else {
+			rw.body.Write(b)
+		}
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+// SetIdempotency sets how many idempotency keys are remembered and for how
+// long. Zero keys disables the Idempotency middleware. New uses
+// DefaultIdempotencyKeys and DefaultIdempotencyTTL.
+func (h *Handler) SetIdempotency(keys int, ttl time.Duration) {
+	if keys <= 0 {
+		h.idempotency = nil
+		return
+	}
+	h.idempotency = newIdempotencyStore(keys, ttl)
+}
+
+// Idempotency is middleware that makes POST requests carrying an
+// Idempotency-Key header safe to retry. The first request with a key runs and
+// its response is stored; a repeat with the same method, URL and body gets the
+// stored response with Idempotent-Replayed: true instead of running again. A
+// repeat while the first is still running gets 409, and reusing a key for a
+// different request gets 422. Keys are scoped to the authenticated caller.
+// Dry runs are neither stored nor replayed, so a plan never stands in for the
+// change it describes, or the other way round.
+func (h *Handler) Idempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyHeader)
+		if h.idempotency == nil || r.Method != http.MethodPost || key == "" || wantsPlan(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			writeError(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "could not read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		var caller string
+		if p, ok := auth.PrincipalFrom(r.Context()); ok {
+			caller = p.Method + ":" + p.Name
+		}
+		sum := sha256.Sum256(append([]byte(r.Method+" "+r.URL.RequestURI()+"\n"), body...))
+
+		e, state := h.idempotency.begin(caller+"\x00"+key, sum)
+		switch state {
+		case idempotencyMismatch:
+			idempotentRequests.WithLabelValues("mismatch").Inc()
+			writeError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+			return
+		case idempotencyInProgress:
+			idempotentRequests.WithLabelValues("in_progress").Inc()
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusConflict, "a request with this Idempotency-Key is still in progress")
+			return
+		case idempotencyReplay:
+			idempotentRequests.WithLabelValues("replayed").Inc()
+			for k, v := range e.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set(ReplayedHeader, "true")
+			w.WriteHeader(e.status)
+			w.Write(e.body) //nolint:errcheck
+			return
+		}
+
+		idempotentRequests.WithLabelValues("executed").Inc()
+		rec := &idempotencyRecorder{ResponseWriter: w, before: w.Header().Clone()}
+		defer h.idempotency.finish(e, rec)
+		next.ServeHTTP(rec, r)
+	})
+}
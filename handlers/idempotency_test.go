@@ -0,0 +1,147 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestIdempotency(t *testing.T) {
+	m, _, client := newMockVyOS(t)
+	h := newHandler(client)
+	r := mux.NewRouter()
+	r.Use(h.Idempotency)
+	r.HandleFunc("/devices/{device_id}/vrfs", h.CreateVRF).Methods(http.MethodPost)
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/devices/router1/vrfs", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	const body = `{"name":"BLUE","table":"100"}`
+
+	first := send("k1", body)
+	assertStatus(t, first, http.StatusCreated)
+	sent := len(m.Received)
+
+	again := send("k1", body)
+	assertStatus(t, again, http.StatusCreated)
+	if again.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("repeat was not marked as replayed")
+	}
+	if again.Header().Get("Content-Type") != "application/json" || again.Body.String() != first.Body.String() {
+		t.Errorf("replay = %q %q, want %q", again.Header().Get("Content-Type"), again.Body.String(), first.Body.String())
+	}
+	if len(m.Received) != sent {
+		t.Errorf("replay sent %d more ops to the device", len(m.Received)-sent)
+	}
+
+	w := send("k1", `{"name":"RED","table":"200"}`)
+	assertStatus(t, w, http.StatusUnprocessableEntity)
+
+	// Without a key every request runs.
+	assertStatus(t, send("", body), http.StatusCreated)
+	if len(m.Received) == sent {
+		t.Error("request without a key was not sent to the device")
+	}
+}
+
+func TestIdempotency_FailuresNotStored(t *testing.T) {
+	_, _, client := newMockVyOS(t)
+	h := newHandler(client)
+	calls := 0
+	started, finish := make(chan struct{}), make(chan struct{})
+	r := mux.NewRouter()
+	r.Use(h.Idempotency)
+	r.HandleFunc("/devices/{device_id}/config/save", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			close(started)
+			<-finish
+			w.WriteHeader(http.StatusOK)
+		}
+	}).Methods(http.MethodPost)
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/devices/router1/config/save", nil)
+		req.Header.Set("Idempotency-Key", "save-1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// A device error is not stored, so the retry runs again.
+	assertStatus(t, send(), http.StatusBadGateway)
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- send() }()
+	<-started
+
+	// A repeat while the retry is running is refused.
+	w := send()
+	assertStatus(t, w, http.StatusConflict)
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("409 has no Retry-After")
+	}
+
+	close(finish)
+	assertStatus(t, <-done, http.StatusOK)
+	assertStatus(t, send(), http.StatusOK)
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+}
+
+func TestIdempotency_DryRunNotStored(t *testing.T) {
+	m, _, client := newMockVyOS(t)
+	h := newHandler(client)
+	r := mux.NewRouter()
+	r.Use(h.Idempotency)
+	r.HandleFunc("/devices/{device_id}/vrfs", h.CreateVRF).Methods(http.MethodPost)
+
+	send := func(plan bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/devices/router1/vrfs", strings.NewReader(`{"name":"BLUE","table":"100"}`))
+		req.Header.Set("Idempotency-Key", "k1")
+		if plan {
+			req.Header.Set("Prefer", "return=plan")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	sets := func() int {
+		n := 0
+		for _, op := range m.Received {
+			if op.Op == "set" {
+				n++
+			}
+		}
+		return n
+	}
+
+	assertStatus(t, send(true), http.StatusOK)
+	if sets() != 0 {
+		t.Fatalf("plan sent %d set ops", sets())
+	}
+
+	w := send(false)
+	assertStatus(t, w, http.StatusCreated)
+	if w.Header().Get("Idempotent-Replayed") != "" || sets() == 0 {
+		t.Errorf("commit after plan was replayed (sets = %d)", sets())
+	}
+
+	w = send(true)
+	assertStatus(t, w, http.StatusOK)
+	if w.Header().Get("Idempotent-Replayed") != "" || w.Header().Get("Preference-Applied") != "return=plan" {
+		t.Errorf("plan after commit got %v", w.Header())
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/valueiron/vyos-api/vyos"
+)
+
+// registry holds the process-wide metrics. Every metric the service exports
+// is registered in this file.
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "vyos_api_http_requests_total",
+		Help: "HTTP requests served, by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+	httpDuration = promauto.With(registry).NewHistogramVec(prometheus.HistogramOpts{
+		Name: "vyos_api_http_request_duration_seconds",
+		Help: "HTTP request latency, by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+	httpInFlight = promauto.With(registry).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vyos_api_http_requests_in_flight",
+		Help: "HTTP requests currently being served, by method and route template.",
+	}, []string{"method", "route"})
+
+	upstreamRequests = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "vyos_api_upstream_requests_total",
+		Help: "Requests sent to VyOS devices, by device, API endpoint and error class (empty on success).",
+	}, []string{"device", "endpoint", "error"})
+	upstreamDuration = promauto.With(registry).NewHistogramVec(prometheus.HistogramOpts{
+		Name: "vyos_api_upstream_request_duration_seconds",
+		Help: "Time VyOS devices took to answer, by device and API endpoint.",
+	}, []string{"device", "endpoint"})
+
+	writeQueueDepth = promauto.With(registry).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vyos_api_write_queue_depth",
+		Help: "Configuration changes waiting for another change to the device to finish.",
+	}, []string{"device"})
+	writeQueueWait = promauto.With(registry).NewHistogramVec(prometheus.HistogramOpts{
+		Name: "vyos_api_write_queue_wait_seconds",
+		Help: "Time configuration changes waited for their turn on the device.",
+	}, []string{"device"})
+	writeQueueRejected = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "vyos_api_write_queue_rejected_total",
+		Help: "Configuration changes refused because the device's write queue was full or the wait timed out, by reason (full, timeout).",
+	}, []string{"device", "reason"})
+
+	idempotentRequests = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "vyos_api_idempotent_requests_total",
+		Help: "POST requests carrying an Idempotency-Key, by outcome (executed, replayed, in_progress, mismatch).",
+	}, []string{"outcome"})
+
+	snapshotsTaken = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "vyos_api_snapshots_total",
+		Help: "Configuration snapshots taken, by device, trigger (manual, scheduled, pre-change) and outcome (success, failure, unchanged).",
+	}, []string{"device", "trigger", "outcome"})
+)
+
+// UpstreamObserver returns a vyos.Observer recording the requests of the
+// device with the given ID in the upstream metrics.
+func UpstreamObserver(id string) vyos.Observer {
+	return func(endpoint string, elapsed time.Duration, err error) {
+		upstreamRequests.WithLabelValues(id, endpoint, vyos.ErrorClass(err)).Inc()
+		upstreamDuration.WithLabelValues(id, endpoint).Observe(elapsed.Seconds())
+	}
+}
+
+// MetricsMiddleware records each request under its route template (e.g.
+// /devices/{device_id}/vrfs) so device IDs and other path values do not
+// multiply the series.
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if tpl, err := cr.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		inFlight := httpInFlight.WithLabelValues(r.Method, route)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+		status := strconv.Itoa(rw.status)
+		httpRequests.WithLabelValues(r.Method, route, status).Inc()
+		httpDuration.WithLabelValues(r.Method, route, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rw *statusRecorder) WriteHeader(code int) {
+	rw.status = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// deviceCollector exports the monitor's view of every registered device,
+// read at scrape time.
+type deviceCollector struct {
+	h *Handler
+}
+
+// deviceGauge is one per-device gauge: value reports the sample for a
+// device, or false to leave the device out.
+type deviceGauge struct {
+	desc  *prometheus.Desc
+	value func(DeviceHealth) (float64, bool)
+}
+
+var deviceGauges = []deviceGauge{
+	{prometheus.NewDesc("vyos_api_device_up", "Whether the device answered its last health probe.", []string{"device"}, nil),
+		func(s DeviceHealth) (float64, bool) {
+			if s.Healthy {
+				return 1, true
+			}
+			return 0, true
+		}},
+	{prometheus.NewDesc("vyos_api_device_circuit_open", "Whether the device's circuit breaker is open or half-open, so requests fail fast.", []string{"device"}, nil),
+		func(s DeviceHealth) (float64, bool) {
+			if s.Circuit == vyos.CircuitClosed {
+				return 0, true
+			}
+			return 1, true
+		}},
+	{prometheus.NewDesc("vyos_api_device_consecutive_failures", "Health probes failed in a row.", []string{"device"}, nil),
+		func(s DeviceHealth) (float64, bool) { return float64(s.ConsecutiveFailures), true }},
+	{prometheus.NewDesc("vyos_api_device_probe_latency_seconds", "Duration of the last successful health probe.", []string{"device"}, nil),
+		func(s DeviceHealth) (float64, bool) { return float64(s.LatencyMS) / 1000, s.LastSeen != nil }},
+	{prometheus.NewDesc("vyos_api_device_last_seen_timestamp_seconds", "Unix time the device last answered a health probe.", []string{"device"}, nil),
+		func(s DeviceHealth) (float64, bool) {
+			if s.LastSeen == nil {
+				return 0, false
+			}
+			return float64(s.LastSeen.UnixNano()) / 1e9, true
+		}},
+}
+
+func (c deviceCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, g := range deviceGauges {
+		ch <- g.desc
+	}
+}
+
+func (c deviceCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, d := range c.h.devices.List() {
+		s := c.h.monitor.Health(d)
+		for _, g := range deviceGauges {
+			if v, ok := g.value(s); ok {
+				ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, v, d.ID)
+			}
+		}
+	}
+}
+
+// metricsHandler returns the /metrics handler for h: the process-wide
+// metrics plus the per-device gauges of h's registry and monitor.
+func (h *Handler) metricsHandler() http.Handler {
+	devices := prometheus.NewRegistry()
+	devices.MustRegister(deviceCollector{h})
+	return promhttp.HandlerFor(prometheus.Gatherers{registry, devices}, promhttp.HandlerOpts{})
+}
+
+// Metrics handles GET /metrics.
+// Returns every metric in the Prometheus text format.
+func (h *Handler) Metrics(w http.ResponseWriter, r *http.Request) {
+	h.metrics.ServeHTTP(w, r)
+}
@@ -0,0 +1,60 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/handlers"
+)
+
+func TestMetrics(t *testing.T) {
+	_, _, client := newMockVyOS(t, failResp("Nothing to delete"))
+	client.WithObserver(handlers.UpstreamObserver("metrics-router"))
+	h := handlers.New(map[string]*handlers.Device{
+		"metrics-router": {ID: "metrics-router", Client: client},
+	})
+	client.Conf.DeletePath(context.Background(), []string{"vrf"}) //nolint:errcheck
+	h.Monitor().Check(context.Background())
+
+	w := do(t, http.MethodGet, "/metrics", nil, nil, h.Metrics)
+	assertStatus(t, w, http.StatusOK)
+	body := w.Body.String()
+	for _, want := range []string{
+		`vyos_api_upstream_requests_total{device="metrics-router",endpoint="/configure",error="commit_failed"} 1`,
+		`vyos_api_upstream_requests_total{device="metrics-router",endpoint="/retrieve",error=""} 1`,
+		`vyos_api_upstream_request_duration_seconds_count{device="metrics-router",endpoint="/configure"} 1`,
+		`vyos_api_device_up{device="metrics-router"} 1`,
+		`vyos_api_device_consecutive_failures{device="metrics-router"} 0`,
+		"# HELP vyos_api_device_up Whether the device answered its last health probe.\n# TYPE vyos_api_device_up gauge\n",
+		"# TYPE vyos_api_upstream_request_duration_seconds histogram\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	h := handlers.New(nil)
+	r := mux.NewRouter()
+	r.Use(handlers.MetricsMiddleware)
+	r.HandleFunc("/devices/{device_id}/widgets", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/devices/r1/widgets", nil))
+
+	body := do(t, http.MethodGet, "/metrics", nil, nil, h.Metrics).Body.String()
+	for _, want := range []string{
+		`vyos_api_http_requests_total{method="GET",route="/devices/{device_id}/widgets",status="418"} 1`,
+		`vyos_api_http_request_duration_seconds_count{method="GET",route="/devices/{device_id}/widgets",status="418"} 1`,
+		`vyos_api_http_requests_in_flight{method="GET",route="/devices/{device_id}/widgets"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/valueiron/vyos-api/vyos"
+)
+
+// DefaultHealthInterval is how often the Monitor probes each device unless
+// configured otherwise.
+const DefaultHealthInterval = 30 * time.Second
+
+// probeTimeout bounds a single connectivity probe.
+const probeTimeout = 5 * time.Second
+
+// monitorSync is how often a running Monitor picks up devices added to or
+// removed from the registry.
+const monitorSync = time.Second
+
+// DeviceHealth is the Monitor's view of one device.
+type DeviceHealth struct {
+	Healthy bool `json:"healthy"`
+	// LastChecked is when the last probe finished; nil until the first one.
+	LastChecked *time.Time `json:"last_checked,omitempty"`
+	// LastSeen is when the device last answered a probe.
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+	// LatencyMS is the duration of the last successful probe.
+	LatencyMS           int64  `json:"latency_ms"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastError           string `json:"last_error,omitempty"`
+	// APIKeyValid is false once the device has refused the API key and true
+	// once it has accepted it; nil while the device has never answered.
+	APIKeyValid *bool `json:"api_key_valid,omitempty"`
+	// Version is the VyOS version from "show version", read when the
+	// device first answers and again whenever it recovers from a failure.
+	Version string `json:"version,omitempty"`
+	// Circuit is the state of the device client's circuit breaker: closed,
+	// open (requests fail fast) or half_open (a trial request is allowed).
+	Circuit vyos.CircuitState `json:"circuit"`
+}
+
+// Monitor probes every registered device in the background and caches the
+// result, so reporting health never waits on a device.
+type Monitor struct {
+	devices *Registry
+
+	mu    sync.RWMutex
+	state map[*Device]*DeviceHealth
+}
+
+// NewMonitor returns a Monitor for the devices in reg. It does not probe
+// anything until Run or Check is called.
+func NewMonitor(reg *Registry) *Monitor {
+	return &Monitor{devices: reg, state: map[*Device]*DeviceHealth{}}
+}
+
+// Run probes each device every interval until ctx is cancelled, with one
+// goroutine per device. Devices added to the registry are picked up within
+// a second and probed immediately; removed or replaced devices stop being
+// probed and their state is dropped.
+func (m *Monitor) Run(ctx context.Context, interval time.Duration) {
+	running := map[*Device]context.CancelFunc{}
+	defer func() {
+		for _, cancel := range running {
+			cancel()
+		}
+	}()
+
+	ticker := time.NewTicker(monitorSync)
+	defer ticker.Stop()
+	for {
+		current := map[*Device]bool{}
+		for _, d := range m.devices.List() {
+			current[d] = true
+			if _, ok := running[d]; !ok {
+				dctx, cancel := context.WithCancel(ctx)
+				running[d] = cancel
+				go m.watch(dctx, d, interval)
+			}
+		}
+		for d, cancel := range running {
+			if !current[d] {
+				cancel()
+				delete(running, d)
+				m.forget(d)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// watch probes d every interval until ctx is cancelled.
+func (m *Monitor) watch(ctx context.Context, d *Device, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.probe(ctx, d)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check probes every registered device once, concurrently, and returns when
+// all probes have finished.
+func (m *Monitor) Check(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, d := range m.devices.List() {
+		wg.Add(1)
+		go func(d *Device) {
+			defer wg.Done()
+			m.probe(ctx, d)
+		}(d)
+	}
+	wg.Wait()
+}
+
+// Health returns the cached state of d. The zero DeviceHealth (unhealthy,
+// never checked) is returned for a device that has not been probed yet.
+func (m *Monitor) Health(d *Device) DeviceHealth {
+	m.mu.RLock()
+	var s DeviceHealth
+	if p, ok := m.state[d]; ok {
+		s = *p
+	}
+	m.mu.RUnlock()
+	s.Circuit = vyos.CircuitClosed
+	if d.Client != nil {
+		s.Circuit = d.Client.Circuit()
+	}
+	return s
+}
+
+func (m *Monitor) probe(ctx context.Context, d *Device) {
+	start := time.Now()
+	err := checkDevice(ctx, d)
+	if ctx.Err() != nil {
+		// Cancelled because the device was removed or the monitor stopped;
+		// the failure says nothing about the device.
+		return
+	}
+	latency := time.Since(start)
+	if err == nil && m.needsVersion(d) {
+		if v := deviceVersion(ctx, d); v != "" {
+			m.setVersion(d, v)
+		}
+	}
+	m.record(d, latency, err)
+}
+
+// needsVersion reports whether d's version is unknown or may have changed
+// since it was read, i.e. the device has not been seen up since.
+func (m *Monitor) needsVersion(d *Device) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.state[d]
+	return !ok || s.Version == "" || !s.Healthy
+}
+
+func (m *Monitor) setVersion(d *Device, v string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.state[d]
+	if !ok {
+		s = &DeviceHealth{}
+		m.state[d] = s
+	}
+	s.Version = v
+}
+
+// record stores the outcome of a probe of d that took latency.
+func (m *Monitor) record(d *Device, latency time.Duration, err error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.state[d]
+	if !ok {
+		s = &DeviceHealth{}
+		m.state[d] = s
+	}
+	s.LastChecked = &now
+	if err != nil {
+		s.Healthy = false
+		s.ConsecutiveFailures++
+		s.LastError = err.Error()
+		if errors.Is(err, vyos.ErrAuth) {
+			s.APIKeyValid = boolPtr(false)
+		}
+		return
+	}
+	s.Healthy = true
+	s.APIKeyValid = boolPtr(true)
+	s.LastSeen = &now
+	s.LatencyMS = latency.Milliseconds()
+	s.ConsecutiveFailures = 0
+	s.LastError = ""
+}
+
+func (m *Monitor) forget(d *Device) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.state, d)
+}
+
+// checkDevice is the connectivity check behind the Monitor and device
+// enrolment. An unset host-name still proves the device is reachable.
+func checkDevice(ctx context.Context, d *Device) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	_, err := d.Client.Conf.GetPath(ctx, []string{"system", "host-name"})
+	if errors.Is(err, vyos.ErrPathNotFound) {
+		return nil
+	}
+	return err
+}
+
+// deviceVersion returns d's VyOS version, or "" if it cannot be read.
+func deviceVersion(ctx context.Context, d *Device) string {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	out, err := d.Client.Show.Run(ctx, []string{"version"})
+	if err != nil {
+		return ""
+	}
+	return vyos.ParseVersion(out.Text()).Version
+}
+
+func boolPtr(b bool) *bool { return &b }
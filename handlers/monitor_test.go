@@ -0,0 +1,121 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/valueiron/vyos-api/handlers"
+	"github.com/valueiron/vyos-api/vyos"
+)
+
+func TestMonitor_CountsFailuresAndRecovers(t *testing.T) {
+	_, _, client := newMockVyOS(t,
+		failResp("connection reset"), failResp("connection reset"), dataResp("vyos"))
+	h := newHandler(client)
+	d, _ := h.Devices().Get("router1")
+	ctx := context.Background()
+
+	h.Monitor().Check(ctx)
+	h.Monitor().Check(ctx)
+	got := h.Monitor().Health(d)
+	if got.Healthy || got.ConsecutiveFailures != 2 || got.LastError == "" || got.LastSeen != nil {
+		t.Fatalf("after two failures: %+v", got)
+	}
+
+	h.Monitor().Check(ctx)
+	got = h.Monitor().Health(d)
+	if !got.Healthy || got.ConsecutiveFailures != 0 || got.LastError != "" || got.LastSeen == nil {
+		t.Errorf("after recovery: %+v", got)
+	}
+}
+
+func TestMonitor_RunFollowsRegistry(t *testing.T) {
+	_, _, client := newMockVyOS(t)
+	h := newHandler(client)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Monitor().Run(ctx, time.Hour)
+
+	d, _ := h.Devices().Get("router1")
+	waitFor(t, func() bool { return h.Monitor().Health(d).Healthy })
+
+	h.Devices().Replace(map[string]*handlers.Device{})
+	waitFor(t, func() bool { return h.Monitor().Health(d).LastChecked == nil })
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMonitor_ReadsVersionOnce(t *testing.T) {
+	m, _, client := newMockVyOS(t,
+		dataResp("vyos"), dataResp("Version:          VyOS 1.4.0\nArchitecture:     x86_64\n"),
+		dataResp("vyos"))
+	h := newHandler(client)
+	d, _ := h.Devices().Get("router1")
+	ctx := context.Background()
+
+	h.Monitor().Check(ctx)
+	h.Monitor().Check(ctx)
+	got := h.Monitor().Health(d)
+	if got.Version != "VyOS 1.4.0" {
+		t.Errorf("version = %q, want VyOS 1.4.0", got.Version)
+	}
+	if got.APIKeyValid == nil || !*got.APIKeyValid {
+		t.Errorf("api_key_valid = %v, want true", got.APIKeyValid)
+	}
+	if len(m.Received) != 3 {
+		t.Errorf("device received %d requests, want 3 (version read once)", len(m.Received))
+	}
+}
+
+func TestMonitor_RejectedAPIKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(failResp("Valid API key is required")) //nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	h := newHandler(vyos.NewClient(nil).WithURL(srv.URL).WithToken("wrong"))
+	d, _ := h.Devices().Get("router1")
+
+	h.Monitor().Check(context.Background())
+	got := h.Monitor().Health(d)
+	if got.Healthy || got.APIKeyValid == nil || *got.APIKeyValid {
+		t.Errorf("after 401: %+v, want unhealthy with api_key_valid=false", got)
+	}
+}
+
+func TestMonitor_CircuitBreaker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream down", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	client := vyos.NewClient(nil).WithURL(srv.URL).
+		WithBreaker(vyos.BreakerPolicy{Threshold: 1, Cooldown: time.Hour})
+	h := newHandler(client)
+	d, _ := h.Devices().Get("router1")
+
+	if got := h.Monitor().Health(d).Circuit; got != vyos.CircuitClosed {
+		t.Errorf("circuit = %q before any failure, want closed", got)
+	}
+	h.Monitor().Check(context.Background())
+	if got := h.Monitor().Health(d); got.Circuit != vyos.CircuitOpen || got.Healthy {
+		t.Errorf("after a failed probe: %+v", got)
+	}
+
+	// Requests now fail fast with 503.
+	w := do(t, http.MethodGet, "/", nil, deviceVars(), h.ListVRFs)
+	assertStatus(t, w, http.StatusServiceUnavailable)
+}
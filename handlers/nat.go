@@ -2,12 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/vyos"
 )
 
 // NATRuleInfo is the API representation of a VyOS NAT rule.
@@ -60,8 +60,8 @@ func validNATType(natType string) bool {
 	return natType == "source" || natType == "destination"
 }
 
-func natRulePath(natType string, ruleID int) string {
-	return fmt.Sprintf("nat %s rule %d", natType, ruleID)
+func natRulePath(natType string, ruleID int) []string {
+	return []string{"nat", natType, "rule", strconv.Itoa(ruleID)}
 }
 
 // ListNATRules handles GET /devices/{device_id}/nat/{nat_type}/rules.
@@ -76,37 +76,28 @@ func (h *Handler) ListNATRules(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	out, _, err := c.Conf.Get(r.Context(), fmt.Sprintf("nat %s rule", natType), nil)
-	if err != nil {
-		// VyOS returns HTTP 400 when a config path doesn't exist at all (NAT not yet configured).
-		// Treat it the same as an empty result rather than an error.
-		if strings.Contains(err.Error(), "unexpected status 400") {
-			writeJSON(w, http.StatusOK, []NATRuleInfo{})
-			return
-		}
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	out, err := c.Conf.GetPath(r.Context(), []string{"nat", natType, "rule"})
+	// A missing path means no NAT rules of this type are configured yet.
+	if err != nil && !errors.Is(err, vyos.ErrPathNotFound) {
+		writeDeviceError(w, err)
 		return
 	}
 
 	result := []NATRuleInfo{}
-	if out.Success {
-		rawMap, _ := out.Data.(map[string]interface{})
-		ruleMap := rawMap
-		if inner, ok := rawMap["rule"].(map[string]interface{}); ok {
-			ruleMap = inner
-		}
-		for idStr, ruleData := range ruleMap {
-			ruleID, err := strconv.Atoi(idStr)
-			if err != nil {
-				continue
-			}
-			result = append(result, parseNATRuleData(natType, ruleID, ruleData))
+	rawMap, _ := out.Data.(map[string]interface{})
+	ruleMap := rawMap
+	if inner, ok := rawMap["rule"].(map[string]interface{}); ok {
+		ruleMap = inner
+	}
+	for idStr, ruleData := range ruleMap {
+		ruleID, err := strconv.Atoi(idStr)
+		if err != nil {
+			continue
 		}
-	} else if !strings.Contains(errMsg(out.Error), "empty") {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
-		return
+		result = append(result, parseNATRuleData(natType, ruleID, ruleData))
 	}
 
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, result)
 }
 
@@ -127,59 +118,75 @@ func (h *Handler) CreateNATRule(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid JSON body")
 		return
 	}
-	if req.RuleID == 0 {
-		writeError(w, http.StatusBadRequest, "rule_id is required")
+	create := createNATRule{natType: natType, CreateNATRuleRequest: req}
+	if err := create.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	if req.TranslationAddr == "" {
-		writeError(w, http.StatusBadRequest, "translation_address is required")
+
+	b := c.Conf.Batch()
+	created := create.build(b)
+	if !h.commit(w, r, b) {
 		return
 	}
 
-	base := natRulePath(natType, req.RuleID)
+	writeJSON(w, http.StatusCreated, created)
+}
 
-	// translation address is required — use it as the anchor set call.
-	out, _, err := c.Conf.Set(r.Context(), fmt.Sprintf("%s translation address %s", base, req.TranslationAddr))
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
-		return
+// createNATRule is a CreateNATRuleRequest for the NAT type named in the
+// request path.
+type createNATRule struct {
+	natType string
+	CreateNATRuleRequest
+}
+
+func (req createNATRule) validate() error {
+	if !validNATType(req.natType) {
+		return errors.New("nat_type must be 'source' or 'destination'")
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
-		return
+	if req.RuleID == 0 {
+		return errors.New("rule_id is required")
+	}
+	if req.TranslationAddr == "" {
+		return errors.New("translation_address is required")
 	}
+	return nil
+}
 
+func (req createNATRule) build(b *vyos.Batch) interface{} {
+	base := natRulePath(req.natType, req.RuleID)
+
+	b.Set(subPath(base, "translation", "address", req.TranslationAddr))
 	if req.TranslationPort != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s translation port %s", base, req.TranslationPort)) //nolint:errcheck
+		b.Set(subPath(base, "translation", "port", req.TranslationPort))
 	}
 	if req.Description != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s description %s", base, req.Description)) //nolint:errcheck
+		b.Set(subPath(base, "description", req.Description))
 	}
 	if req.Protocol != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s protocol %s", base, req.Protocol)) //nolint:errcheck
+		b.Set(subPath(base, "protocol", req.Protocol))
 	}
 	if req.OutboundIface != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s outbound-interface name %s", base, req.OutboundIface)) //nolint:errcheck
+		b.Set(subPath(base, "outbound-interface", "name", req.OutboundIface))
 	}
 	if req.InboundIface != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s inbound-interface name %s", base, req.InboundIface)) //nolint:errcheck
+		b.Set(subPath(base, "inbound-interface", "name", req.InboundIface))
 	}
 	if req.SourceAddress != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s source address %s", base, req.SourceAddress)) //nolint:errcheck
+		b.Set(subPath(base, "source", "address", req.SourceAddress))
 	}
 	if req.SourcePort != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s source port %s", base, req.SourcePort)) //nolint:errcheck
+		b.Set(subPath(base, "source", "port", req.SourcePort))
 	}
 	if req.DestAddress != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s destination address %s", base, req.DestAddress)) //nolint:errcheck
+		b.Set(subPath(base, "destination", "address", req.DestAddress))
 	}
 	if req.DestPort != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s destination port %s", base, req.DestPort)) //nolint:errcheck
+		b.Set(subPath(base, "destination", "port", req.DestPort))
 	}
-
-	writeJSON(w, http.StatusCreated, NATRuleInfo{
+	return NATRuleInfo{
 		RuleID:          req.RuleID,
-		Type:            natType,
+		Type:            req.natType,
 		Description:     req.Description,
 		OutboundIface:   req.OutboundIface,
 		InboundIface:    req.InboundIface,
@@ -190,7 +197,7 @@ func (h *Handler) CreateNATRule(w http.ResponseWriter, r *http.Request) {
 		DestPort:        req.DestPort,
 		TranslationAddr: req.TranslationAddr,
 		TranslationPort: req.TranslationPort,
-	})
+	}
 }
 
 // GetNATRule handles GET /devices/{device_id}/nat/{nat_type}/rules/{rule_id}.
@@ -211,16 +218,17 @@ func (h *Handler) GetNATRule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	out, _, err := c.Conf.Get(r.Context(), natRulePath(natType, ruleID), nil)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	out, err := c.Conf.GetPath(r.Context(), natRulePath(natType, ruleID))
+	if errors.Is(err, vyos.ErrPathNotFound) {
+		writeError(w, http.StatusNotFound, "NAT rule not found")
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusNotFound, "NAT rule not found")
+	if err != nil {
+		writeDeviceError(w, err)
 		return
 	}
 
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, parseNATRuleData(natType, ruleID, out.Data))
 }
 
@@ -249,52 +257,52 @@ func (h *Handler) UpdateNATRule(w http.ResponseWriter, r *http.Request) {
 	}
 
 	base := natRulePath(natType, ruleID)
+	if !ifMatch(w, r, c, base) {
+		return
+	}
 
+	b := c.Conf.Batch()
 	if req.TranslationAddr != "" {
-		out, _, err := c.Conf.Set(r.Context(), fmt.Sprintf("%s translation address %s", base, req.TranslationAddr))
-		if err != nil {
-			writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
-			return
-		}
-		if !out.Success {
-			writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
-			return
-		}
+		b.Set(subPath(base, "translation", "address", req.TranslationAddr))
 	}
 	if req.TranslationPort != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s translation port %s", base, req.TranslationPort)) //nolint:errcheck
+		b.Set(subPath(base, "translation", "port", req.TranslationPort))
 	}
 	if req.Description != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s description %s", base, req.Description)) //nolint:errcheck
+		b.Set(subPath(base, "description", req.Description))
 	}
 	if req.Protocol != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s protocol %s", base, req.Protocol)) //nolint:errcheck
+		b.Set(subPath(base, "protocol", req.Protocol))
 	}
 	if req.OutboundIface != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s outbound-interface name %s", base, req.OutboundIface)) //nolint:errcheck
+		b.Set(subPath(base, "outbound-interface", "name", req.OutboundIface))
 	}
 	if req.InboundIface != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s inbound-interface name %s", base, req.InboundIface)) //nolint:errcheck
+		b.Set(subPath(base, "inbound-interface", "name", req.InboundIface))
 	}
 	if req.SourceAddress != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s source address %s", base, req.SourceAddress)) //nolint:errcheck
+		b.Set(subPath(base, "source", "address", req.SourceAddress))
 	}
 	if req.SourcePort != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s source port %s", base, req.SourcePort)) //nolint:errcheck
+		b.Set(subPath(base, "source", "port", req.SourcePort))
 	}
 	if req.DestAddress != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s destination address %s", base, req.DestAddress)) //nolint:errcheck
+		b.Set(subPath(base, "destination", "address", req.DestAddress))
 	}
 	if req.DestPort != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s destination port %s", base, req.DestPort)) //nolint:errcheck
+		b.Set(subPath(base, "destination", "port", req.DestPort))
+	}
+	if !h.commit(w, r, b) {
+		return
 	}
 
 	// Return updated state.
-	out, _, err := c.Conf.Get(r.Context(), base, nil)
+	out, err := c.Conf.GetPath(r.Context(), base)
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+		writeDeviceError(w, err)
 		return
 	}
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, parseNATRuleData(natType, ruleID, out.Data))
 }
 
@@ -315,14 +323,11 @@ func (h *Handler) DeleteNATRule(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "rule_id must be an integer")
 		return
 	}
-
-	out, _, err := c.Conf.Delete(r.Context(), natRulePath(natType, ruleID))
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	if !ifMatch(w, r, c, natRulePath(natType, ruleID)) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
+
+	if !h.commit(w, r, c.Conf.Batch().Delete(natRulePath(natType, ruleID))) {
 		return
 	}
 
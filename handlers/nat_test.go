@@ -0,0 +1,138 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/valueiron/vyos-api/vyos"
+)
+
+func TestCreateNATRule_SingleBatch(t *testing.T) {
+	m, _, client := newMockVyOS(t, successResp())
+	h := newHandler(client)
+
+	body := map[string]interface{}{
+		"rule_id":             100,
+		"outbound_interface":  "eth0",
+		"source_address":      "192.168.0.0/24",
+		"translation_address": "masquerade",
+		"description":         "LAN masquerade",
+	}
+	w := do(t, http.MethodPost, "/", body, deviceVars("nat_type", "source"), h.CreateNATRule)
+	assertStatus(t, w, http.StatusCreated)
+
+	// All four fields arrive in the one /configure payload.
+	if len(m.Received) != 4 {
+		t.Fatalf("got %d ops, want 4", len(m.Received))
+	}
+	for _, op := range m.Received {
+		if op.Op != "set" {
+			t.Errorf("op = %q, want set", op.Op)
+		}
+	}
+}
+
+func TestCreateNATRule_RejectedIsAllOrNothing(t *testing.T) {
+	// A rejected batch is discarded by VyOS as a whole, so the handler must
+	// report failure rather than a partially created rule.
+	_, _, client := newMockVyOS(t, failResp("Configuration path: [nat source rule 100 protocol bogus] is not valid"))
+	h := newHandler(client)
+
+	body := map[string]interface{}{
+		"rule_id":             100,
+		"translation_address": "masquerade",
+		"protocol":            "bogus",
+	}
+	w := do(t, http.MethodPost, "/", body, deviceVars("nat_type", "source"), h.CreateNATRule)
+	assertStatus(t, w, http.StatusUnprocessableEntity)
+
+	var result struct {
+		Error      string `json:"error"`
+		Operations []struct {
+			Op     string   `json:"op"`
+			Path   []string `json:"path"`
+			Status string   `json:"status"`
+			Error  string   `json:"error"`
+		} `json:"operations"`
+	}
+	decodeJSON(t, w, &result)
+	if len(result.Operations) != 2 {
+		t.Fatalf("got %d operations, want 2", len(result.Operations))
+	}
+	for _, op := range result.Operations {
+		rejected := op.Path[len(op.Path)-2] == "protocol"
+		switch {
+		case rejected && op.Status != "rejected":
+			t.Errorf("protocol op status = %q, want rejected", op.Status)
+		case rejected && op.Error == "":
+			t.Error("protocol op has no error reason")
+		case !rejected && op.Status != "discarded":
+			t.Errorf("%v status = %q, want discarded", op.Path, op.Status)
+		}
+	}
+}
+
+func TestCreateNATRule_RejectedWithHTTP400(t *testing.T) {
+	// Real devices report a rejected commit as HTTP 400 with the reason in the
+	// envelope; that is still a 422, not a communication error.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(failResp("Commit failed")) //nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	h := newHandler(vyos.NewClient(nil).WithURL(srv.URL).WithToken("testkey"))
+
+	body := map[string]interface{}{"rule_id": 10, "translation_address": "masquerade"}
+	w := do(t, http.MethodPost, "/", body, deviceVars("nat_type", "source"), h.CreateNATRule)
+	assertStatus(t, w, http.StatusUnprocessableEntity)
+}
+
+func TestCreateNATRule_InvalidType(t *testing.T) {
+	_, _, client := newMockVyOS(t)
+	h := newHandler(client)
+	body := map[string]interface{}{"rule_id": 10, "translation_address": "masquerade"}
+	w := do(t, http.MethodPost, "/", body, deviceVars("nat_type", "sideways"), h.CreateNATRule)
+	assertStatus(t, w, http.StatusBadRequest)
+}
+
+func TestListNATRules_NotConfigured(t *testing.T) {
+	// VyOS reports an absent path as a failed read; that is an empty list.
+	_, _, client := newMockVyOS(t, failResp("Configuration under specified path is empty"))
+	h := newHandler(client)
+	w := do(t, http.MethodGet, "/", nil, deviceVars("nat_type", "source"), h.ListNATRules)
+	assertStatus(t, w, http.StatusOK)
+	if body := w.Body.String(); body != "[]\n" {
+		t.Errorf("body = %q, want []", body)
+	}
+}
+
+func TestListNATRules_OtherRejection(t *testing.T) {
+	// Any other failure is no longer mistaken for "not configured".
+	_, _, client := newMockVyOS(t, failResp("Internal error"))
+	h := newHandler(client)
+	w := do(t, http.MethodGet, "/", nil, deviceVars("nat_type", "source"), h.ListNATRules)
+	assertStatus(t, w, http.StatusUnprocessableEntity)
+}
+
+func TestCreateNATRule_ConfigLocked(t *testing.T) {
+	_, _, client := newMockVyOS(t, failResp("Configuration is locked by another session"))
+	h := newHandler(client)
+	body := map[string]interface{}{"rule_id": 10, "translation_address": "masquerade"}
+	w := do(t, http.MethodPost, "/", body, deviceVars("nat_type", "source"), h.CreateNATRule)
+	assertStatus(t, w, http.StatusConflict)
+}
+
+func TestListNATRules_AuthFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(failResp("Valid API key is required")) //nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	h := newHandler(vyos.NewClient(nil).WithURL(srv.URL).WithToken("wrong"))
+
+	w := do(t, http.MethodGet, "/", nil, deviceVars("nat_type", "source"), h.ListNATRules)
+	assertStatus(t, w, http.StatusBadGateway)
+}
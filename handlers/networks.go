@@ -2,10 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/vyos"
 )
 
 // NetworkInfo is the API representation of a VyOS interface with IPv4 addresses.
@@ -59,13 +60,9 @@ func (h *Handler) ListNetworks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	out, _, err := c.Conf.Get(r.Context(), "interfaces", nil)
+	out, err := c.Conf.GetPath(r.Context(), []string{"interfaces"})
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
-		return
-	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
+		writeDeviceError(w, err)
 		return
 	}
 
@@ -87,6 +84,7 @@ func (h *Handler) ListNetworks(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, result)
 }
 
@@ -102,35 +100,39 @@ func (h *Handler) CreateNetwork(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid JSON body")
 		return
 	}
-	if req.Interface == "" || req.Type == "" || req.Address == "" {
-		writeError(w, http.StatusBadRequest, "interface, type, and address are required")
+	if err := req.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	path := fmt.Sprintf("interfaces %s %s address %s", req.Type, req.Interface, req.Address)
-	out, _, err := c.Conf.Set(r.Context(), path)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	b := c.Conf.Batch()
+	created := req.build(b)
+	if !h.commit(w, r, b) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
-		return
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (req CreateNetworkRequest) validate() error {
+	if req.Interface == "" || req.Type == "" || req.Address == "" {
+		return errors.New("interface, type, and address are required")
 	}
+	return nil
+}
 
+func (req CreateNetworkRequest) build(b *vyos.Batch) interface{} {
+	base := []string{"interfaces", req.Type, req.Interface}
+	b.Set(subPath(base, "address", req.Address))
 	if req.Description != "" {
-		descPath := fmt.Sprintf("interfaces %s %s description %s", req.Type, req.Interface, req.Description)
-		if out2, _, err2 := c.Conf.Set(r.Context(), descPath); err2 != nil || !out2.Success {
-			// non-fatal: address was set successfully
-		}
+		b.Set(subPath(base, "description", req.Description))
 	}
-
-	writeJSON(w, http.StatusCreated, NetworkInfo{
+	return NetworkInfo{
 		Interface:   req.Interface,
 		Type:        req.Type,
 		Addresses:   []string{req.Address},
 		Description: req.Description,
-	})
+	}
 }
 
 // GetNetwork handles GET /devices/{device_id}/networks/{interface}.
@@ -147,14 +149,13 @@ func (h *Handler) GetNetwork(w http.ResponseWriter, r *http.Request) {
 		ifType = "ethernet"
 	}
 
-	path := fmt.Sprintf("interfaces %s %s", ifType, iface)
-	out, _, err := c.Conf.Get(r.Context(), path, nil)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	out, err := c.Conf.GetPath(r.Context(), []string{"interfaces", ifType, iface})
+	if errors.Is(err, vyos.ErrPathNotFound) {
+		writeError(w, http.StatusNotFound, "interface not found")
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusNotFound, "interface not found")
+	if err != nil {
+		writeDeviceError(w, err)
 		return
 	}
 
@@ -162,6 +163,7 @@ func (h *Handler) GetNetwork(w http.ResponseWriter, r *http.Request) {
 	addrs := toStringSlice(cfg["address"])
 	desc, _ := cfg["description"].(string)
 
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, NetworkInfo{
 		Interface:   iface,
 		Type:        ifType,
@@ -190,29 +192,33 @@ func (h *Handler) UpdateNetwork(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete existing address block then set the new one.
-	delPath := fmt.Sprintf("interfaces %s %s address", req.Type, iface)
-	if _, _, err := c.Conf.Delete(r.Context(), delPath); err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	base := []string{"interfaces", req.Type, iface}
+	cur, ok := readIfMatch(w, r, c, base)
+	if !ok {
 		return
 	}
 
-	setPath := fmt.Sprintf("interfaces %s %s address %s", req.Type, iface, req.Address)
-	out, _, err := c.Conf.Set(r.Context(), setPath)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
-		return
+	// Replace the existing address block. VyOS rejects deleting a node that
+	// does not exist, which would fail the whole commit, so only delete when
+	// the interface currently has addresses.
+	b := c.Conf.Batch()
+	if cfg, _ := cur.(map[string]interface{}); cfg["address"] != nil {
+		b.Delete(subPath(base, "address"))
+	}
+	b.Set(subPath(base, "address", req.Address))
+	if req.Description != "" {
+		b.Set(subPath(base, "description", req.Description))
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
+	if !h.commit(w, r, b) {
 		return
 	}
 
-	if req.Description != "" {
-		descPath := fmt.Sprintf("interfaces %s %s description %s", req.Type, iface, req.Description)
-		c.Conf.Set(r.Context(), descPath) //nolint:errcheck
+	out, err := c.Conf.GetPath(r.Context(), base)
+	if err != nil {
+		writeDeviceError(w, err)
+		return
 	}
-
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, NetworkInfo{
 		Interface:   iface,
 		Type:        req.Type,
@@ -234,15 +240,12 @@ func (h *Handler) DeleteNetwork(w http.ResponseWriter, r *http.Request) {
 	if ifType == "" {
 		ifType = "ethernet"
 	}
-
-	path := fmt.Sprintf("interfaces %s %s", ifType, iface)
-	out, _, err := c.Conf.Delete(r.Context(), path)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	base := []string{"interfaces", ifType, iface}
+	if !ifMatch(w, r, c, base) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
+
+	if !h.commit(w, r, c.Conf.Batch().Delete(base)) {
 		return
 	}
 
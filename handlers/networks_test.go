@@ -2,6 +2,7 @@ package handlers_test
 
 import (
 	"net/http"
+	"reflect"
 	"testing"
 )
 
@@ -130,6 +131,29 @@ func TestCreateNetwork_OK(t *testing.T) {
 	}
 }
 
+func TestCreateNetwork_DescriptionWithSpaces(t *testing.T) {
+	m, _, client := newMockVyOS(t, successResp(), successResp())
+	h := newHandler(client)
+
+	body := map[string]string{
+		"interface":   "eth0",
+		"type":        "ethernet",
+		"address":     "192.168.1.1/24",
+		"description": `uplink to "core" – rack 4`,
+	}
+	w := do(t, http.MethodPost, "/", body, deviceVars(), h.CreateNetwork)
+	assertStatus(t, w, http.StatusCreated)
+
+	if len(m.Received) != 2 {
+		t.Fatalf("got %d device ops, want 2", len(m.Received))
+	}
+	want := []string{"interfaces", "ethernet", "eth0", "description", `uplink to "core" – rack 4`}
+	got := m.Received[1].Path
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("description path = %q, want %q", got, want)
+	}
+}
+
 func TestCreateNetwork_MissingFields(t *testing.T) {
 	_, _, client := newMockVyOS(t)
 	h := newHandler(client)
@@ -204,8 +228,13 @@ func TestGetNetwork_NotFound(t *testing.T) {
 // --------------------------------------------------------------------------
 
 func TestUpdateNetwork_OK(t *testing.T) {
-	// Two VyOS calls: Delete (old address) then Set (new address).
-	_, _, client := newMockVyOS(t, successResp(), successResp())
+	// Get the current interface, then one batch: Delete (old address) + Set
+	// (new address), then the re-read for the ETag.
+	m, _, client := newMockVyOS(t,
+		dataResp(map[string]interface{}{"address": "10.0.0.9/24"}),
+		successResp(),
+		dataResp(map[string]interface{}{"address": "10.0.0.1/24"}),
+	)
 	h := newHandler(client)
 
 	body := map[string]string{"type": "ethernet", "address": "10.0.0.1/24"}
@@ -213,6 +242,48 @@ func TestUpdateNetwork_OK(t *testing.T) {
 		deviceVars("interface", "eth0"),
 		h.UpdateNetwork)
 	assertStatus(t, w, http.StatusOK)
+	if w.Header().Get("ETag") == "" {
+		t.Error("update response has no ETag")
+	}
+
+	// Received holds the Get, each op of the batch, then the re-read.
+	if len(m.Received) != 4 {
+		t.Fatalf("got %d device ops, want 4", len(m.Received))
+	}
+	if m.Received[1].Op != "delete" || m.Received[2].Op != "set" || m.Received[3].Op != "showConfig" {
+		t.Errorf("ops = %+v; want showConfig, delete, set, showConfig", m.Received)
+	}
+}
+
+func TestUpdateNetwork_IfMatchReadsOnce(t *testing.T) {
+	cur := map[string]interface{}{"address": "10.0.0.9/24"}
+	_, _, client := newMockVyOS(t, dataResp(cur))
+	w := do(t, http.MethodGet, "/", nil, deviceVars("interface", "eth0"), newHandler(client).GetNetwork)
+	tag := w.Header().Get("ETag")
+
+	m, _, client := newMockVyOS(t, dataResp(cur), successResp(), dataResp(map[string]interface{}{"address": "10.0.0.1/24"}))
+	h := newHandler(client)
+	w = doIfMatch(t, http.MethodPut, tag, map[string]string{"type": "ethernet", "address": "10.0.0.1/24"}, deviceVars("interface", "eth0"), h.UpdateNetwork)
+	assertStatus(t, w, http.StatusOK)
+	if len(m.Received) != 4 || m.Received[1].Op != "delete" {
+		t.Errorf("ops = %+v; want one read before the batch", m.Received)
+	}
+}
+
+func TestUpdateNetwork_NoExistingAddress(t *testing.T) {
+	// Deleting a missing node would fail the commit, so no Delete is queued.
+	m, _, client := newMockVyOS(t, dataResp(map[string]interface{}{}), successResp())
+	h := newHandler(client)
+
+	body := map[string]string{"type": "ethernet", "address": "10.0.0.1/24"}
+	w := do(t, http.MethodPut, "/", body,
+		deviceVars("interface", "eth0"),
+		h.UpdateNetwork)
+	assertStatus(t, w, http.StatusOK)
+
+	if len(m.Received) != 3 || m.Received[1].Op != "set" {
+		t.Errorf("received = %+v, want Get, a single set, then the re-read", m.Received)
+	}
 }
 
 func TestUpdateNetwork_MissingFields(t *testing.T) {
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/valueiron/vyos-api/vyos"
+)
+
+// Plan is returned instead of committing when a mutation is sent with
+// dry_run=true or Prefer: return=plan.
+type Plan struct {
+	// Operations are the set and delete operations the request would send,
+	// in order, with secret values redacted.
+	Operations     []vyos.Op `json:"operations"`
+	ConfirmMinutes int       `json:"confirm_minutes,omitempty"`
+	// Changes are the configuration subtrees the operations touch.
+	Changes []PlanChange `json:"changes"`
+}
+
+// PlanChange is the configuration under Path as read from the device and as
+// predicted after the operations, with secrets redacted. A nil Before or
+// After means the node does not, or would no longer, exist.
+type PlanChange struct {
+	Path   []string    `json:"path"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// preferPlan is the Prefer header preference that asks for a plan.
+const preferPlan = "return=plan"
+
+// dryRun reports whether r asks for a plan instead of a commit, with a
+// dry_run query parameter or a Prefer: return=plan header. It writes a 400
+// and returns false if dry_run is not a boolean.
+func dryRun(w http.ResponseWriter, r *http.Request) (plan, ok bool) {
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		plan, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "dry_run must be true or false")
+			return false, false
+		}
+		if plan {
+			return true, true
+		}
+	}
+	return preferred(r, preferPlan), true
+}
+
+// wantsPlan reports whether r asks for a plan, as dryRun does, but without
+// writing an error: an invalid dry_run value counts as no and is left for
+// dryRun to reject.
+func wantsPlan(r *http.Request) bool {
+	if plan, err := strconv.ParseBool(r.URL.Query().Get("dry_run")); err == nil && plan {
+		return true
+	}
+	return preferred(r, preferPlan)
+}
+
+// preferred reports whether the Prefer headers of r include pref.
+func preferred(r *http.Request, pref string) bool {
+	for _, h := range r.Header.Values("Prefer") {
+		for _, p := range strings.Split(h, ",") {
+			p, _, _ = strings.Cut(p, ";")
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.EqualFold(k+"="+strings.Trim(v, `"`), pref) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// noDryRun writes a 400 and returns false if r asks for a plan, for the
+// mutations that do not send set and delete operations and so have none to
+// show.
+func noDryRun(w http.ResponseWriter, r *http.Request) bool {
+	plan, ok := dryRun(w, r)
+	if ok && plan {
+		writeError(w, http.StatusBadRequest, "dry_run is not supported for this endpoint")
+		return false
+	}
+	return ok
+}
+
+// changePath returns the node whose configuration op changes: the node
+// holding the value of a set, or the parent of a deleted node.
+func changePath(op vyos.Op) []string {
+	n := len(op.Path) - 1
+	if op.Op == "set" {
+		n--
+	}
+	return op.Path[:max(n, 0)]
+}
+
+// planGroup is a subtree of a plan and the operations under it.
+type planGroup struct {
+	path []string
+	ops  []vyos.Op
+}
+
+// planGroups splits ops by the first minSnapshotDepth nodes they change,
+// so that, as with audit snapshots, operations in unrelated sections are
+// shown as separate subtrees rather than under a shared root. Each group's
+// path is the deepest node all of its operations change.
+func planGroups(ops []vyos.Op) []*planGroup {
+	var groups []*planGroup
+	byKey := map[string]*planGroup{}
+	for _, op := range ops {
+		p := changePath(op)
+		key := strings.Join(p[:min(len(p), minSnapshotDepth)], " ")
+		g, ok := byKey[key]
+		if !ok {
+			g = &planGroup{path: p}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		n := 0
+		for n < len(g.path) && n < len(p) && g.path[n] == p[n] {
+			n++
+		}
+		g.path = g.path[:n]
+		g.ops = append(g.ops, op)
+	}
+	return groups
+}
+
+// writePlan writes the plan for b: its operations, and each subtree they
+// change as read from the device and as predicted afterwards. Nothing is
+// sent to /configure. The prediction is vyos.Predict's.
+func (h *Handler) writePlan(w http.ResponseWriter, r *http.Request, b *vyos.Batch, confirmMinutes int) {
+	d, ok := h.getDevice(w, r)
+	if !ok {
+		return
+	}
+	plan := Plan{Operations: redactOps(b.Ops()), ConfirmMinutes: confirmMinutes, Changes: []PlanChange{}}
+	for _, g := range planGroups(b.Ops()) {
+		var before interface{}
+		resp, err := d.Client.Conf.GetPath(r.Context(), g.path)
+		switch {
+		case errors.Is(err, vyos.ErrPathNotFound):
+		case err != nil:
+			writeDeviceError(w, err)
+			return
+		default:
+			before = resp.Data
+		}
+		change := PlanChange{Path: vyos.RedactPath(g.path)}
+		if before != nil {
+			change.Before = vyos.RedactConfig(g.path, before)
+		}
+		if after := vyos.Predict(g.path, before, g.ops); after != nil {
+			change.After = vyos.RedactConfig(g.path, after)
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	if preferred(r, preferPlan) {
+		w.Header().Set("Preference-Applied", preferPlan)
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
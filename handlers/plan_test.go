@@ -0,0 +1,120 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/handlers"
+)
+
+// assertNotConfigured fails the test if m received any set or delete.
+func assertNotConfigured(t *testing.T, m *mockVyOS) {
+	t.Helper()
+	for _, req := range m.Received {
+		if req.Op == "set" || req.Op == "delete" {
+			t.Errorf("device got %s %v", req.Op, req.Path)
+		}
+	}
+}
+
+func TestDryRun_Create(t *testing.T) {
+	m, _, client := newMockVyOS(t, failResp("Configuration under specified path is empty"))
+	h := newHandler(client)
+
+	body := map[string]string{"name": "BLUE", "table": "100"}
+	w := do(t, http.MethodPost, "/?dry_run=true&confirm_minutes=5", body, deviceVars(), h.CreateVRF)
+	assertStatus(t, w, http.StatusOK)
+	assertNotConfigured(t, m)
+
+	var plan handlers.Plan
+	decodeJSON(t, w, &plan)
+	if len(plan.Operations) != 1 || strings.Join(plan.Operations[0].Path, " ") != "vrf name BLUE table 100" {
+		t.Errorf("operations = %+v", plan.Operations)
+	}
+	if plan.ConfirmMinutes != 5 {
+		t.Errorf("confirm_minutes = %d, want 5", plan.ConfirmMinutes)
+	}
+	if len(plan.Changes) != 1 {
+		t.Fatalf("got %d changes, want 1", len(plan.Changes))
+	}
+	c := plan.Changes[0]
+	want := map[string]interface{}{"table": "100"}
+	if strings.Join(c.Path, " ") != "vrf name BLUE" || c.Before != nil || !reflect.DeepEqual(c.After, want) {
+		t.Errorf("change = %+v", c)
+	}
+}
+
+func TestDryRun_PreferDelete(t *testing.T) {
+	m, _, client := newMockVyOS(t, dataResp(map[string]interface{}{"BLUE": map[string]interface{}{"table": "100"}}))
+	h := newHandler(client)
+
+	r := httptest.NewRequest(http.MethodDelete, "/", nil)
+	r.Header.Set("Prefer", "handling=strict, return=plan")
+	w := httptest.NewRecorder()
+	h.DeleteVRF(w, mux.SetURLVars(r, deviceVars("vrf", "BLUE")))
+	assertStatus(t, w, http.StatusOK)
+	assertNotConfigured(t, m)
+	if got := w.Header().Get("Preference-Applied"); got != "return=plan" {
+		t.Errorf("Preference-Applied = %q", got)
+	}
+
+	var plan handlers.Plan
+	decodeJSON(t, w, &plan)
+	if len(plan.Changes) != 1 || plan.Changes[0].Before == nil || plan.Changes[0].After != nil {
+		t.Errorf("changes = %+v, want the VRF removed", plan.Changes)
+	}
+}
+
+func TestDryRun_Transaction(t *testing.T) {
+	m, _, client := newMockVyOS(t, failResp("Configuration under specified path is empty"))
+	h := newHandler(client)
+
+	w := do(t, http.MethodPost, "/?dry_run=1", tenant, deviceVars(), h.Transaction)
+	assertStatus(t, w, http.StatusOK)
+	assertNotConfigured(t, m)
+
+	var plan handlers.Plan
+	decodeJSON(t, w, &plan)
+	var paths []string
+	for _, c := range plan.Changes {
+		paths = append(paths, strings.Join(c.Path, " "))
+	}
+	want := []string{"vrf name BLUE", "interfaces ethernet eth1 vif 10", "nat source rule 100"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("change paths = %q, want %q", paths, want)
+	}
+	if plan.Changes[0].Before != nil || plan.Changes[0].After == nil {
+		t.Errorf("vrf change = %+v, want created", plan.Changes[0])
+	}
+}
+
+func TestDryRun_RedactsSecrets(t *testing.T) {
+	_, _, client := newMockVyOS(t, failResp("Configuration under specified path is empty"))
+	h := newHandler(client)
+
+	body := map[string]interface{}{"operations": []map[string]interface{}{
+		{"op": "set", "path": []string{"system", "login", "user", "alice", "authentication", "plaintext-password", "hunter2"}},
+	}}
+	w := do(t, http.MethodPost, "/?dry_run=true", body, deviceVars(), h.BatchConfig)
+	assertStatus(t, w, http.StatusOK)
+	if strings.Contains(w.Body.String(), "hunter2") {
+		t.Errorf("plan leaks the password: %s", w.Body.String())
+	}
+}
+
+func TestDryRun_Unsupported(t *testing.T) {
+	m, _, client := newMockVyOS(t)
+	h := newHandler(client)
+
+	w := do(t, http.MethodPost, "/?dry_run=true", map[string]string{}, deviceVars(), h.SaveConfig)
+	assertStatus(t, w, http.StatusBadRequest)
+	w = do(t, http.MethodDelete, "/?dry_run=maybe", nil, deviceVars("vrf", "BLUE"), h.DeleteVRF)
+	assertStatus(t, w, http.StatusBadRequest)
+	if len(m.Received) != 0 {
+		t.Errorf("device got %d requests, want none", len(m.Received))
+	}
+}
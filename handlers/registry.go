@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"sort"
+	"sync"
+)
+
+// Registry is the set of devices the service can reach. It is safe for
+// concurrent use and can be swapped wholesale at runtime (see Replace), so
+// devices can be reloaded without restarting the process.
+type Registry struct {
+	mu      sync.RWMutex
+	devices map[string]*Device
+	// overrides holds the changes made through Override, nil for a removed
+	// device, and is applied on top of every Replace.
+	overrides map[string]*Device
+}
+
+// NewRegistry returns a Registry holding devices (keyed by device ID).
+func NewRegistry(devices map[string]*Device) *Registry {
+	if devices == nil {
+		devices = map[string]*Device{}
+	}
+	return &Registry{devices: devices}
+}
+
+// Get returns the device with the given ID.
+func (reg *Registry) Get(id string) (*Device, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	d, ok := reg.devices[id]
+	return d, ok
+}
+
+// List returns all devices sorted by ID.
+func (reg *Registry) List() []*Device {
+	reg.mu.RLock()
+	out := make([]*Device, 0, len(reg.devices))
+	for _, d := range reg.devices {
+		out = append(out, d)
+	}
+	reg.mu.RUnlock()
+	sortDevices(out)
+	return out
+}
+
+func sortDevices(devices []*Device) {
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+}
+
+// Put registers d, replacing any device with the same ID. It reports whether
+// a device was replaced.
+func (reg *Registry) Put(d *Device) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	_, replaced := reg.devices[d.ID]
+	reg.devices[d.ID] = d
+	return replaced
+}
+
+// Delete removes the device with the given ID, reporting whether it existed.
+func (reg *Registry) Delete(id string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	_, ok := reg.devices[id]
+	delete(reg.devices, id)
+	return ok
+}
+
+// Override registers d under id, or removes the device with that ID if d is
+// nil, like Put and Delete, and keeps doing so across later calls to
+// Replace. It is for runtime changes that are not written to the file
+// Replace loads from, so a reload does not undo them.
+func (reg *Registry) Override(id string, d *Device) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.overrides == nil {
+		reg.overrides = map[string]*Device{}
+	}
+	reg.overrides[id] = d
+	if d == nil {
+		delete(reg.devices, id)
+	} else {
+		reg.devices[id] = d
+	}
+}
+
+// Replace swaps in a new device set. A device whose settings are unchanged
+// keeps its existing *Device, and with it the client's open connections.
+// Requests already running hold their own *Device and finish against it,
+// even if that device was changed or removed.
+func (reg *Registry) Replace(devices map[string]*Device) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	next := make(map[string]*Device, len(devices))
+	for id, d := range devices {
+		if old, ok := reg.devices[id]; ok && old.spec != "" && old.spec == d.spec {
+			d = old
+		}
+		next[id] = d
+	}
+	for id, d := range reg.overrides {
+		if d == nil {
+			delete(next, id)
+		} else {
+			next[id] = d
+		}
+	}
+	reg.devices = next
+}
@@ -2,11 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
-	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/vyos"
 )
 
 // RouteInfo is the API representation of a VyOS static route.
@@ -36,8 +36,8 @@ func routeNetwork(vars map[string]string) string {
 	return vars["prefix"] + "/" + vars["mask"]
 }
 
-func routeBasePath(network string) string {
-	return fmt.Sprintf("protocols static route %s", network)
+func routeBasePath(network string) []string {
+	return []string{"protocols", "static", "route", network}
 }
 
 // ListRoutes handles GET /devices/{device_id}/routes.
@@ -47,31 +47,24 @@ func (h *Handler) ListRoutes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	out, _, err := c.Conf.Get(r.Context(), "protocols static route", nil)
-	if err != nil {
-		if strings.Contains(err.Error(), "unexpected status 400") {
-			writeJSON(w, http.StatusOK, []RouteInfo{})
-			return
-		}
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	out, err := c.Conf.GetPath(r.Context(), []string{"protocols", "static", "route"})
+	// A missing path means no static routes are configured yet.
+	if err != nil && !errors.Is(err, vyos.ErrPathNotFound) {
+		writeDeviceError(w, err)
 		return
 	}
 
 	result := []RouteInfo{}
-	if out.Success {
-		rawMap, _ := out.Data.(map[string]interface{})
-		routeMap := rawMap
-		if inner, ok := rawMap["route"].(map[string]interface{}); ok {
-			routeMap = inner
-		}
-		for network, rData := range routeMap {
-			result = append(result, parseRouteData(network, rData))
-		}
-	} else if !strings.Contains(errMsg(out.Error), "empty") {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
-		return
+	rawMap, _ := out.Data.(map[string]interface{})
+	routeMap := rawMap
+	if inner, ok := rawMap["route"].(map[string]interface{}); ok {
+		routeMap = inner
+	}
+	for network, rData := range routeMap {
+		result = append(result, parseRouteData(network, rData))
 	}
 
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, result)
 }
 
@@ -87,37 +80,44 @@ func (h *Handler) CreateRoute(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid JSON body")
 		return
 	}
-	if req.Network == "" || req.NextHop == "" {
-		writeError(w, http.StatusBadRequest, "network and next_hop are required")
+	if err := req.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	base := routeBasePath(req.Network)
-	nhPath := fmt.Sprintf("%s next-hop %s", base, req.NextHop)
-
-	out, _, err := c.Conf.Set(r.Context(), nhPath)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	b := c.Conf.Batch()
+	created := req.build(b)
+	if !h.commit(w, r, b) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
-		return
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (req CreateRouteRequest) validate() error {
+	if req.Network == "" || req.NextHop == "" {
+		return errors.New("network and next_hop are required")
 	}
+	return nil
+}
 
+func (req CreateRouteRequest) build(b *vyos.Batch) interface{} {
+	base := routeBasePath(req.Network)
+	nhPath := subPath(base, "next-hop", req.NextHop)
+
+	b.Set(nhPath)
 	if req.Distance != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s distance %s", nhPath, req.Distance)) //nolint:errcheck
+		b.Set(subPath(nhPath, "distance", req.Distance))
 	}
 	if req.Description != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s description %s", base, req.Description)) //nolint:errcheck
+		b.Set(subPath(base, "description", req.Description))
 	}
-
-	writeJSON(w, http.StatusCreated, RouteInfo{
+	return RouteInfo{
 		Network:     req.Network,
 		NextHop:     req.NextHop,
 		Distance:    req.Distance,
 		Description: req.Description,
-	})
+	}
 }
 
 // GetRoute handles GET /devices/{device_id}/routes/{prefix}/{mask}.
@@ -128,16 +128,17 @@ func (h *Handler) GetRoute(w http.ResponseWriter, r *http.Request) {
 	}
 
 	network := routeNetwork(mux.Vars(r))
-	out, _, err := c.Conf.Get(r.Context(), routeBasePath(network), nil)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	out, err := c.Conf.GetPath(r.Context(), routeBasePath(network))
+	if errors.Is(err, vyos.ErrPathNotFound) {
+		writeError(w, http.StatusNotFound, "route not found")
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusNotFound, "route not found")
+	if err != nil {
+		writeDeviceError(w, err)
 		return
 	}
 
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, parseRouteData(network, out.Data))
 }
 
@@ -157,30 +158,31 @@ func (h *Handler) UpdateRoute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !ifMatch(w, r, c, base) {
+		return
+	}
+
+	b := c.Conf.Batch()
 	if req.NextHop != "" {
-		nhPath := fmt.Sprintf("%s next-hop %s", base, req.NextHop)
-		out, _, err := c.Conf.Set(r.Context(), nhPath)
-		if err != nil {
-			writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
-			return
-		}
-		if !out.Success {
-			writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
-			return
-		}
+		nhPath := subPath(base, "next-hop", req.NextHop)
+		b.Set(nhPath)
 		if req.Distance != "" {
-			c.Conf.Set(r.Context(), fmt.Sprintf("%s distance %s", nhPath, req.Distance)) //nolint:errcheck
+			b.Set(subPath(nhPath, "distance", req.Distance))
 		}
 	}
 	if req.Description != "" {
-		c.Conf.Set(r.Context(), fmt.Sprintf("%s description %s", base, req.Description)) //nolint:errcheck
+		b.Set(subPath(base, "description", req.Description))
+	}
+	if !h.commit(w, r, b) {
+		return
 	}
 
-	out, _, err := c.Conf.Get(r.Context(), base, nil)
+	out, err := c.Conf.GetPath(r.Context(), base)
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+		writeDeviceError(w, err)
 		return
 	}
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, parseRouteData(network, out.Data))
 }
 
@@ -192,13 +194,10 @@ func (h *Handler) DeleteRoute(w http.ResponseWriter, r *http.Request) {
 	}
 
 	network := routeNetwork(mux.Vars(r))
-	out, _, err := c.Conf.Delete(r.Context(), routeBasePath(network))
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	if !ifMatch(w, r, c, routeBasePath(network)) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+errMsg(out.Error))
+	if !h.commit(w, r, c.Conf.Batch().Delete(routeBasePath(network))) {
 		return
 	}
 
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/auth"
+	"github.com/valueiron/vyos-api/logctx"
+	"github.com/valueiron/vyos-api/snapshot"
+	"github.com/valueiron/vyos-api/vyos"
+)
+
+// runningConfig names the device's live configuration in place of a
+// snapshot ID in a diff.
+const runningConfig = "running"
+
+// CreateSnapshotRequest is the optional JSON body for
+// POST /devices/{device_id}/snapshots.
+type CreateSnapshotRequest struct {
+	Description string `json:"description,omitempty"`
+}
+
+// SnapshotDiff is returned by the diff endpoint.
+type SnapshotDiff struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Operations turn From's configuration into To's, with secret values
+	// redacted.
+	Operations []vyos.Op `json:"operations"`
+}
+
+// SnapshotRestore is returned by the restore endpoint.
+type SnapshotRestore struct {
+	Snapshot string `json:"snapshot"`
+	// Operations are the ones committed, with secret values redacted.
+	Operations []vyos.Op `json:"operations"`
+}
+
+// SetSnapshots keeps snapshots of device configurations in s: on request,
+// from RunSnapshots, and before every change sent through the handlers.
+func (h *Handler) SetSnapshots(s *snapshot.Store) {
+	h.snapshots = s
+}
+
+// storeSnapshot saves snap, recording the caller and request ID of r if it
+// is not nil.
+func (h *Handler) storeSnapshot(r *http.Request, snap *snapshot.Snapshot) error {
+	if r != nil {
+		snap.RequestID = logctx.RequestID(r.Context())
+		if pr, ok := auth.PrincipalFrom(r.Context()); ok {
+			snap.Principal = pr.Name
+		}
+	}
+	err := h.snapshots.Save(snap)
+	countSnapshot(snap.Device, snap.Trigger, err)
+	return err
+}
+
+// countSnapshot records a snapshot attempt that failed with err, or
+// succeeded if it is nil.
+func countSnapshot(device, trigger string, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	snapshotsTaken.WithLabelValues(device, trigger, outcome).Inc()
+}
+
+// readConfig returns the configuration at path, or an empty tree if there
+// is none.
+func readConfig(ctx context.Context, c *vyos.Client, path []string) (interface{}, error) {
+	resp, err := c.Conf.GetPath(ctx, path)
+	if errors.Is(err, vyos.ErrPathNotFound) {
+		return map[string]interface{}{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return map[string]interface{}{}, nil
+	}
+	return resp.Data, nil
+}
+
+// snapshotBefore takes a pre-change snapshot of the request's device, if
+// snapshots are on. A failure is logged rather than blocking the change.
+func (h *Handler) snapshotBefore(r *http.Request) {
+	if h.snapshots == nil {
+		return
+	}
+	d, ok := h.devices.Get(mux.Vars(r)["device_id"])
+	if !ok {
+		return
+	}
+	config, err := readConfig(r.Context(), d.Client, nil)
+	if err != nil {
+		countSnapshot(d.ID, snapshot.PreChange, err)
+	} else {
+		meta := snapshot.Meta{Device: d.ID, Trigger: snapshot.PreChange, Request: r.Method + " " + r.URL.Path}
+		err = h.storeSnapshot(r, &snapshot.Snapshot{Meta: meta, Config: config})
+	}
+	if err != nil {
+		logctx.From(r.Context()).Warn("pre-change snapshot failed", "error", err)
+	}
+}
+
+// RunSnapshots snapshots every registered device each interval until ctx is
+// cancelled. A scheduled snapshot is skipped when the configuration is the
+// same as the device's latest snapshot.
+func (h *Handler) RunSnapshots(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, d := range h.devices.List() {
+			if err := h.scheduledSnapshot(ctx, d); err != nil {
+				slog.Warn("scheduled snapshot failed", "device", d.ID, "error", err)
+			}
+		}
+	}
+}
+
+func (h *Handler) scheduledSnapshot(ctx context.Context, d *Device) error {
+	config, err := readConfig(ctx, d.Client, nil)
+	if err != nil {
+		countSnapshot(d.ID, snapshot.Scheduled, err)
+		return err
+	}
+	metas, err := h.snapshots.List(d.ID)
+	if err != nil {
+		return err
+	}
+	if n := len(metas); n > 0 && metas[n-1].Digest == snapshot.Digest(config) {
+		snapshotsTaken.WithLabelValues(d.ID, snapshot.Scheduled, "unchanged").Inc()
+		return nil
+	}
+	return h.storeSnapshot(nil, &snapshot.Snapshot{Meta: snapshot.Meta{Device: d.ID, Trigger: snapshot.Scheduled}, Config: config})
+}
+
+// getSnapshots writes a 404 and returns false if snapshots are off.
+func (h *Handler) getSnapshots(w http.ResponseWriter) bool {
+	if h.snapshots == nil {
+		writeError(w, http.StatusNotFound, "snapshots not enabled")
+		return false
+	}
+	return true
+}
+
+// getSnapshot loads the snapshot named by the snapshot_id path variable,
+// writing the error response if it cannot.
+func (h *Handler) getSnapshot(w http.ResponseWriter, r *http.Request, d *Device) (*snapshot.Snapshot, bool) {
+	id := mux.Vars(r)["snapshot_id"]
+	snap, err := h.snapshots.Get(d.ID, id)
+	if errors.Is(err, snapshot.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "snapshot not found: "+id)
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "reading snapshot: "+err.Error())
+		return nil, false
+	}
+	return snap, true
+}
+
+// redactOps returns ops with secret values redacted, for responses.
+func redactOps(ops []vyos.Op) []vyos.Op {
+	out := make([]vyos.Op, len(ops))
+	for i, op := range ops {
+		out[i] = vyos.Op{Op: op.Op, Path: vyos.RedactPath(op.Path)}
+	}
+	return out
+}
+
+// ListSnapshots handles GET /devices/{device_id}/snapshots.
+// Returns the device's snapshots, oldest first, without their configuration.
+func (h *Handler) ListSnapshots(w http.ResponseWriter, r *http.Request) {
+	d, ok := h.getDevice(w, r)
+	if !ok || !h.getSnapshots(w) {
+		return
+	}
+	metas, err := h.snapshots.List(d.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "listing snapshots: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, metas)
+}
+
+// CreateSnapshot handles POST /devices/{device_id}/snapshots.
+// Takes a snapshot of the device's full configuration. The body is optional.
+func (h *Handler) CreateSnapshot(w http.ResponseWriter, r *http.Request) {
+	d, ok := h.getDevice(w, r)
+	if !ok || !h.getSnapshots(w) {
+		return
+	}
+	if !noDryRun(w, r) {
+		return
+	}
+
+	var req CreateSnapshotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	config, err := readConfig(r.Context(), d.Client, nil)
+	if err != nil {
+		countSnapshot(d.ID, snapshot.Manual, err)
+		writeDeviceError(w, err)
+		return
+	}
+	snap := &snapshot.Snapshot{Meta: snapshot.Meta{Device: d.ID, Trigger: snapshot.Manual, Description: req.Description}, Config: config}
+	if err := h.storeSnapshot(r, snap); err != nil {
+		writeError(w, http.StatusInternalServerError, "saving snapshot: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, snap.Meta)
+}
+
+// GetSnapshot handles GET /devices/{device_id}/snapshots/{snapshot_id}.
+// Returns the snapshot with its configuration, secrets redacted.
+func (h *Handler) GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	d, ok := h.getDevice(w, r)
+	if !ok || !h.getSnapshots(w) {
+		return
+	}
+	snap, ok := h.getSnapshot(w, r, d)
+	if !ok {
+		return
+	}
+	snap.Config = vyos.RedactConfig(nil, snap.Config)
+	writeJSON(w, http.StatusOK, snap)
+}
+
+// DiffSnapshot handles GET /devices/{device_id}/snapshots/{snapshot_id}/diff.
+// Returns the operations that turn the snapshot's configuration into that of
+// the snapshot named by the to query parameter, or by default the device's
+// running configuration.
+func (h *Handler) DiffSnapshot(w http.ResponseWriter, r *http.Request) {
+	d, ok := h.getDevice(w, r)
+	if !ok || !h.getSnapshots(w) {
+		return
+	}
+	from, ok := h.getSnapshot(w, r, d)
+	if !ok {
+		return
+	}
+
+	to := r.URL.Query().Get("to")
+	var config interface{}
+	switch to {
+	case "", runningConfig:
+		to = runningConfig
+		var err error
+		if config, err = readConfig(r.Context(), d.Client, nil); err != nil {
+			writeDeviceError(w, err)
+			return
+		}
+	default:
+		snap, err := h.snapshots.Get(d.ID, to)
+		if errors.Is(err, snapshot.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "snapshot not found: "+to)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "reading snapshot: "+err.Error())
+			return
+		}
+		config = snap.Config
+	}
+
+	ops := vyos.Diff(nil, from.Config, config)
+	writeJSON(w, http.StatusOK, SnapshotDiff{From: from.ID, To: to, Operations: redactOps(ops)})
+}
+
+// RestoreSnapshot handles POST /devices/{device_id}/snapshots/{snapshot_id}/restore.
+// Compares the running configuration with the snapshot and commits the set
+// and delete operations that return the device to it, as one batch.
+func (h *Handler) RestoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	d, ok := h.getDevice(w, r)
+	if !ok || !h.getSnapshots(w) {
+		return
+	}
+	snap, ok := h.getSnapshot(w, r, d)
+	if !ok {
+		return
+	}
+
+	running, err := readConfig(r.Context(), d.Client, nil)
+	if err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+	b := d.Client.Conf.Batch()
+	for _, op := range vyos.Diff(nil, running, snap.Config) {
+		if op.Op == "delete" {
+			b.Delete(op.Path)
+		} else {
+			b.Set(op.Path)
+		}
+	}
+	if !h.commit(w, r, b) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SnapshotRestore{Snapshot: snap.ID, Operations: redactOps(b.Ops())})
+}
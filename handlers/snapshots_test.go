@@ -0,0 +1,166 @@
+package handlers_test
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/valueiron/vyos-api/handlers"
+	"github.com/valueiron/vyos-api/snapshot"
+	"github.com/valueiron/vyos-api/vyos"
+)
+
+func newSnapshotStore(t *testing.T, h *handlers.Handler) *snapshot.Store {
+	t.Helper()
+	s, err := snapshot.Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetSnapshots(s)
+	return s
+}
+
+// saveSnapshot stores a manual snapshot of config for router1.
+func saveSnapshot(t *testing.T, s *snapshot.Store, config map[string]interface{}) string {
+	t.Helper()
+	snap := &snapshot.Snapshot{Meta: snapshot.Meta{Device: "router1", Trigger: snapshot.Manual}, Config: config}
+	if err := s.Save(snap); err != nil {
+		t.Fatal(err)
+	}
+	return snap.ID
+}
+
+func TestSnapshots_CreateGet(t *testing.T) {
+	config := map[string]interface{}{
+		"system": map[string]interface{}{"host-name": "r1", "login": map[string]interface{}{"user": map[string]interface{}{"alice": map[string]interface{}{
+			"authentication": map[string]interface{}{"plaintext-password": "hunter2"},
+		}}}},
+	}
+	_, _, client := newMockVyOS(t, dataResp(config))
+	h := newHandler(client)
+	s := newSnapshotStore(t, h)
+
+	w := do(t, http.MethodPost, "/", map[string]string{"description": "before upgrade"}, deviceVars(), h.CreateSnapshot)
+	assertStatus(t, w, http.StatusCreated)
+	var meta snapshot.Meta
+	decodeJSON(t, w, &meta)
+	if meta.Trigger != snapshot.Manual || meta.Description != "before upgrade" || meta.ID == "" {
+		t.Errorf("meta = %+v", meta)
+	}
+	if metas, _ := s.List("router1"); len(metas) != 1 {
+		t.Errorf("store holds %d snapshots, want 1", len(metas))
+	}
+
+	w = do(t, http.MethodGet, "/", nil, deviceVars("snapshot_id", meta.ID), h.GetSnapshot)
+	assertStatus(t, w, http.StatusOK)
+	if strings.Contains(w.Body.String(), "hunter2") || !strings.Contains(w.Body.String(), `"host-name":"r1"`) {
+		t.Errorf("snapshot body = %s", w.Body.String())
+	}
+
+	w = do(t, http.MethodGet, "/", nil, deviceVars("snapshot_id", "20240101T000000.000000Z-00000000"), h.GetSnapshot)
+	assertStatus(t, w, http.StatusNotFound)
+}
+
+func TestSnapshots_PreChange(t *testing.T) {
+	m, _, client := newMockVyOS(t, dataResp(map[string]interface{}{"vrf": map[string]interface{}{}}))
+	h := newHandler(client)
+	s := newSnapshotStore(t, h)
+
+	w := do(t, http.MethodPost, "/", map[string]string{"name": "BLUE", "table": "100"}, deviceVars(), h.CreateVRF)
+	assertStatus(t, w, http.StatusCreated)
+	if m.Received[0].Op != "showConfig" || len(m.Received[0].Path) != 0 {
+		t.Errorf("first device request = %+v, want a full config read", m.Received[0])
+	}
+	metas, _ := s.List("router1")
+	if len(metas) != 1 || metas[0].Trigger != snapshot.PreChange || metas[0].Request != "POST /" {
+		t.Errorf("snapshots = %+v, want one pre-change", metas)
+	}
+
+	// A dry run changes nothing, so it is not snapshotted.
+	do(t, http.MethodPost, "/?dry_run=true", map[string]string{"name": "RED", "table": "200"}, deviceVars(), h.CreateVRF)
+	if metas, _ := s.List("router1"); len(metas) != 1 {
+		t.Errorf("store holds %d snapshots after a dry run, want 1", len(metas))
+	}
+}
+
+func TestSnapshots_PreChangeLoad(t *testing.T) {
+	m, _, client := newMockVyOS(t, dataResp(map[string]interface{}{"vrf": map[string]interface{}{}}))
+	h := newHandler(client)
+	s := newSnapshotStore(t, h)
+
+	w := do(t, http.MethodPost, "/", map[string]string{"file": "/config/old.boot"}, deviceVars(), h.LoadConfig)
+	assertStatus(t, w, http.StatusOK)
+	if len(m.Received) != 2 || m.Received[0].Op != "showConfig" {
+		t.Errorf("device requests = %+v, want a config read before the load", m.Received)
+	}
+	if metas, _ := s.List("router1"); len(metas) != 1 || metas[0].Trigger != snapshot.PreChange {
+		t.Errorf("snapshots = %+v, want one pre-change", metas)
+	}
+}
+
+func TestSnapshots_Diff(t *testing.T) {
+	_, _, client := newMockVyOS(t)
+	h := newHandler(client)
+	s := newSnapshotStore(t, h)
+	from := saveSnapshot(t, s, map[string]interface{}{"vrf": map[string]interface{}{"name": map[string]interface{}{"BLUE": map[string]interface{}{"table": "100"}}}})
+	to := saveSnapshot(t, s, map[string]interface{}{"vrf": map[string]interface{}{"name": map[string]interface{}{"RED": map[string]interface{}{"table": "200"}}}})
+
+	w := do(t, http.MethodGet, "/?to="+to, nil, deviceVars("snapshot_id", from), h.DiffSnapshot)
+	assertStatus(t, w, http.StatusOK)
+	var diff handlers.SnapshotDiff
+	decodeJSON(t, w, &diff)
+	want := []vyos.Op{
+		{Op: "delete", Path: []string{"vrf", "name", "BLUE"}},
+		{Op: "set", Path: []string{"vrf", "name", "RED", "table", "200"}},
+	}
+	if diff.From != from || diff.To != to || !reflect.DeepEqual(diff.Operations, want) {
+		t.Errorf("diff = %+v", diff)
+	}
+}
+
+func TestSnapshots_Restore(t *testing.T) {
+	running := map[string]interface{}{"vrf": map[string]interface{}{"name": map[string]interface{}{
+		"BLUE": map[string]interface{}{"table": "100", "description": "changed"},
+		"RED":  map[string]interface{}{"table": "200"},
+	}}}
+	m, _, client := newMockVyOS(t, dataResp(running), dataResp(running))
+	h := newHandler(client)
+	s := newSnapshotStore(t, h)
+	id := saveSnapshot(t, s, map[string]interface{}{"vrf": map[string]interface{}{"name": map[string]interface{}{
+		"BLUE": map[string]interface{}{"table": "100"},
+	}}})
+
+	w := do(t, http.MethodPost, "/", nil, deviceVars("snapshot_id", id), h.RestoreSnapshot)
+	assertStatus(t, w, http.StatusOK)
+	var res handlers.SnapshotRestore
+	decodeJSON(t, w, &res)
+	want := []vyos.Op{
+		{Op: "delete", Path: []string{"vrf", "name", "BLUE", "description"}},
+		{Op: "delete", Path: []string{"vrf", "name", "RED"}},
+	}
+	if res.Snapshot != id || !reflect.DeepEqual(res.Operations, want) {
+		t.Errorf("restore = %+v", res)
+	}
+	var sent []vyos.Op
+	for _, req := range m.Received {
+		if req.Op == "set" || req.Op == "delete" {
+			sent = append(sent, vyos.Op{Op: req.Op, Path: req.Path})
+		}
+	}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("device got %+v, want %+v", sent, want)
+	}
+
+	// The restore itself was preceded by a pre-change snapshot to undo it.
+	if metas, _ := s.List("router1"); len(metas) != 2 || metas[1].Trigger != snapshot.PreChange {
+		t.Errorf("snapshots = %+v, want a pre-change snapshot after the restored one", metas)
+	}
+}
+
+func TestSnapshots_Disabled(t *testing.T) {
+	_, _, client := newMockVyOS(t)
+	h := newHandler(client)
+	w := do(t, http.MethodGet, "/", nil, deviceVars(), h.ListSnapshots)
+	assertStatus(t, w, http.StatusNotFound)
+}
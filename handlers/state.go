@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/valueiron/vyos-api/vyos"
+)
+
+// Live operational state, read with VyOS "show" commands rather than from the
+// configuration tree.
+
+// show runs an operational-mode command on the request's device and returns
+// its text output. On failure it writes the error response and returns false.
+func (h *Handler) show(w http.ResponseWriter, r *http.Request, path ...string) (string, bool) {
+	c, ok := h.getClient(w, r)
+	if !ok {
+		return "", false
+	}
+
+	out, err := c.Show.Run(r.Context(), path)
+	if err != nil {
+		writeDeviceError(w, err)
+		return "", false
+	}
+	return out.Text(), true
+}
+
+// GetInterfaceState handles GET /devices/{device_id}/state/interfaces.
+// Returns address and admin/link state for every interface ("show interfaces").
+func (h *Handler) GetInterfaceState(w http.ResponseWriter, r *http.Request) {
+	text, ok := h.show(w, r, "interfaces")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, vyos.ParseInterfaces(text))
+}
+
+// GetRouteState handles GET /devices/{device_id}/state/routes.
+// Returns the IPv4 routing table ("show ip route").
+func (h *Handler) GetRouteState(w http.ResponseWriter, r *http.Request) {
+	text, ok := h.show(w, r, "ip", "route")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, vyos.ParseRoutes(text))
+}
+
+// GetDHCPLeases handles GET /devices/{device_id}/state/dhcp-leases.
+// Returns active DHCP server leases ("show dhcp server leases").
+func (h *Handler) GetDHCPLeases(w http.ResponseWriter, r *http.Request) {
+	text, ok := h.show(w, r, "dhcp", "server", "leases")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, vyos.ParseDHCPLeases(text))
+}
+
+// GetVersion handles GET /devices/{device_id}/state/version.
+// Returns the parsed output of "show version".
+func (h *Handler) GetVersion(w http.ResponseWriter, r *http.Request) {
+	text, ok := h.show(w, r, "version")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, vyos.ParseVersion(text))
+}
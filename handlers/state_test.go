@@ -0,0 +1,58 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGetInterfaceState_OK(t *testing.T) {
+	text := "Interface    IP Address                        S/L  Description\n" +
+		"---------    ----------                        ---  -----------\n" +
+		"eth0         192.168.1.1/24                    u/u  WAN\n"
+	m, _, client := newMockVyOS(t, dataResp(text))
+	h := newHandler(client)
+
+	w := do(t, http.MethodGet, "/", nil, deviceVars(), h.GetInterfaceState)
+	assertStatus(t, w, http.StatusOK)
+
+	var result []map[string]interface{}
+	decodeJSON(t, w, &result)
+	if len(result) != 1 || result[0]["name"] != "eth0" || result[0]["link_up"] != true {
+		t.Errorf("result = %+v, want eth0 with link up", result)
+	}
+	if len(m.Received) != 1 || m.Received[0].Op != "show" || m.Received[0].Path[0] != "interfaces" {
+		t.Errorf("received = %+v, want one show interfaces op", m.Received)
+	}
+}
+
+func TestGetVersion_OK(t *testing.T) {
+	_, _, client := newMockVyOS(t, dataResp("Version:          VyOS 1.4.0\nRelease train:    sagitta\n"))
+	h := newHandler(client)
+
+	w := do(t, http.MethodGet, "/", nil, deviceVars(), h.GetVersion)
+	assertStatus(t, w, http.StatusOK)
+
+	var result map[string]interface{}
+	decodeJSON(t, w, &result)
+	if result["version"] != "VyOS 1.4.0" {
+		t.Errorf("version = %v, want VyOS 1.4.0", result["version"])
+	}
+}
+
+func TestGetDHCPLeases_NoLeases_NeverNull(t *testing.T) {
+	_, _, client := newMockVyOS(t, dataResp("No DHCP leases found\n"))
+	h := newHandler(client)
+
+	w := do(t, http.MethodGet, "/", nil, deviceVars(), h.GetDHCPLeases)
+	assertStatus(t, w, http.StatusOK)
+	if body := w.Body.String(); body != "[]\n" {
+		t.Errorf("body = %q, want []", body)
+	}
+}
+
+func TestGetRouteState_DeviceRejected(t *testing.T) {
+	_, _, client := newMockVyOS(t, failResp("Invalid command"))
+	h := newHandler(client)
+	w := do(t, http.MethodGet, "/", nil, deviceVars(), h.GetRouteState)
+	assertStatus(t, w, http.StatusUnprocessableEntity)
+}
@@ -30,6 +30,14 @@ type vyosResp struct {
 type vyosReq struct {
 	Op   string   `json:"op"`
 	Path []string `json:"path"`
+	// ConfirmTime is set on every op of a commit-confirm batch.
+	ConfirmTime int `json:"confirm_time,omitempty"`
+}
+
+// confirmReq is the body of a commit-confirm batch.
+type confirmReq struct {
+	Commands    []vyosReq `json:"commands"`
+	ConfirmTime int       `json:"confirm_time"`
 }
 
 // mockVyOS is a sequenced-response test double for the VyOS HTTP API.
@@ -50,10 +58,18 @@ func (m *mockVyOS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	data := r.FormValue("data")
 
-	// Set sends a JSON array; Get/Delete send a single object.
+	// Batches send a JSON array; single Get/Set/Delete ops send an object,
+	// and commit-confirm batches an object wrapping the array in "commands".
 	var reqs []vyosReq
 	if strings.HasPrefix(strings.TrimSpace(data), "[") {
 		json.Unmarshal([]byte(data), &reqs) //nolint:errcheck
+	} else if strings.Contains(data, `"commands"`) {
+		var cr confirmReq
+		json.Unmarshal([]byte(data), &cr) //nolint:errcheck
+		for _, c := range cr.Commands {
+			c.ConfirmTime = cr.ConfirmTime
+			reqs = append(reqs, c)
+		}
 	} else {
 		var single vyosReq
 		json.Unmarshal([]byte(data), &single) //nolint:errcheck
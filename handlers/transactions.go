@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/valueiron/vyos-api/auth"
+	"github.com/valueiron/vyos-api/vyos"
+)
+
+// createRequest is the body of a create endpoint. The endpoint and
+// transactions both compile it with build, so a resource created either way
+// gets the same operations.
+type createRequest interface {
+	// validate returns the 400 message for a request missing required fields.
+	validate() error
+	// build queues the request's operations on b and returns the created
+	// resource as the create endpoint reports it.
+	build(b *vyos.Batch) interface{}
+}
+
+// TransactionRequest is the JSON body for POST /devices/{device_id}/transactions.
+type TransactionRequest struct {
+	// Operations are compiled in order into one commit.
+	Operations []TransactionOp `json:"operations"`
+}
+
+// TransactionOp is one create operation of a transaction. Body is the JSON
+// body the matching create endpoint accepts; see transactionTypes.
+type TransactionOp struct {
+	Type string `json:"type"`
+	// NATType is "source" or "destination", for type nat_rule.
+	NATType string `json:"nat_type,omitempty"`
+	// Policy is the firewall policy to add to, for type firewall_rule.
+	Policy string          `json:"policy,omitempty"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// TransactionResult reports one operation of a transaction.
+type TransactionResult struct {
+	Type string `json:"type"`
+	// Status is vyos.OpApplied if the transaction was committed. If the
+	// device rejected it, it is vyos.OpRejected for operations VyOS named in
+	// its error and vyos.OpDiscarded for the rest.
+	Status string `json:"status"`
+	// Resource is what the create endpoint would have returned; only set
+	// when the transaction was committed.
+	Resource   interface{}     `json:"resource,omitempty"`
+	Operations []vyos.OpResult `json:"operations"`
+}
+
+// TransactionResponse is returned by the transactions endpoint.
+type TransactionResponse struct {
+	Results []TransactionResult `json:"results"`
+}
+
+// TransactionError is the 422 response body for a rejected transaction.
+// Nothing from the transaction remains applied.
+type TransactionError struct {
+	Error   string              `json:"error"`
+	Results []TransactionResult `json:"results"`
+}
+
+// transactionTypes maps each transaction operation type to the resource kind
+// of the create endpoint it mirrors, as auth.ResourceOf names it, and the
+// decoder of its body.
+var transactionTypes = map[string]struct {
+	kind   string
+	decode func(op TransactionOp) (createRequest, error)
+}{
+	"network":         {"networks", decodeAs[CreateNetworkRequest]},
+	"vrf":             {"vrfs", decodeAs[CreateVRFRequest]},
+	"vlan":            {"vlans", decodeAs[CreateVLANRequest]},
+	"firewall_policy": {"firewall/policies", decodeAs[CreatePolicyRequest]},
+	"firewall_rule": {"firewall/policies/rules", func(op TransactionOp) (createRequest, error) {
+		req := addRule{policy: op.Policy}
+		err := json.Unmarshal(op.Body, &req.AddRuleRequest)
+		return req, err
+	}},
+	"address_group": {"firewall/address-groups", decodeAs[CreateAddressGroupRequest]},
+	"nat_rule": {"nat/rules", func(op TransactionOp) (createRequest, error) {
+		req := createNATRule{natType: op.NATType}
+		err := json.Unmarshal(op.Body, &req.CreateNATRuleRequest)
+		return req, err
+	}},
+	"route":       {"routes", decodeAs[CreateRouteRequest]},
+	"dhcp_server": {"dhcp/servers", decodeAs[CreateDHCPServerRequest]},
+}
+
+func decodeAs[T createRequest](op TransactionOp) (createRequest, error) {
+	var req T
+	err := json.Unmarshal(op.Body, &req)
+	return req, err
+}
+
+// Transaction handles POST /devices/{device_id}/transactions.
+// Validates every operation, then compiles them in order into one batch and
+// commits it, so either all of the resources are created or none is. With an
+// authorization policy the caller must also be allowed to POST to each
+// operation's create endpoint.
+func (h *Handler) Transaction(w http.ResponseWriter, r *http.Request) {
+	d, ok := h.getDevice(w, r)
+	if !ok {
+		return
+	}
+
+	var req TransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if len(req.Operations) == 0 {
+		writeError(w, http.StatusBadRequest, "operations is required")
+		return
+	}
+
+	creates := make([]createRequest, len(req.Operations))
+	for i, op := range req.Operations {
+		t, ok := transactionTypes[op.Type]
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("operations[%d]: unknown type %q", i, op.Type))
+			return
+		}
+		create, err := t.decode(op)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("operations[%d]: invalid body", i))
+			return
+		}
+		if err := create.validate(); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("operations[%d]: %v", i, err))
+			return
+		}
+		if h.policy != nil {
+			pr, _ := auth.PrincipalFrom(r.Context())
+			if pr == nil || !h.policy.Allowed(pr, auth.Request{Method: http.MethodPost, Resource: t.kind, Device: d.ID, Tags: d.Tags}) {
+				writeError(w, http.StatusForbidden, fmt.Sprintf("operations[%d]: not permitted to POST %s on device %s", i, t.kind, d.ID))
+				return
+			}
+		}
+		creates[i] = create
+	}
+
+	minutes, ok := confirmMinutes(w, r)
+	if !ok {
+		return
+	}
+
+	// Compile, remembering which of the batch's ops each operation queued.
+	b := d.Client.Conf.Batch()
+	results := make([]TransactionResult, len(creates))
+	ends := make([]int, len(creates))
+	for i, create := range creates {
+		results[i] = TransactionResult{Type: req.Operations[i].Type, Resource: create.build(b)}
+		ends[i] = b.Len()
+	}
+	split := func(ops []vyos.OpResult) {
+		start := 0
+		for i := range results {
+			results[i].Operations = ops[start:ends[i]]
+			start = ends[i]
+		}
+	}
+
+	if !h.applyOr(w, r, b, minutes, func(msg string) any {
+		split(b.Explain(msg))
+		for i := range results {
+			results[i].Resource = nil
+			results[i].Status = vyos.OpDiscarded
+			for _, op := range results[i].Operations {
+				if op.Status == vyos.OpRejected {
+					results[i].Status = vyos.OpRejected
+				}
+			}
+		}
+		return TransactionError{Error: "device rejected transaction: " + msg, Results: results}
+	}) {
+		return
+	}
+
+	applied := make([]vyos.OpResult, b.Len())
+	for i, op := range b.Ops() {
+		applied[i] = vyos.OpResult{Op: op.Op, Path: op.Path, Status: vyos.OpApplied}
+	}
+	split(applied)
+	for i := range results {
+		results[i].Status = vyos.OpApplied
+	}
+	writeJSON(w, http.StatusCreated, TransactionResponse{Results: results})
+}
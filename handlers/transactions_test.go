@@ -0,0 +1,147 @@
+package handlers_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/auth"
+	"github.com/valueiron/vyos-api/handlers"
+	"github.com/valueiron/vyos-api/vyos"
+)
+
+// tenant is a transaction creating a VRF, a VLAN and a source NAT rule.
+var tenant = map[string]interface{}{
+	"operations": []map[string]interface{}{
+		{"type": "vrf", "body": map[string]interface{}{"name": "BLUE", "table": "100"}},
+		{"type": "vlan", "body": map[string]interface{}{"interface": "eth1", "type": "ethernet", "vlan_id": 10, "address": "10.10.0.1/24"}},
+		{"type": "nat_rule", "nat_type": "source", "body": map[string]interface{}{"rule_id": 100, "translation_address": "masquerade", "protocol": "bogus"}},
+	},
+}
+
+func TestTransaction_OK(t *testing.T) {
+	m, _, client := newMockVyOS(t, successResp())
+	h := newHandler(client)
+
+	w := do(t, http.MethodPost, "/", tenant, deviceVars(), h.Transaction)
+	assertStatus(t, w, http.StatusCreated)
+
+	var res handlers.TransactionResponse
+	decodeJSON(t, w, &res)
+	if len(res.Results) != 3 {
+		t.Fatalf("got %d results, want 3", len(res.Results))
+	}
+	wantOps := []int{1, 1, 2}
+	for i, r := range res.Results {
+		if r.Status != vyos.OpApplied || r.Resource == nil || len(r.Operations) != wantOps[i] {
+			t.Errorf("result %d = %+v, want applied with %d ops", i, r, wantOps[i])
+		}
+	}
+	if got := res.Results[2].Operations[0].Path; strings.Join(got, " ") != "nat source rule 100 translation address masquerade" {
+		t.Errorf("nat op path = %v", got)
+	}
+	// Everything went to the device as one commit.
+	if len(m.Received) != 4 {
+		t.Errorf("device got %d ops, want 4", len(m.Received))
+	}
+}
+
+func TestTransaction_Rejected(t *testing.T) {
+	_, _, client := newMockVyOS(t, failResp("Configuration path: [nat source rule 100 protocol bogus] is not valid\nSet failed"))
+	h := newHandler(client)
+
+	w := do(t, http.MethodPost, "/", tenant, deviceVars(), h.Transaction)
+	assertStatus(t, w, http.StatusUnprocessableEntity)
+
+	var res handlers.TransactionError
+	decodeJSON(t, w, &res)
+	want := []string{vyos.OpDiscarded, vyos.OpDiscarded, vyos.OpRejected}
+	for i, r := range res.Results {
+		if r.Status != want[i] || r.Resource != nil {
+			t.Errorf("result %d = %+v, want %s", i, r, want[i])
+		}
+	}
+}
+
+func TestTransaction_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []map[string]interface{}
+		want string
+	}{
+		{"empty", nil, "operations is required"},
+		{"unknown type", []map[string]interface{}{{"type": "bgp", "body": map[string]string{}}}, `operations[0]: unknown type "bgp"`},
+		{"missing field", []map[string]interface{}{
+			{"type": "vrf", "body": map[string]string{"name": "BLUE", "table": "100"}},
+			{"type": "route", "body": map[string]string{"network": "10.0.0.0/8"}},
+		}, "operations[1]: network and next_hop are required"},
+		{"nat type", []map[string]interface{}{{"type": "nat_rule", "body": map[string]interface{}{"rule_id": 1, "translation_address": "masquerade"}}}, "operations[0]: nat_type must be 'source' or 'destination'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, client := newMockVyOS(t)
+			h := newHandler(client)
+			w := do(t, http.MethodPost, "/", map[string]interface{}{"operations": tt.ops}, deviceVars(), h.Transaction)
+			assertStatus(t, w, http.StatusBadRequest)
+			var body map[string]string
+			decodeJSON(t, w, &body)
+			if body["error"] != tt.want {
+				t.Errorf("error = %q, want %q", body["error"], tt.want)
+			}
+			if len(m.Received) != 0 {
+				t.Errorf("device got %d ops, want none", len(m.Received))
+			}
+		})
+	}
+}
+
+func TestTransaction_Policy(t *testing.T) {
+	_, _, client := newMockVyOS(t)
+	h := newHandler(client)
+	dir := t.TempDir()
+	sum := sha256.Sum256([]byte("s3cret"))
+	if err := os.WriteFile(filepath.Join(dir, "tokens"), []byte(hex.EncodeToString(sum[:])+" svc-deploy\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy := `{"roles": {"tenants": [{"resources": ["transactions", "vrfs", "vlans"], "methods": ["POST"]}]}, "subjects": {"svc-deploy": ["tenants"]}}`
+	if err := os.WriteFile(filepath.Join(dir, "policy.json"), []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.LoadTokens(filepath.Join(dir, "tokens"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := auth.LoadPolicy(filepath.Join(dir, "policy.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetPolicy(p)
+	srv := auth.Middleware(tokens)(http.HandlerFunc(h.Transaction))
+
+	send := func(body interface{}) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+		r.Header.Set("Authorization", "Bearer s3cret")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, mux.SetURLVars(r, deviceVars()))
+		return w
+	}
+
+	// The NAT rule is outside the caller's grants.
+	w := send(tenant)
+	assertStatus(t, w, http.StatusForbidden)
+	if !strings.Contains(w.Body.String(), "operations[2]: not permitted to POST nat/rules") {
+		t.Errorf("body = %s", w.Body.String())
+	}
+
+	ops := tenant["operations"].([]map[string]interface{})[:2]
+	assertStatus(t, send(map[string]interface{}{"operations": ops}), http.StatusCreated)
+}
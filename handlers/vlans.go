@@ -2,11 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/vyos"
 )
 
 // VLANInfo is the API representation of a VyOS 802.1Q vif subinterface.
@@ -34,6 +35,10 @@ type UpdateVLANRequest struct {
 	Description string `json:"description,omitempty"`
 }
 
+func vifPath(ifType, iface string, vlanID int) []string {
+	return []string{"interfaces", ifType, iface, "vif", strconv.Itoa(vlanID)}
+}
+
 // ListVLANs handles GET /devices/{device_id}/vlans.
 func (h *Handler) ListVLANs(w http.ResponseWriter, r *http.Request) {
 	c, ok := h.getClient(w, r)
@@ -41,13 +46,9 @@ func (h *Handler) ListVLANs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	out, _, err := c.Conf.Get(r.Context(), "interfaces", nil)
+	out, err := c.Conf.GetPath(r.Context(), []string{"interfaces"})
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
-		return
-	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
+		writeDeviceError(w, err)
 		return
 	}
 
@@ -81,6 +82,7 @@ func (h *Handler) ListVLANs(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, result)
 }
 
@@ -96,54 +98,51 @@ func (h *Handler) CreateVLAN(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid JSON body")
 		return
 	}
-	if req.Interface == "" || req.Type == "" || req.VLANID == 0 {
-		writeError(w, http.StatusBadRequest, "interface, type, and vlan_id are required")
+	if err := req.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// Create the vif subinterface.
+	b := c.Conf.Batch()
+	created := req.build(b)
+	if !h.commit(w, r, b) {
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (req CreateVLANRequest) validate() error {
+	if req.Interface == "" || req.Type == "" || req.VLANID == 0 {
+		return errors.New("interface, type, and vlan_id are required")
+	}
+	return nil
+}
+
+func (req CreateVLANRequest) build(b *vyos.Batch) interface{} {
+	base := vifPath(req.Type, req.Interface, req.VLANID)
+
+	// Create the vif subinterface, with an address if one was given.
 	if req.Address != "" {
-		path := fmt.Sprintf("interfaces %s %s vif %d address %s", req.Type, req.Interface, req.VLANID, req.Address)
-		out, _, err := c.Conf.Set(r.Context(), path)
-		if err != nil {
-			writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
-			return
-		}
-		if !out.Success {
-			writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
-			return
-		}
+		b.Set(subPath(base, "address", req.Address))
 	} else {
-		// Create vif without address.
-		path := fmt.Sprintf("interfaces %s %s vif %d", req.Type, req.Interface, req.VLANID)
-		out, _, err := c.Conf.Set(r.Context(), path)
-		if err != nil {
-			writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
-			return
-		}
-		if !out.Success {
-			writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
-			return
-		}
+		b.Set(base)
 	}
-
 	if req.Description != "" {
-		descPath := fmt.Sprintf("interfaces %s %s vif %d description %s", req.Type, req.Interface, req.VLANID, req.Description)
-		c.Conf.Set(r.Context(), descPath) //nolint:errcheck
+		b.Set(subPath(base, "description", req.Description))
 	}
 
 	addrs := []string{}
 	if req.Address != "" {
 		addrs = []string{req.Address}
 	}
-
-	writeJSON(w, http.StatusCreated, VLANInfo{
+	return VLANInfo{
 		Interface:   req.Interface,
 		Type:        req.Type,
 		VLANID:      req.VLANID,
 		Addresses:   addrs,
 		Description: req.Description,
-	})
+	}
 }
 
 // GetVLAN handles GET /devices/{device_id}/vlans/{interface}/{vlan_id}.
@@ -166,14 +165,13 @@ func (h *Handler) GetVLAN(w http.ResponseWriter, r *http.Request) {
 		ifType = "ethernet"
 	}
 
-	path := fmt.Sprintf("interfaces %s %s vif %d", ifType, iface, vlanID)
-	out, _, err := c.Conf.Get(r.Context(), path, nil)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	out, err := c.Conf.GetPath(r.Context(), vifPath(ifType, iface, vlanID))
+	if errors.Is(err, vyos.ErrPathNotFound) {
+		writeError(w, http.StatusNotFound, "VLAN not found")
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusNotFound, "VLAN not found")
+	if err != nil {
+		writeDeviceError(w, err)
 		return
 	}
 
@@ -181,6 +179,7 @@ func (h *Handler) GetVLAN(w http.ResponseWriter, r *http.Request) {
 	addrs := toStringSlice(cfg["address"])
 	desc, _ := cfg["description"].(string)
 
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, VLANInfo{
 		Interface:   iface,
 		Type:        ifType,
@@ -215,27 +214,34 @@ func (h *Handler) UpdateVLAN(w http.ResponseWriter, r *http.Request) {
 		req.Type = "ethernet"
 	}
 
+	base := vifPath(req.Type, iface, vlanID)
+	cur, ok := readIfMatch(w, r, c, base)
+	if !ok {
+		return
+	}
+
+	b := c.Conf.Batch()
 	if req.Address != "" {
-		// Replace existing addresses.
-		delPath := fmt.Sprintf("interfaces %s %s vif %d address", req.Type, iface, vlanID)
-		c.Conf.Delete(r.Context(), delPath) //nolint:errcheck
-
-		setPath := fmt.Sprintf("interfaces %s %s vif %d address %s", req.Type, iface, vlanID, req.Address)
-		out, _, err := c.Conf.Set(r.Context(), setPath)
-		if err != nil {
-			writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
-			return
-		}
-		if !out.Success {
-			writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
-			return
+		// Replace existing addresses. Deleting a missing node would fail the
+		// whole commit, so only delete when the vif currently has addresses.
+		if cfg, _ := cur.(map[string]interface{}); cfg["address"] != nil {
+			b.Delete(subPath(base, "address"))
 		}
+		b.Set(subPath(base, "address", req.Address))
 	}
-
 	if req.Description != "" {
-		descPath := fmt.Sprintf("interfaces %s %s vif %d description %s", req.Type, iface, vlanID, req.Description)
-		c.Conf.Set(r.Context(), descPath) //nolint:errcheck
+		b.Set(subPath(base, "description", req.Description))
+	}
+	if !h.commit(w, r, b) {
+		return
+	}
+
+	out, err := c.Conf.GetPath(r.Context(), base)
+	if err != nil {
+		writeDeviceError(w, err)
+		return
 	}
+	setETag(w, out.Data)
 
 	addrs := []string{}
 	if req.Address != "" {
@@ -270,15 +276,12 @@ func (h *Handler) DeleteVLAN(w http.ResponseWriter, r *http.Request) {
 	if ifType == "" {
 		ifType = "ethernet"
 	}
-
-	path := fmt.Sprintf("interfaces %s %s vif %d", ifType, iface, vlanID)
-	out, _, err := c.Conf.Delete(r.Context(), path)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	base := vifPath(ifType, iface, vlanID)
+	if !ifMatch(w, r, c, base) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
+
+	if !h.commit(w, r, c.Conf.Batch().Delete(base)) {
 		return
 	}
 
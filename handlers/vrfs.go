@@ -2,10 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/vyos"
 )
 
 // VRFInfo is the API representation of a VyOS VRF.
@@ -28,6 +29,10 @@ type UpdateVRFRequest struct {
 	Description string `json:"description,omitempty"`
 }
 
+func vrfPath(name string) []string {
+	return []string{"vrf", "name", name}
+}
+
 // ListVRFs handles GET /devices/{device_id}/vrfs.
 func (h *Handler) ListVRFs(w http.ResponseWriter, r *http.Request) {
 	c, ok := h.getClient(w, r)
@@ -35,13 +40,10 @@ func (h *Handler) ListVRFs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	out, _, err := c.Conf.Get(r.Context(), "vrf name", nil)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
-		return
-	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
+	out, err := c.Conf.GetPath(r.Context(), []string{"vrf", "name"})
+	// A missing path means no VRFs are configured yet.
+	if err != nil && !errors.Is(err, vyos.ErrPathNotFound) {
+		writeDeviceError(w, err)
 		return
 	}
 
@@ -63,6 +65,7 @@ func (h *Handler) ListVRFs(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, result)
 }
 
@@ -78,32 +81,38 @@ func (h *Handler) CreateVRF(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid JSON body")
 		return
 	}
-	if req.Name == "" || req.Table == "" {
-		writeError(w, http.StatusBadRequest, "name and table are required")
+	if err := req.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	path := fmt.Sprintf("vrf name %s table %s", req.Name, req.Table)
-	out, _, err := c.Conf.Set(r.Context(), path)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	b := c.Conf.Batch()
+	created := req.build(b)
+	if !h.commit(w, r, b) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
-		return
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (req CreateVRFRequest) validate() error {
+	if req.Name == "" || req.Table == "" {
+		return errors.New("name and table are required")
 	}
+	return nil
+}
 
+func (req CreateVRFRequest) build(b *vyos.Batch) interface{} {
+	base := vrfPath(req.Name)
+	b.Set(subPath(base, "table", req.Table))
 	if req.Description != "" {
-		descPath := fmt.Sprintf("vrf name %s description %s", req.Name, req.Description)
-		c.Conf.Set(r.Context(), descPath) //nolint:errcheck
+		b.Set(subPath(base, "description", req.Description))
 	}
-
-	writeJSON(w, http.StatusCreated, VRFInfo{
+	return VRFInfo{
 		Name:        req.Name,
 		Table:       req.Table,
 		Description: req.Description,
-	})
+	}
 }
 
 // GetVRF handles GET /devices/{device_id}/vrfs/{vrf}.
@@ -115,13 +124,13 @@ func (h *Handler) GetVRF(w http.ResponseWriter, r *http.Request) {
 
 	vrfName := mux.Vars(r)["vrf"]
 
-	out, _, err := c.Conf.Get(r.Context(), fmt.Sprintf("vrf name %s", vrfName), nil)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	out, err := c.Conf.GetPath(r.Context(), vrfPath(vrfName))
+	if errors.Is(err, vyos.ErrPathNotFound) {
+		writeError(w, http.StatusNotFound, "VRF not found")
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusNotFound, "VRF not found")
+	if err != nil {
+		writeDeviceError(w, err)
 		return
 	}
 
@@ -129,6 +138,7 @@ func (h *Handler) GetVRF(w http.ResponseWriter, r *http.Request) {
 	table, _ := cfg["table"].(string)
 	desc, _ := cfg["description"].(string)
 
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, VRFInfo{
 		Name:        vrfName,
 		Table:       table,
@@ -151,42 +161,33 @@ func (h *Handler) UpdateVRF(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Table != "" {
-		path := fmt.Sprintf("vrf name %s table %s", vrfName, req.Table)
-		out, _, err := c.Conf.Set(r.Context(), path)
-		if err != nil {
-			writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
-			return
-		}
-		if !out.Success {
-			writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
-			return
-		}
+	base := vrfPath(vrfName)
+	if !ifMatch(w, r, c, base) {
+		return
 	}
 
+	b := c.Conf.Batch()
+	if req.Table != "" {
+		b.Set(subPath(base, "table", req.Table))
+	}
 	if req.Description != "" {
-		descPath := fmt.Sprintf("vrf name %s description %s", vrfName, req.Description)
-		out, _, err := c.Conf.Set(r.Context(), descPath)
-		if err != nil {
-			writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
-			return
-		}
-		if !out.Success {
-			writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
-			return
-		}
+		b.Set(subPath(base, "description", req.Description))
+	}
+	if !h.commit(w, r, b) {
+		return
 	}
 
 	// Return updated state.
-	out, _, err := c.Conf.Get(r.Context(), fmt.Sprintf("vrf name %s", vrfName), nil)
+	out, err := c.Conf.GetPath(r.Context(), base)
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+		writeDeviceError(w, err)
 		return
 	}
 	cfg, _ := out.Data.(map[string]interface{})
 	table, _ := cfg["table"].(string)
 	desc, _ := cfg["description"].(string)
 
+	setETag(w, out.Data)
 	writeJSON(w, http.StatusOK, VRFInfo{
 		Name:        vrfName,
 		Table:       table,
@@ -202,14 +203,11 @@ func (h *Handler) DeleteVRF(w http.ResponseWriter, r *http.Request) {
 	}
 
 	vrfName := mux.Vars(r)["vrf"]
-
-	out, _, err := c.Conf.Delete(r.Context(), fmt.Sprintf("vrf name %s", vrfName))
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "device communication error: "+err.Error())
+	if !ifMatch(w, r, c, vrfPath(vrfName)) {
 		return
 	}
-	if !out.Success {
-		writeError(w, http.StatusUnprocessableEntity, "device rejected operation: "+fmt.Sprint(out.Error))
+
+	if !h.commit(w, r, c.Conf.Batch().Delete(vrfPath(vrfName))) {
 		return
 	}
 
@@ -102,8 +102,8 @@ func TestGetVRF_NotFound(t *testing.T) {
 
 func TestUpdateVRF_OK(t *testing.T) {
 	vrfCfg := map[string]interface{}{"table": "101", "description": "updated"}
-	// One Set call for table, one for description, then one Get call.
-	_, _, client := newMockVyOS(t, successResp(), successResp(), dataResp(vrfCfg))
+	// One batch (table + description), then one Get call.
+	_, _, client := newMockVyOS(t, successResp(), dataResp(vrfCfg))
 	h := newHandler(client)
 
 	body := map[string]string{"table": "101", "description": "updated"}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/valueiron/vyos-api/auth"
+)
+
+// WhoAmI is the body of GET /whoami.
+type WhoAmI struct {
+	Authenticated bool     `json:"authenticated"`
+	Name          string   `json:"name,omitempty"`
+	Method        string   `json:"method,omitempty"` // token, mtls or jwt
+	Roles         []string `json:"roles"`
+	// Unrestricted is true when no policy is configured, so the caller may
+	// make any request.
+	Unrestricted bool         `json:"unrestricted"`
+	Permissions  []Permission `json:"permissions"`
+}
+
+// Permission is one policy rule granted to the caller, with the registered
+// devices it currently covers.
+type Permission struct {
+	Role string `json:"role"`
+	auth.Rule
+	MatchedDevices []string `json:"matched_devices"`
+}
+
+// SetPolicy sets the authorization policy GET /whoami reports. The policy is
+// enforced by auth.Policy.Middleware; the handlers only use it to limit
+// GET /audit to the devices the caller may see.
+func (h *Handler) SetPolicy(p *auth.Policy) {
+	h.policy = p
+}
+
+// WhoAmI handles GET /whoami.
+// Returns the caller's identity, roles and effective permissions.
+func (h *Handler) WhoAmI(w http.ResponseWriter, r *http.Request) {
+	res := WhoAmI{Roles: []string{}, Permissions: []Permission{}}
+	pr, ok := auth.PrincipalFrom(r.Context())
+	if ok {
+		res.Authenticated = true
+		res.Name = pr.Name
+		res.Method = pr.Method
+	}
+	if h.policy == nil {
+		res.Unrestricted = true
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+	if !ok {
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+
+	devices := h.devices.List()
+	res.Roles = h.policy.RolesOf(pr)
+	for _, role := range res.Roles {
+		for _, rule := range h.policy.Roles[role] {
+			p := Permission{Role: role, Rule: rule, MatchedDevices: []string{}}
+			for _, d := range devices {
+				if rule.AppliesTo(d.ID, d.Tags) {
+					p.MatchedDevices = append(p.MatchedDevices, d.ID)
+				}
+			}
+			res.Permissions = append(res.Permissions, p)
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,95 @@
+package handlers_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/valueiron/vyos-api/auth"
+	"github.com/valueiron/vyos-api/handlers"
+)
+
+// whoami serves GET /whoami behind token authentication for the token
+// "s3cret", named "svc-deploy".
+func whoami(t *testing.T, h *handlers.Handler, token string) handlers.WhoAmI {
+	t.Helper()
+	sum := sha256.Sum256([]byte("s3cret"))
+	path := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(sum[:])+" svc-deploy\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.LoadTokens(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := auth.Middleware(tokens)(http.HandlerFunc(h.WhoAmI))
+
+	r := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	assertStatus(t, w, http.StatusOK)
+	var res handlers.WhoAmI
+	decodeJSON(t, w, &res)
+	return res
+}
+
+func TestWhoAmI_NoPolicy(t *testing.T) {
+	_, _, client := newMockVyOS(t)
+	res := whoami(t, newHandler(client), "s3cret")
+	if !res.Authenticated || res.Name != "svc-deploy" || res.Method != "token" || !res.Unrestricted {
+		t.Errorf("got %+v", res)
+	}
+}
+
+func TestWhoAmI_Policy(t *testing.T) {
+	_, _, client := newMockVyOS(t)
+	h := handlers.New(map[string]*handlers.Device{
+		"edge-1": {ID: "edge-1", Client: client},
+		"core1":  {ID: "core1", Client: client, Tags: []string{"lab"}},
+		"core2":  {ID: "core2", Client: client},
+	})
+	path := filepath.Join(t.TempDir(), "policy.json")
+	policy := `{
+	  "roles": {"operator": [
+	    {"devices": ["edge-*"], "resources": ["firewall"], "methods": ["GET"]},
+	    {"tags": ["lab"], "resources": ["*"], "methods": ["*"]}
+	  ]},
+	  "subjects": {"svc-*": ["operator"]}
+	}`
+	if err := os.WriteFile(path, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := auth.LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetPolicy(p)
+
+	res := whoami(t, h, "s3cret")
+	if res.Unrestricted || len(res.Roles) != 1 || res.Roles[0] != "operator" {
+		t.Fatalf("got %+v", res)
+	}
+	if len(res.Permissions) != 2 {
+		t.Fatalf("permissions = %+v, want 2", res.Permissions)
+	}
+	if got := res.Permissions[0].MatchedDevices; len(got) != 1 || got[0] != "edge-1" {
+		t.Errorf("rule 0 devices = %v, want [edge-1]", got)
+	}
+	if got := res.Permissions[1].MatchedDevices; len(got) != 1 || got[0] != "core1" {
+		t.Errorf("rule 1 devices = %v, want [core1]", got)
+	}
+
+	// Without authentication middleware there is no principal.
+	w := do(t, http.MethodGet, "/whoami", nil, nil, h.WhoAmI)
+	assertStatus(t, w, http.StatusOK)
+	var anon handlers.WhoAmI
+	decodeJSON(t, w, &anon)
+	if anon.Authenticated || anon.Unrestricted || len(anon.Permissions) != 0 {
+		t.Errorf("unauthenticated: got %+v", anon)
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/auth"
+)
+
+// Defaults for SetWriteQueue.
+const (
+	DefaultWriteQueueDepth = 8
+	DefaultWriteTimeout    = 30 * time.Second
+)
+
+var (
+	errQueueFull   = errors.New("write queue full")
+	errWaitTimeout = errors.New("timed out waiting for write queue")
+)
+
+// writeQueue lets one configuration change at a time through to each device.
+// VyOS has a single config session lock, so concurrent /configure calls to a
+// router either fail on the lock or interleave each other's changes. Queues
+// are keyed by device ID rather than held by the Device, so a device replaced
+// at runtime shares the queue of the one it replaces.
+type writeQueue struct {
+	depth int
+	wait  time.Duration
+
+	mu     sync.Mutex
+	queues map[string]*deviceQueue
+}
+
+type deviceQueue struct {
+	slot    chan struct{} // holds a token while a change is in progress
+	waiting int           // guarded by writeQueue.mu
+}
+
+func newWriteQueue(depth int, wait time.Duration) *writeQueue {
+	return &writeQueue{depth: depth, wait: wait, queues: map[string]*deviceQueue{}}
+}
+
+func (q *writeQueue) get(id string) *deviceQueue {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	dq, ok := q.queues[id]
+	if !ok {
+		dq = &deviceQueue{slot: make(chan struct{}, 1)}
+		q.queues[id] = dq
+	}
+	return dq
+}
+
+// acquire waits for the device's turn and returns the function that ends it.
+// It fails with errQueueFull if q.depth requests are already waiting, with
+// errWaitTimeout after q.wait, or with the context's error.
+func (q *writeQueue) acquire(ctx context.Context, id string) (func(), error) {
+	dq := q.get(id)
+	release := func() { <-dq.slot }
+	start := time.Now()
+	select {
+	case dq.slot <- struct{}{}:
+		writeQueueWait.WithLabelValues(id).Observe(0)
+		return release, nil
+	default:
+	}
+
+	q.mu.Lock()
+	if dq.waiting >= q.depth {
+		q.mu.Unlock()
+		writeQueueRejected.WithLabelValues(id, "full").Inc()
+		return nil, errQueueFull
+	}
+	dq.waiting++
+	writeQueueDepth.WithLabelValues(id).Set(float64(dq.waiting))
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		dq.waiting--
+		writeQueueDepth.WithLabelValues(id).Set(float64(dq.waiting))
+		q.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(q.wait)
+	defer timer.Stop()
+	select {
+	case dq.slot <- struct{}{}:
+		writeQueueWait.WithLabelValues(id).Observe(time.Since(start).Seconds())
+		return release, nil
+	case <-timer.C:
+		writeQueueRejected.WithLabelValues(id, "timeout").Inc()
+		return nil, errWaitTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// SetWriteQueue sets how many configuration changes may wait for a device
+// while another is in progress, and how long each may wait. New uses
+// DefaultWriteQueueDepth and DefaultWriteTimeout.
+func (h *Handler) SetWriteQueue(depth int, wait time.Duration) {
+	h.writes = newWriteQueue(depth, wait)
+}
+
+// SerializeWrites is middleware that runs requests which may change a
+// device's configuration one at a time per device, in arrival order. GET and
+// HEAD requests, the device management routes under /devices/{device_id},
+// and requests for unregistered devices (which the handler answers with 404)
+// are not queued, so unknown IDs never get a queue or metric series. A request that finds the queue full gets 503, and one that
+// waits too long gets 409.
+func (h *Handler) SerializeWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["device_id"]
+		if id == "" || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if kind, _ := auth.ResourceOf(r); kind == "devices" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := h.devices.Get(id); !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		release, err := h.writes.acquire(r.Context(), id)
+		switch {
+		case errors.Is(err, errQueueFull):
+			w.Header().Set("Retry-After", strconv.Itoa(int(h.writes.wait.Seconds())+1))
+			writeError(w, http.StatusServiceUnavailable, fmt.Sprintf("device %s is busy: %d changes already waiting", id, h.writes.depth))
+			return
+		case errors.Is(err, errWaitTimeout):
+			writeError(w, http.StatusConflict, fmt.Sprintf("device %s is busy: another change did not finish within %s", id, h.writes.wait))
+			return
+		case err != nil:
+			writeError(w, http.StatusServiceUnavailable, "request cancelled while waiting for device "+id)
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,95 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/handlers"
+)
+
+func TestSerializeWrites(t *testing.T) {
+	_, _, client := newMockVyOS(t)
+	h := newHandler(client)
+	h.Devices().Put(&handlers.Device{ID: "router2", Client: client})
+	h.SetWriteQueue(1, 100*time.Millisecond)
+
+	started := make(chan struct{}, 4)
+	finish := make(chan struct{})
+	blocking := func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-finish
+	}
+	r := mux.NewRouter()
+	r.Use(h.SerializeWrites)
+	r.HandleFunc("/devices/{device_id}/vrfs", blocking).Methods(http.MethodPost)
+	r.HandleFunc("/devices/{device_id}/vrfs", func(w http.ResponseWriter, r *http.Request) {}).Methods(http.MethodGet)
+	r.HandleFunc("/devices/{device_id}", func(w http.ResponseWriter, r *http.Request) {}).Methods(http.MethodDelete)
+
+	send := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	// The first change holds router1's slot until finish is closed.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assertStatus(t, send(http.MethodPost, "/devices/router1/vrfs"), http.StatusOK)
+	}()
+	<-started
+
+	// Reads, device management and other devices are not queued.
+	assertStatus(t, send(http.MethodGet, "/devices/router1/vrfs"), http.StatusOK)
+	assertStatus(t, send(http.MethodDelete, "/devices/router1"), http.StatusOK)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assertStatus(t, send(http.MethodPost, "/devices/router2/vrfs"), http.StatusOK)
+	}()
+	<-started
+
+	// The second change waits in the queue; a third finds it full.
+	waited := make(chan *httptest.ResponseRecorder)
+	go func() { waited <- send(http.MethodPost, "/devices/router1/vrfs") }()
+	for !strings.Contains(do(t, http.MethodGet, "/metrics", nil, nil, h.Metrics).Body.String(),
+		`vyos_api_write_queue_depth{device="router1"} 1`) {
+		time.Sleep(time.Millisecond)
+	}
+	w := send(http.MethodPost, "/devices/router1/vrfs")
+	assertStatus(t, w, http.StatusServiceUnavailable)
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("503 without Retry-After")
+	}
+	assertStatus(t, <-waited, http.StatusConflict)
+
+	close(finish)
+	wg.Wait()
+
+	// Once the slot is free, changes go through again.
+	finish = make(chan struct{})
+	close(finish)
+	assertStatus(t, send(http.MethodPost, "/devices/router1/vrfs"), http.StatusOK)
+}
+
+func TestSerializeWrites_UnknownDevice(t *testing.T) {
+	_, _, client := newMockVyOS(t)
+	h := newHandler(client)
+	r := mux.NewRouter()
+	r.Use(h.SerializeWrites)
+	r.HandleFunc("/devices/{device_id}/vrfs", h.CreateVRF).Methods(http.MethodPost)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/devices/junk-device-id/vrfs", strings.NewReader(`{"name":"BLUE","table":"100"}`)))
+	assertStatus(t, w, http.StatusNotFound)
+
+	if body := do(t, http.MethodGet, "/metrics", nil, nil, h.Metrics).Body.String(); strings.Contains(body, `device="junk-device-id"`) {
+		t.Errorf("unknown device has write queue series:\n%s", body)
+	}
+}
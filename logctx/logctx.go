@@ -0,0 +1,90 @@
+// Package logctx carries a request ID and a request-scoped slog.Logger in a
+// context, so every log line written while serving a request, including the
+// lines for the VyOS calls it makes, can be tied back to it.
+package logctx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Header is the request and response header carrying the request ID.
+const Header = "X-Request-ID"
+
+// maxIDLen bounds an accepted X-Request-ID, so a caller cannot bloat every
+// log line of the request.
+const maxIDLen = 128
+
+type ctxKey int
+
+const (
+	loggerKey ctxKey = iota
+	idKey
+)
+
+// From returns the logger stored in ctx, or slog.Default() if there is none.
+func From(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// With returns a copy of ctx carrying logger.
+func With(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// RequestID returns the request ID stored in ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(idKey).(string)
+	return id
+}
+
+// Middleware assigns each request an ID: the caller's X-Request-ID if it is
+// well formed, otherwise a random one. The ID is set on the response header
+// before the handler runs, and the request context carries it together with
+// a logger that adds request_id (and trace_id, when the request is traced)
+// to every line.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !validID(id) {
+			id = newID()
+		}
+		w.Header().Set(Header, id)
+
+		logger := slog.Default().With("request_id", id)
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		ctx := context.WithValue(r.Context(), idKey, id)
+		next.ServeHTTP(w, r.WithContext(With(ctx, logger)))
+	})
+}
+
+// validID accepts IDs of printable ASCII without spaces or quotes, which is
+// what common proxies and client libraries generate.
+func validID(id string) bool {
+	if id == "" || len(id) > maxIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if c <= ' ' || c > '~' || c == '"' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
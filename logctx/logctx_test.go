@@ -0,0 +1,63 @@
+package logctx_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/valueiron/vyos-api/logctx"
+)
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	var seen string
+	h := logctx.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logctx.RequestID(r.Context())
+		logctx.From(r.Context()).Info("handled")
+	}))
+
+	tests := []struct {
+		name, header string
+		keep         bool
+	}{
+		{"accepted", "abc-123", true},
+		{"generated", "", false},
+		{"invalid replaced", "has space", false},
+		{"too long replaced", strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set(logctx.Header, tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			id := w.Header().Get(logctx.Header)
+			if id == "" || id != seen {
+				t.Fatalf("response ID %q, context ID %q; want equal and set", id, seen)
+			}
+			if (id == tt.header) != tt.keep {
+				t.Errorf("ID = %q for header %q", id, tt.header)
+			}
+			if !strings.Contains(buf.String(), `"request_id":"`+id+`"`) {
+				t.Errorf("log line lacks request_id: %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestFrom_Default(t *testing.T) {
+	if logctx.From(httptest.NewRequest(http.MethodGet, "/", nil).Context()) != slog.Default() {
+		t.Error("From without a logger should return slog.Default()")
+	}
+}
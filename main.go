@@ -2,41 +2,163 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/valueiron/vyos-api/audit"
+	"github.com/valueiron/vyos-api/auth"
 	"github.com/valueiron/vyos-api/handlers"
+	"github.com/valueiron/vyos-api/logctx"
+	"github.com/valueiron/vyos-api/snapshot"
+	"github.com/valueiron/vyos-api/tracing"
 	"github.com/valueiron/vyos-api/vyos"
 	"github.com/gorilla/mux"
 )
 
 func main() {
 	if len(os.Args) > 1 && os.Args[1] == "--healthcheck" {
-		runHealthCheck()
+		runHealthCheck("/health")
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "--readycheck" {
+		runHealthCheck("/ready")
 		return
 	}
 
+	level := slog.LevelInfo
+	var levelErr error
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		levelErr = level.UnmarshalText([]byte(v))
+	}
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+		Level: level,
 	}))
 	slog.SetDefault(logger)
+	if levelErr != nil {
+		slog.Warn("invalid LOG_LEVEL; using info", "error", levelErr)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		slog.Error("failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+	if tracing.Enabled() {
+		slog.Info("exporting traces over OTLP")
+	}
+
+	handlers.SetClientPolicies(clientPolicies(os.Getenv))
 
-	deviceMap := parseHosts(os.Getenv("VYOS_HOSTS"))
+	devicesFile := os.Getenv("VYOS_DEVICES_FILE")
+	var deviceMap map[string]*handlers.Device
+	if devicesFile != "" {
+		if os.Getenv("VYOS_HOSTS") != "" {
+			slog.Warn("VYOS_DEVICES_FILE is set; ignoring VYOS_HOSTS")
+		}
+		if deviceMap, err = loadDevicesFile(devicesFile); err != nil {
+			slog.Error("failed to load devices file", "path", devicesFile, "error", err)
+			os.Exit(1)
+		}
+	} else {
+		deviceMap = parseHosts(os.Getenv("VYOS_HOSTS"))
+		applyAutoSave(deviceMap, os.Getenv("VYOS_AUTOSAVE"))
+	}
 	h := handlers.New(deviceMap)
+	h.SetAutoSave(strings.Split(os.Getenv("VYOS_AUTOSAVE"), ","))
+	if devicesFile != "" {
+		persist, _ := strconv.ParseBool(os.Getenv("VYOS_DEVICES_PERSIST"))
+		h.SetDevicesFile(devicesFile, persist)
+	} else if os.Getenv("VYOS_DEVICES_PERSIST") != "" {
+		slog.Warn("VYOS_DEVICES_PERSIST requires VYOS_DEVICES_FILE; runtime device changes will not be persisted")
+	}
+	policy, err := handlers.ParseReadyPolicy(os.Getenv("VYOS_READY_POLICY"))
+	if err != nil {
+		slog.Error("invalid VYOS_READY_POLICY", "error", err)
+		os.Exit(1)
+	}
+	h.SetReadyPolicy(policy)
+	if path := os.Getenv("AUDIT_LOG_FILE"); path != "" {
+		auditLog, err := audit.Open(path)
+		if err != nil {
+			slog.Error("failed to open audit log", "path", path, "error", err)
+			os.Exit(1)
+		}
+		defer auditLog.Close()
+		h.SetAuditLog(auditLog)
+	}
+	var snapshotInterval time.Duration
+	if dir := os.Getenv("SNAPSHOT_DIR"); dir != "" {
+		retain := snapshot.DefaultRetain
+		envInt(os.Getenv, "SNAPSHOT_RETAIN", &retain)
+		envDuration(os.Getenv, "SNAPSHOT_INTERVAL", &snapshotInterval)
+		store, err := snapshot.Open(dir, retain)
+		if err != nil {
+			slog.Error("failed to open snapshot directory", "path", dir, "error", err)
+			os.Exit(1)
+		}
+		h.SetSnapshots(store)
+	}
+
+	authn, err := authenticator()
+	if err != nil {
+		slog.Error("failed to set up API authentication", "error", err)
+		os.Exit(1)
+	}
+	tlsCfg, err := serverTLS()
+	if err != nil {
+		slog.Error("failed to set up API TLS", "error", err)
+		os.Exit(1)
+	}
 
 	r := mux.NewRouter()
-	r.Use(loggingMiddleware)
+	r.Use(tracing.Middleware, logctx.Middleware, loggingMiddleware, handlers.MetricsMiddleware)
+	if len(authn) > 0 {
+		r.Use(auth.Middleware(authn, "/health"))
+	} else {
+		slog.Warn("API authentication disabled: anyone who can reach the service can change every device; set API_TOKENS_FILE, API_JWKS_FILE or API_TLS_CLIENT_CA_FILE")
+	}
+	if path := os.Getenv("API_POLICY_FILE"); path != "" {
+		if len(authn) == 0 {
+			slog.Error("API_POLICY_FILE requires API authentication to be configured")
+			os.Exit(1)
+		}
+		policy, err := auth.LoadPolicy(path)
+		if err != nil {
+			slog.Error("failed to load API policy", "path", path, "error", err)
+			os.Exit(1)
+		}
+		h.SetPolicy(policy)
+		r.Use(policy.Middleware(func(id string) []string {
+			if d, ok := h.Devices().Get(id); ok {
+				return d.Tags
+			}
+			return nil
+		}, "/health", "/whoami"))
+		slog.Info("API authorization policy loaded", "path", path, "roles", len(policy.Roles))
+	}
+	h.SetIdempotency(idempotencySettings(os.Getenv))
+	h.SetWriteQueue(writeQueueSettings(os.Getenv))
+	r.Use(h.Idempotency, h.SerializeWrites)
 
 	// Service endpoints.
 	r.HandleFunc("/health", h.Health).Methods(http.MethodGet)
+	r.HandleFunc("/ready", h.Ready).Methods(http.MethodGet)
+	r.HandleFunc("/metrics", h.Metrics).Methods(http.MethodGet)
+	r.HandleFunc("/whoami", h.WhoAmI).Methods(http.MethodGet)
+	r.HandleFunc("/audit", h.Audit).Methods(http.MethodGet)
 	r.HandleFunc("/devices", h.ListDevices).Methods(http.MethodGet)
+	r.HandleFunc("/devices/{device_id}", h.CreateDevice).Methods(http.MethodPost)
+	r.HandleFunc("/devices/{device_id}", h.UpdateDevice).Methods(http.MethodPut)
+	r.HandleFunc("/devices/{device_id}", h.DeleteDevice).Methods(http.MethodDelete)
 
 	// Networks (interfaces with IPv4).
 	r.HandleFunc("/devices/{device_id}/networks", h.ListNetworks).Methods(http.MethodGet)
@@ -101,6 +223,28 @@ func main() {
 	r.HandleFunc("/devices/{device_id}/dhcp/servers/{name}", h.UpdateDHCPServer).Methods(http.MethodPut)
 	r.HandleFunc("/devices/{device_id}/dhcp/servers/{name}", h.DeleteDHCPServer).Methods(http.MethodDelete)
 
+	// Config persistence (config-file save/load), raw batches and commit-confirm.
+	r.HandleFunc("/devices/{device_id}/config/save", h.SaveConfig).Methods(http.MethodPost)
+	r.HandleFunc("/devices/{device_id}/config/load", h.LoadConfig).Methods(http.MethodPost)
+	r.HandleFunc("/devices/{device_id}/config/batch", h.BatchConfig).Methods(http.MethodPost)
+	r.HandleFunc("/devices/{device_id}/config/confirm", h.ConfirmConfig).Methods(http.MethodPost)
+
+	// Transactions: several creates committed at once.
+	r.HandleFunc("/devices/{device_id}/transactions", h.Transaction).Methods(http.MethodPost)
+
+	// Configuration snapshots: history, diff and restore.
+	r.HandleFunc("/devices/{device_id}/snapshots", h.ListSnapshots).Methods(http.MethodGet)
+	r.HandleFunc("/devices/{device_id}/snapshots", h.CreateSnapshot).Methods(http.MethodPost)
+	r.HandleFunc("/devices/{device_id}/snapshots/{snapshot_id}", h.GetSnapshot).Methods(http.MethodGet)
+	r.HandleFunc("/devices/{device_id}/snapshots/{snapshot_id}/diff", h.DiffSnapshot).Methods(http.MethodGet)
+	r.HandleFunc("/devices/{device_id}/snapshots/{snapshot_id}/restore", h.RestoreSnapshot).Methods(http.MethodPost)
+
+	// Live operational state ("show" commands).
+	r.HandleFunc("/devices/{device_id}/state/interfaces", h.GetInterfaceState).Methods(http.MethodGet)
+	r.HandleFunc("/devices/{device_id}/state/routes", h.GetRouteState).Methods(http.MethodGet)
+	r.HandleFunc("/devices/{device_id}/state/dhcp-leases", h.GetDHCPLeases).Methods(http.MethodGet)
+	r.HandleFunc("/devices/{device_id}/state/version", h.GetVersion).Methods(http.MethodGet)
+
 	addr := ":8082"
 	if port := os.Getenv("PORT"); port != "" {
 		addr = ":" + port
@@ -109,19 +253,37 @@ func main() {
 	srv := &http.Server{
 		Addr:         addr,
 		Handler:      r,
+		TLSConfig:    tlsCfg,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 
 	go func() {
-		slog.Info("server starting", "addr", addr)
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Info("server starting", "addr", addr, "tls", tlsCfg != nil)
+		var err error
+		if tlsCfg != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			slog.Error("server error", "error", err)
 			os.Exit(1)
 		}
 	}()
 
+	if devicesFile != "" {
+		go watchDevicesFile(devicesFile, h.Devices())
+	}
+
+	monitorCtx, stopMonitor := context.WithCancel(context.Background())
+	defer stopMonitor()
+	go h.Monitor().Run(monitorCtx, healthInterval(os.Getenv("VYOS_HEALTH_INTERVAL")))
+	if snapshotInterval > 0 {
+		go h.RunSnapshots(monitorCtx, snapshotInterval)
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	sig := <-quit
@@ -135,6 +297,9 @@ func main() {
 		slog.Error("graceful shutdown failed", "error", err)
 		os.Exit(1)
 	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("flushing traces failed", "error", err)
+	}
 
 	slog.Info("server stopped gracefully")
 }
@@ -167,19 +332,278 @@ func parseHosts(hostsEnv string) map[string]*handlers.Device {
 		baseURL := parts[1] + ":" + parts[2] + ":" + parts[3] // e.g. "https://192.168.1.1:443"
 		apiKey := parts[4]
 
-		client := vyos.NewClient(nil).WithURL(baseURL).WithToken(apiKey).Insecure()
+		tlsCfg := tlsFromEnv(name, os.Getenv)
+		client, err := handlers.NewDeviceClient(name, baseURL, apiKey).WithTLS(tlsCfg)
+		if err != nil {
+			slog.Error("skipping VyOS device with invalid TLS settings", "name", name, "error", err)
+			continue
+		}
+		if tlsCfg.Insecure {
+			slog.Warn("TLS verification disabled for device", "name", name)
+		}
 		devices[name] = &handlers.Device{
 			ID:     name,
 			URL:    baseURL,
 			Client: client,
+			TLS:    tlsCfg,
 		}
 
-		slog.Info("registered VyOS device", "name", name, "url", baseURL)
+		slog.Info("registered VyOS device", "name", name, "url", baseURL, "tls", tlsCfg.Mode())
 	}
 
 	return devices
 }
 
+// loadDevicesFile loads the devices file (see handlers.DeviceFile) and
+// applies VYOS_AUTOSAVE on top of each entry's auto_save setting.
+func loadDevicesFile(path string) (map[string]*handlers.Device, error) {
+	devices, err := handlers.LoadDeviceFile(path)
+	if err != nil {
+		return nil, err
+	}
+	applyAutoSave(devices, os.Getenv("VYOS_AUTOSAVE"))
+	for _, d := range devices {
+		if d.TLS.Insecure {
+			slog.Warn("TLS verification disabled for device", "name", d.ID)
+		}
+	}
+	slog.Info("loaded devices file", "path", path, "devices", len(devices))
+	return devices, nil
+}
+
+// devicesFilePoll is how often watchDevicesFile checks the file for changes.
+const devicesFilePoll = 2 * time.Second
+
+// watchDevicesFile reloads the devices file into reg on SIGHUP and whenever
+// its modification time or size changes. A file that fails to load is logged
+// and the current devices are kept.
+func watchDevicesFile(path string, reg *handlers.Registry) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	stamp := func() (time.Time, int64) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return fi.ModTime(), fi.Size()
+	}
+	mod, size := stamp()
+
+	ticker := time.NewTicker(devicesFilePoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-hup:
+			slog.Info("SIGHUP received, reloading devices file", "path", path)
+		case <-ticker.C:
+			m, s := stamp()
+			if m.Equal(mod) && s == size {
+				continue
+			}
+			slog.Info("devices file changed, reloading", "path", path)
+		}
+		mod, size = stamp()
+		devices, err := loadDevicesFile(path)
+		if err != nil {
+			slog.Error("devices file reload failed; keeping current devices", "path", path, "error", err)
+			continue
+		}
+		reg.Replace(devices)
+	}
+}
+
+// tlsFromEnv returns the TLS settings for the named device. Each setting is
+// read from VYOS_<NAME>_TLS_<SETTING>, falling back to VYOS_TLS_<SETTING> for
+// all devices. <NAME> is the device name upper-cased with every character
+// other than a letter or digit replaced by "_".
+//
+// Settings: CA_FILE, FINGERPRINT, CERT_FILE, KEY_FILE, SERVER_NAME, INSECURE.
+// Example: VYOS_ROUTER1_TLS_FINGERPRINT=ab:cd:...  VYOS_TLS_CA_FILE=/etc/vyos/ca.pem
+func tlsFromEnv(name string, getenv func(string) string) vyos.TLSConfig {
+	prefix := "VYOS_" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name) + "_TLS_"
+	get := func(setting string) string {
+		if v := getenv(prefix + setting); v != "" {
+			return v
+		}
+		return getenv("VYOS_TLS_" + setting)
+	}
+	insecure, _ := strconv.ParseBool(get("INSECURE"))
+	return vyos.TLSConfig{
+		CAFile:      get("CA_FILE"),
+		Fingerprint: get("FINGERPRINT"),
+		CertFile:    get("CERT_FILE"),
+		KeyFile:     get("KEY_FILE"),
+		ServerName:  get("SERVER_NAME"),
+		Insecure:    insecure,
+	}
+}
+
+// applyAutoSave enables Device.AutoSave for the devices named in the
+// VYOS_AUTOSAVE environment variable.
+//
+// Format: comma-separated device names, or "*" for every device.
+// Example: router1,router2
+func applyAutoSave(devices map[string]*handlers.Device, autoSaveEnv string) {
+	for _, name := range strings.Split(autoSaveEnv, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if name == "*" {
+			for _, d := range devices {
+				d.AutoSave = true
+			}
+			slog.Info("auto-save enabled for all devices")
+			continue
+		}
+		d, ok := devices[name]
+		if !ok {
+			slog.Warn("skipping unknown device in VYOS_AUTOSAVE", "name", name)
+			continue
+		}
+		d.AutoSave = true
+		slog.Info("auto-save enabled", "name", name)
+	}
+}
+
+// authenticator builds the API authentication chain from the environment:
+// hashed bearer tokens from API_TOKENS_FILE, JWTs verified against
+// API_JWKS_FILE (optionally pinned to API_JWT_ISSUER and API_JWT_AUDIENCE),
+// and client certificates when API_TLS_CLIENT_CA_FILE is set. An empty chain
+// means authentication is off.
+func authenticator() (auth.Chain, error) {
+	var chain auth.Chain
+	if path := os.Getenv("API_TOKENS_FILE"); path != "" {
+		t, err := auth.LoadTokens(path)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, t)
+		slog.Info("API bearer token authentication enabled", "path", path)
+	}
+	if path := os.Getenv("API_JWKS_FILE"); path != "" {
+		j, err := auth.LoadJWKS(path, os.Getenv("API_JWT_ISSUER"), os.Getenv("API_JWT_AUDIENCE"))
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, j)
+		slog.Info("API JWT authentication enabled", "jwks", path)
+	}
+	if os.Getenv("API_TLS_CLIENT_CA_FILE") != "" {
+		chain = append(chain, auth.ClientCert{})
+		slog.Info("API client certificate authentication enabled")
+	}
+	return chain, nil
+}
+
+// serverTLS returns the listener TLS settings from API_TLS_CERT_FILE,
+// API_TLS_KEY_FILE and API_TLS_CLIENT_CA_FILE, or nil to serve plain HTTP.
+func serverTLS() (*tls.Config, error) {
+	cert, key, ca := os.Getenv("API_TLS_CERT_FILE"), os.Getenv("API_TLS_KEY_FILE"), os.Getenv("API_TLS_CLIENT_CA_FILE")
+	if cert == "" && key == "" {
+		if ca != "" {
+			return nil, errors.New("API_TLS_CLIENT_CA_FILE requires API_TLS_CERT_FILE and API_TLS_KEY_FILE")
+		}
+		return nil, nil
+	}
+	return auth.ServerTLSConfig(cert, key, ca)
+}
+
+// healthInterval parses the VYOS_HEALTH_INTERVAL environment variable, a
+// Go duration such as "30s" or "1m". An empty or invalid value yields
+// handlers.DefaultHealthInterval.
+func healthInterval(env string) time.Duration {
+	if env == "" {
+		return handlers.DefaultHealthInterval
+	}
+	d, err := time.ParseDuration(env)
+	if err != nil || d <= 0 {
+		slog.Warn("invalid VYOS_HEALTH_INTERVAL; using default", "value", env, "default", handlers.DefaultHealthInterval.String())
+		return handlers.DefaultHealthInterval
+	}
+	return d
+}
+
+// Default retry and circuit breaker settings for device clients.
+const (
+	defaultRetryAttempts    = 3
+	defaultRetryBackoff     = 200 * time.Millisecond
+	maxRetryBackoff         = 5 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// clientPolicies reads VYOS_RETRY_ATTEMPTS, VYOS_RETRY_BACKOFF,
+// VYOS_BREAKER_THRESHOLD and VYOS_BREAKER_COOLDOWN, falling back to the
+// defaults for empty or invalid values.
+func clientPolicies(getenv func(string) string) (vyos.RetryPolicy, vyos.BreakerPolicy) {
+	retry := vyos.RetryPolicy{Attempts: defaultRetryAttempts, Backoff: defaultRetryBackoff, MaxBackoff: maxRetryBackoff}
+	breaker := vyos.BreakerPolicy{Threshold: defaultBreakerThreshold, Cooldown: defaultBreakerCooldown}
+	envInt(getenv, "VYOS_RETRY_ATTEMPTS", &retry.Attempts)
+	envDuration(getenv, "VYOS_RETRY_BACKOFF", &retry.Backoff)
+	envInt(getenv, "VYOS_BREAKER_THRESHOLD", &breaker.Threshold)
+	envDuration(getenv, "VYOS_BREAKER_COOLDOWN", &breaker.Cooldown)
+	return retry, breaker
+}
+
+// envInt sets *v from the non-negative integer in the named variable, if it
+// is set and valid.
+func envInt(getenv func(string) string, name string, v *int) {
+	s := getenv(name)
+	if s == "" {
+		return
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		slog.Warn("invalid "+name+"; using default", "value", s, "default", *v)
+		return
+	}
+	*v = n
+}
+
+// envDuration sets *v from the positive Go duration in the named variable,
+// if it is set and valid.
+func envDuration(getenv func(string) string, name string, v *time.Duration) {
+	s := getenv(name)
+	if s == "" {
+		return
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		slog.Warn("invalid "+name+"; using default", "value", s, "default", v.String())
+		return
+	}
+	*v = d
+}
+
+// writeQueueSettings reads VYOS_WRITE_QUEUE_DEPTH and VYOS_WRITE_TIMEOUT,
+// falling back to the defaults for empty or invalid values.
+func writeQueueSettings(getenv func(string) string) (int, time.Duration) {
+	depth, wait := handlers.DefaultWriteQueueDepth, handlers.DefaultWriteTimeout
+	envInt(getenv, "VYOS_WRITE_QUEUE_DEPTH", &depth)
+	envDuration(getenv, "VYOS_WRITE_TIMEOUT", &wait)
+	return depth, wait
+}
+
+// idempotencySettings reads IDEMPOTENCY_MAX_KEYS and IDEMPOTENCY_TTL,
+// falling back to the defaults for empty or invalid values.
+func idempotencySettings(getenv func(string) string) (int, time.Duration) {
+	keys, ttl := handlers.DefaultIdempotencyKeys, handlers.DefaultIdempotencyTTL
+	envInt(getenv, "IDEMPOTENCY_MAX_KEYS", &keys)
+	envDuration(getenv, "IDEMPOTENCY_TTL", &ttl)
+	return keys, ttl
+}
+
 // responseWriter wraps http.ResponseWriter to capture the status code for logging.
 type responseWriter struct {
 	http.ResponseWriter
@@ -200,7 +624,7 @@ func loggingMiddleware(next http.Handler) http.Handler {
 		start := time.Now()
 		rw := newResponseWriter(w)
 		next.ServeHTTP(rw, r)
-		slog.Info("request",
+		logctx.From(r.Context()).Info("request",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"status", rw.statusCode,
@@ -210,16 +634,34 @@ func loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// runHealthCheck performs an HTTP GET against the /health endpoint and exits
-// with a non-zero code on failure. Used as the container health probe so that
-// the distroless runtime image does not need curl or wget.
-func runHealthCheck() {
+// runHealthCheck performs an HTTP GET against path (/health, or /ready for
+// --readycheck) and exits with a non-zero code on failure. /ready requires
+// authentication when it is enabled; API_HEALTHCHECK_TOKEN is sent as a
+// bearer token if set. Used as the
+// container health probe so that the distroless runtime image does not need
+// curl or wget.
+func runHealthCheck(path string) {
 	port := "8082"
 	if p := os.Getenv("PORT"); p != "" {
 		port = p
 	}
+	scheme := "http"
 	c := &http.Client{Timeout: 5 * time.Second}
-	resp, err := c.Get("http://localhost:" + port + "/health")
+	if os.Getenv("API_TLS_CERT_FILE") != "" {
+		// The certificate is issued for the service's public name, not
+		// localhost, and this only checks the local process.
+		scheme = "https"
+		c.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	req, err := http.NewRequest(http.MethodGet, scheme+"://localhost:"+port+path, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "healthcheck: %v\n", err)
+		os.Exit(1)
+	}
+	if token := os.Getenv("API_HEALTHCHECK_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.Do(req)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "healthcheck: %v\n", err)
 		os.Exit(1)
@@ -0,0 +1,248 @@
+// Package snapshot stores point-in-time copies of device configurations as
+// JSON files, one directory per device.
+package snapshot
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRetain is the number of snapshots kept per device by default.
+const DefaultRetain = 100
+
+// Triggers recorded in Meta.Trigger.
+const (
+	Manual    = "manual"
+	Scheduled = "scheduled"
+	PreChange = "pre-change"
+)
+
+// ErrNotFound means the device has no snapshot with the requested ID.
+var ErrNotFound = errors.New("snapshot not found")
+
+// idFormat is the time part of a snapshot ID. IDs sort in the order the
+// snapshots were taken.
+const idFormat = "20060102T150405.000000Z"
+
+var validID = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}\.[0-9]{6}Z-[0-9a-f]{8}$`)
+
+// Meta describes a snapshot.
+type Meta struct {
+	ID      string    `json:"id"`
+	Device  string    `json:"device"`
+	Time    time.Time `json:"time"`
+	Trigger string    `json:"trigger"`
+	// Description is set by the caller of a manual snapshot.
+	Description string `json:"description,omitempty"`
+	// Principal and RequestID identify the request that took the snapshot;
+	// both are empty for scheduled snapshots.
+	Principal string `json:"principal,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// Request is the method and path of the change a pre-change snapshot
+	// was taken before, e.g. "DELETE /devices/router1/vrfs/BLUE".
+	Request string `json:"request,omitempty"`
+	// Digest is the hex SHA-256 of the configuration's JSON encoding, so two
+	// snapshots with the same digest hold the same configuration.
+	Digest string `json:"digest"`
+}
+
+// Snapshot is a device's full configuration tree, as Conf.GetPath returns it
+// for the root, with its metadata.
+type Snapshot struct {
+	Meta
+	Config interface{} `json:"config"`
+}
+
+// Digest returns the value Meta.Digest holds for config.
+func Digest(config interface{}) string {
+	// Maps are encoded with sorted keys, so equal trees have equal digests.
+	b, _ := json.Marshal(config)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Store keeps snapshots under a directory, at most retain per device, dropping
+// the oldest first. It is safe for concurrent use.
+type Store struct {
+	dir    string
+	retain int
+
+	mu sync.Mutex
+	// last is the time of the latest snapshot saved, so that the next one
+	// is given a later time and its ID sorts after it.
+	last time.Time
+}
+
+// Open returns a Store keeping snapshots under dir, creating it with mode
+// 0700 if needed. Snapshots hold configuration secrets, so files are written
+// with mode 0600. retain of zero keeps every snapshot.
+func Open(dir string, retain int) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, retain: retain}, nil
+}
+
+// deviceDir returns the directory holding the snapshots of device.
+func (s *Store) deviceDir(device string) (string, error) {
+	name := url.PathEscape(device)
+	if name == "" || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid device ID %q", device)
+	}
+	return filepath.Join(s.dir, name), nil
+}
+
+// Save assigns snap an ID, time and digest and writes it, then drops the
+// device's oldest snapshots beyond the retain limit.
+func (s *Store) Save(snap *Snapshot) error {
+	dir, err := s.deviceDir(snap.Device)
+	if err != nil {
+		return err
+	}
+	snap.Digest = Digest(snap.Config)
+	var suffix [4]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if snap.Time.IsZero() {
+		snap.Time = time.Now().UTC().Truncate(time.Microsecond)
+		if !snap.Time.After(s.last) {
+			snap.Time = s.last.Add(time.Microsecond)
+		}
+	}
+	if snap.Time.After(s.last) {
+		s.last = snap.Time
+	}
+	snap.ID = snap.Time.UTC().Format(idFormat) + "-" + hex.EncodeToString(suffix[:])
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash cannot leave a torn
+	// snapshot under a valid ID.
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, snap.ID+".json")); err != nil {
+		return err
+	}
+	return s.prune(dir)
+}
+
+// prune removes the oldest snapshots in dir beyond the retain limit.
+func (s *Store) prune(dir string) error {
+	if s.retain <= 0 {
+		return nil
+	}
+	ids, err := listIDs(dir)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids[:max(len(ids)-s.retain, 0)] {
+		if err := os.Remove(filepath.Join(dir, id+".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// listIDs returns the IDs of the snapshots in dir, oldest first.
+func listIDs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if ok && validID.MatchString(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// List returns the metadata of the device's snapshots, oldest first. A file
+// that cannot be read or decoded is skipped.
+func (s *Store) List(device string) ([]Meta, error) {
+	dir, err := s.deviceDir(device)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := listIDs(dir)
+	if err != nil {
+		return nil, err
+	}
+	metas := []Meta{}
+	for _, id := range ids {
+		data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+		if err != nil {
+			continue
+		}
+		var m Meta
+		if json.Unmarshal(data, &m) != nil {
+			continue
+		}
+		metas = append(metas, m)
+	}
+	return metas, nil
+}
+
+// Get returns the device's snapshot with the given ID, or ErrNotFound.
+func (s *Store) Get(device, id string) (*Snapshot, error) {
+	dir, err := s.deviceDir(device)
+	if err != nil {
+		return nil, err
+	}
+	if !validID.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", id, err)
+	}
+	return &snap, nil
+}
@@ -0,0 +1,99 @@
+package snapshot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStore_SaveListGet(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var saved []*Snapshot
+	for i, name := range []string{"A", "B", "C"} {
+		snap := &Snapshot{
+			Meta:   Meta{Device: "r1", Time: t0.Add(time.Duration(i) * time.Minute), Trigger: Manual},
+			Config: map[string]interface{}{"system": map[string]interface{}{"host-name": name}},
+		}
+		if err := s.Save(snap); err != nil {
+			t.Fatal(err)
+		}
+		saved = append(saved, snap)
+	}
+
+	// The oldest is dropped beyond the retain limit.
+	metas, err := s.List("r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metas) != 2 || metas[0].ID != saved[1].ID || metas[1].ID != saved[2].ID {
+		t.Fatalf("List = %+v, want the last two snapshots", metas)
+	}
+	if _, err := s.Get("r1", saved[0].ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(pruned) error = %v, want ErrNotFound", err)
+	}
+
+	got, err := s.Get("r1", saved[2].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Config, saved[2].Config) || got.Digest != saved[2].Digest || got.Digest == saved[1].Digest {
+		t.Errorf("Get = %+v, want %+v", got, saved[2])
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "r1", got.ID+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("snapshot file mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestStore_Order(t *testing.T) {
+	s, err := Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for range 50 {
+		snap := &Snapshot{Meta: Meta{Device: "r1", Trigger: PreChange}}
+		if err := s.Save(snap); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, snap.ID)
+	}
+	metas, err := s.List("r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range metas {
+		if m.ID != ids[i] {
+			t.Fatalf("List()[%d] = %s, want %s: snapshots taken back to back are out of order", i, m.ID, ids[i])
+		}
+	}
+}
+
+func TestStore_Invalid(t *testing.T) {
+	s, err := Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metas, err := s.List("r2"); err != nil || len(metas) != 0 {
+		t.Errorf("List(no snapshots) = %v, %v", metas, err)
+	}
+	if _, err := s.Get("r1", "../../etc/passwd"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(bad ID) error = %v, want ErrNotFound", err)
+	}
+	if err := s.Save(&Snapshot{Meta: Meta{Device: ".."}}); err == nil {
+		t.Error("Save accepted device ID ..")
+	}
+}
@@ -0,0 +1,106 @@
+// Package tracing sets up OpenTelemetry tracing for the service: W3C trace
+// context propagation, a server span per inbound request, and export over
+// OTLP/HTTP.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is the service.name resource attribute unless OTEL_SERVICE_NAME
+// overrides it.
+const ServiceName = "vyos-api"
+
+var tracer = otel.Tracer("github.com/valueiron/vyos-api/tracing")
+
+// Enabled reports whether an OTLP endpoint is configured, via
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT.
+func Enabled() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != ""
+}
+
+// Setup installs the W3C trace context propagator and, if Enabled, a tracer
+// provider exporting to the configured OTLP/HTTP endpoint. The exporter reads
+// the standard OTEL_EXPORTER_OTLP_* variables (endpoint, headers, timeout),
+// and sampling follows OTEL_TRACES_SAMPLER. The returned function flushes
+// pending spans and must be called before exit.
+func Setup(ctx context.Context) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+	if !Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exp, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Middleware starts a server span for each request, continuing the trace
+// from the request's traceparent header if it has one. The span is named
+// after the route template, e.g. "GET /devices/{device_id}/vrfs".
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if tpl, err := cr.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+			))
+		defer span.End()
+		if id, ok := mux.Vars(r)["device_id"]; ok {
+			span.SetAttributes(attribute.String("vyos.device", id))
+		}
+
+		rw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r.WithContext(ctx))
+		span.SetAttributes(attribute.Int("http.response.status_code", rw.status))
+		if rw.status >= 500 {
+			span.SetStatus(codes.Error, strconv.Itoa(rw.status))
+		}
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
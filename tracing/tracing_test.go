@@ -0,0 +1,135 @@
+package tracing_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/valueiron/vyos-api/tracing"
+	"github.com/valueiron/vyos-api/vyos"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector is a minimal OTLP/HTTP trace receiver.
+type collector struct {
+	mu    sync.Mutex
+	spans []*tracepb.Span
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var req coltracepb.ExportTraceServiceRequest
+	if r.URL.Path != "/v1/traces" || proto.Unmarshal(body, &req) != nil {
+		http.Error(w, "bad export", http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+	c.mu.Unlock()
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	out, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Write(out) //nolint:errcheck
+}
+
+func (c *collector) span(name string) *tracepb.Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func attr(s *tracepb.Span, key string) string {
+	for _, kv := range s.Attributes {
+		if kv.Key == key {
+			return kv.Value.GetStringValue()
+		}
+	}
+	return ""
+}
+
+func TestSetup_ExportsRequestAndDeviceSpans(t *testing.T) {
+	col := &collector{}
+	colSrv := httptest.NewServer(col)
+	t.Cleanup(colSrv.Close)
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", colSrv.URL+"/v1/traces")
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	shutdown, err := tracing.Setup(context.Background())
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+
+	var deviceTraceparent string
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deviceTraceparent = r.Header.Get("traceparent")
+		w.Write([]byte(`{"success":true,"data":"vyos","error":null}`)) //nolint:errcheck
+	}))
+	t.Cleanup(device.Close)
+	client := vyos.NewClient(nil).WithName("router1").WithURL(device.URL)
+
+	r := mux.NewRouter()
+	r.Use(tracing.Middleware)
+	r.HandleFunc("/devices/{device_id}/hostname", func(w http.ResponseWriter, r *http.Request) {
+		client.Conf.GetPath(r.Context(), []string{"system", "host-name"}) //nolint:errcheck
+	})
+	req := httptest.NewRequest(http.MethodGet, "/devices/router1/hostname", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	server := col.span("GET /devices/{device_id}/hostname")
+	if server == nil {
+		t.Fatalf("server span not exported; got %d spans", len(col.spans))
+	}
+	if fmt.Sprintf("%x", server.ParentSpanId) != "00f067aa0ba902b7" {
+		t.Errorf("server span parent = %x, want the inbound traceparent's span", server.ParentSpanId)
+	}
+	upstream := col.span("vyos /retrieve")
+	if upstream == nil {
+		t.Fatal("device span not exported")
+	}
+	if string(upstream.ParentSpanId) != string(server.SpanId) || string(upstream.TraceId) != string(server.TraceId) {
+		t.Error("device span is not a child of the request span")
+	}
+	if attr(upstream, "vyos.device") != "router1" || attr(upstream, "vyos.op") != "showConfig" {
+		t.Errorf("device span attributes = %v", upstream.Attributes)
+	}
+	if deviceTraceparent == "" {
+		t.Error("trace context not propagated to the device")
+	}
+}
+
+func TestSetup_DisabledWithoutEndpoint(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	if tracing.Enabled() {
+		t.Fatal("Enabled() = true with no endpoint")
+	}
+	shutdown, err := tracing.Setup(context.Background())
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown: %v", err)
+	}
+}
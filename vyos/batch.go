@@ -0,0 +1,157 @@
+package vyos
+
+import (
+	"context"
+	"strings"
+)
+
+// Op is a single configuration operation within a Batch.
+type Op struct {
+	Op   string   `json:"op"`
+	Path []string `json:"path"`
+}
+
+// Batch accumulates set and delete operations and sends them to /configure as
+// one JSON array. VyOS applies the whole array in a single commit, so either
+// every operation takes effect or none does.
+type Batch struct {
+	conf *Conf
+	ops  []Op
+}
+
+// Batch returns an empty Batch bound to conf's client.
+func (conf *Conf) Batch() *Batch {
+	return &Batch{conf: conf}
+}
+
+// Set queues a set operation. As with SetPath, the value is the final element
+// of path. The slice is copied, so callers may reuse it.
+func (b *Batch) Set(path []string) *Batch {
+	return b.add("set", path)
+}
+
+// Delete queues a delete operation for the node at path.
+func (b *Batch) Delete(path []string) *Batch {
+	return b.add("delete", path)
+}
+
+func (b *Batch) add(op string, path []string) *Batch {
+	p := make([]string, len(path))
+	copy(p, path)
+	b.ops = append(b.ops, Op{Op: op, Path: p})
+	return b
+}
+
+// Ops returns the queued operations in order.
+func (b *Batch) Ops() []Op {
+	return b.ops
+}
+
+// Len returns the number of queued operations.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Commit sends all queued operations in one /configure request. An empty batch
+// succeeds without contacting the device.
+func (b *Batch) Commit(ctx context.Context) (*Response, error) {
+	if len(b.ops) == 0 {
+		return &Response{Success: true}, nil
+	}
+	return b.conf.client.post(ctx, "/configure", b.ops)
+}
+
+// CommitConfirm sends the queued operations like Commit, but as a
+// commit-confirm: unless Conf.Confirm is called within minutes, VyOS reverts
+// to the previous configuration (by reboot or reload, per the device's
+// "system config-management commit-confirm action"). An empty batch succeeds
+// without contacting the device.
+func (b *Batch) CommitConfirm(ctx context.Context, minutes int) (*Response, error) {
+	if len(b.ops) == 0 {
+		return &Response{Success: true}, nil
+	}
+	return b.conf.client.post(ctx, "/configure", map[string]interface{}{
+		"commands":     b.ops,
+		"confirm_time": minutes,
+	})
+}
+
+// Outcomes reported in OpResult.Status.
+const (
+	// OpApplied marks an operation of a batch that was committed.
+	OpApplied = "applied"
+	// OpRejected marks an operation that VyOS named in its error message.
+	OpRejected = "rejected"
+	// OpDiscarded marks an operation that was valid on its own but was
+	// dropped because VyOS discards the whole session when any op fails.
+	OpDiscarded = "discarded"
+)
+
+// OpResult reports what happened to one operation of a rejected batch.
+type OpResult struct {
+	Op     string   `json:"op"`
+	Path   []string `json:"path"`
+	Status string   `json:"status"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// Explain attributes a device error message to the batch's operations. VyOS
+// names the offending path in its error text (e.g. "Configuration path:
+// [nat source rule 10 protocol foo] is not valid"); those ops are reported as
+// rejected together with the message lines that follow, and every other op as
+// discarded. If no path can be matched and the batch holds a single op, that
+// op is reported as rejected with the full message.
+func (b *Batch) Explain(msg string) []OpResult {
+	lines := strings.Split(strings.TrimSpace(msg), "\n")
+
+	// Find the first line that names each op's path.
+	at := make([]int, len(b.ops))
+	starts := map[int]bool{}
+	for i, op := range b.ops {
+		at[i] = -1
+		for n, line := range lines {
+			if mentionsPath(line, op.Path) {
+				at[i] = n
+				starts[n] = true
+				break
+			}
+		}
+	}
+
+	results := make([]OpResult, len(b.ops))
+	matched := false
+	for i, op := range b.ops {
+		results[i] = OpResult{Op: op.Op, Path: op.Path, Status: OpDiscarded}
+		if at[i] < 0 {
+			continue
+		}
+		// The reason runs from the naming line to the next line that names
+		// another op, or to the end of the message.
+		end := at[i] + 1
+		for end < len(lines) && !starts[end] {
+			end++
+		}
+		results[i].Status = OpRejected
+		results[i].Error = strings.TrimSpace(strings.Join(lines[at[i]:end], "\n"))
+		matched = true
+	}
+	if !matched && len(results) == 1 {
+		results[0].Status = OpRejected
+		results[0].Error = strings.TrimSpace(msg)
+	}
+	return results
+}
+
+// mentionsPath reports whether line contains path in either of the forms VyOS
+// uses in error messages: space-joined, or with the value single-quoted.
+func mentionsPath(line string, path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	if strings.Contains(line, "["+strings.Join(path, " ")+"]") {
+		return true
+	}
+	n := len(path) - 1
+	quoted := strings.Join(append(append([]string{}, path[:n]...), "'"+path[n]+"'"), " ")
+	return strings.Contains(line, "["+quoted+"]")
+}
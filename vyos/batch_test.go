@@ -0,0 +1,58 @@
+package vyos
+
+import "testing"
+
+func TestBatchExplain(t *testing.T) {
+	b := (&Conf{}).Batch().
+		Set([]string{"nat", "source", "rule", "10", "translation", "address", "masquerade"}).
+		Set([]string{"nat", "source", "rule", "10", "protocol", "bogus"}).
+		Set([]string{"nat", "source", "rule", "10", "description", "LAN out"})
+
+	msg := "Configuration path: [nat source rule 10 protocol 'bogus'] is not valid\nInvalid protocol\n\nSet failed"
+	got := b.Explain(msg)
+	if len(got) != 3 {
+		t.Fatalf("got %d results, want 3", len(got))
+	}
+	want := []string{OpDiscarded, OpRejected, OpDiscarded}
+	for i, res := range got {
+		if res.Status != want[i] {
+			t.Errorf("result %d status = %q, want %q", i, res.Status, want[i])
+		}
+	}
+	if got[1].Error != msg {
+		t.Errorf("reason = %q, want %q", got[1].Error, msg)
+	}
+}
+
+func TestBatchExplain_SingleOpUnmatched(t *testing.T) {
+	b := (&Conf{}).Batch().Delete([]string{"vrf", "name", "BLUE"})
+	got := b.Explain("Commit failed")
+	if got[0].Status != OpRejected || got[0].Error != "Commit failed" {
+		t.Errorf("got %+v, want rejected with full message", got[0])
+	}
+}
+
+func TestSpanAttributes_Batch(t *testing.T) {
+	ops := []Op{
+		{Op: "set", Path: []string{"vrf", "name", "blue", "table", "100"}},
+		{Op: "delete", Path: []string{"vrf", "name", "red"}},
+	}
+	attrs := describe(map[string]interface{}{"commands": ops, "confirm_time": 5}).spanAttributes("router1", "/configure")
+	got := map[string]string{}
+	for _, kv := range attrs {
+		got[string(kv.Key)] = kv.Value.Emit()
+	}
+	want := map[string]string{
+		"vyos.endpoint":        "/configure",
+		"vyos.device":          "router1",
+		"vyos.op":              "batch",
+		"vyos.op_count":        "2",
+		"vyos.ops":             `["set vrf name blue table 100","delete vrf name red"]`,
+		"vyos.confirm_minutes": "5",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+}
@@ -5,12 +5,24 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
+	"time"
+
+	"github.com/valueiron/vyos-api/logctx"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracer creates a span for every request a Client sends. It follows the
+// global TracerProvider, so spans are dropped unless tracing is set up.
+var tracer = otel.Tracer("github.com/valueiron/vyos-api/vyos")
+
 // Response is the VyOS API response envelope.
 type Response struct {
 	Success bool        `json:"success"`
@@ -20,17 +32,33 @@ type Response struct {
 
 // Client talks to the VyOS HTTP API.
 type Client struct {
-	baseURL string
-	key     string
-	http    *http.Client
-	Conf    *Conf
+	name       string
+	baseURL    string
+	key        string
+	http       *http.Client
+	Conf       *Conf
+	ConfigFile *ConfigFile
+	Show       *Show
+
+	observe Observer
+	retry   RetryPolicy
+	breaker *breaker
 }
 
-// Conf exposes configuration operations (Get, Set, Delete).
+// Observer is told about every request a Client sends: the API endpoint,
+// how long the device took to answer, and the error, if any.
+type Observer func(endpoint string, elapsed time.Duration, err error)
+
+// Conf exposes configuration operations (Get, Set, Delete, Confirm).
 type Conf struct {
 	client *Client
 }
 
+// ConfigFile exposes config file operations (Save, Load).
+type ConfigFile struct {
+	client *Client
+}
+
 // NewClient returns a Client. If httpClient is nil, http.DefaultClient is used.
 func NewClient(httpClient *http.Client) *Client {
 	c := &Client{http: httpClient}
@@ -38,6 +66,8 @@ func NewClient(httpClient *http.Client) *Client {
 		c.http = http.DefaultClient
 	}
 	c.Conf = &Conf{client: c}
+	c.ConfigFile = &ConfigFile{client: c}
+	c.Show = &Show{client: c}
 	return c
 }
 
@@ -47,13 +77,36 @@ func (c *Client) WithURL(baseURL string) *Client {
 	return c
 }
 
+// WithName sets the device name recorded on trace spans.
+func (c *Client) WithName(name string) *Client {
+	c.name = name
+	return c
+}
+
 // WithToken sets the API key sent as the "key" form field.
 func (c *Client) WithToken(key string) *Client {
 	c.key = key
 	return c
 }
 
-// Insecure configures the HTTP client to skip TLS verification.
+// WithTimeout limits each request to the device, including reading the
+// response, to d. Zero means no limit.
+func (c *Client) WithTimeout(d time.Duration) *Client {
+	hc := *c.http
+	hc.Timeout = d
+	c.http = &hc
+	return c
+}
+
+// WithObserver sets a function called after every request, e.g. to record
+// metrics. It must be safe for concurrent use.
+func (c *Client) WithObserver(o Observer) *Client {
+	c.observe = o
+	return c
+}
+
+// Insecure configures the HTTP client to skip TLS verification. Prefer WithTLS
+// with a CA file or pinned fingerprint, which still authenticates the device.
 func (c *Client) Insecure() *Client {
 	c.http = &http.Client{
 		Transport: &http.Transport{
@@ -71,7 +124,157 @@ func pathToArr(path string) []string {
 	return strings.Fields(path)
 }
 
+// post sends payload to endpoint and decodes the response envelope. If the
+// device answers with success=false (VyOS usually pairs this with HTTP 400)
+// the envelope is returned together with an *Error; failures to reach the
+// device or decode its answer are returned as a *TransportError. Failed
+// attempts are retried according to the client's RetryPolicy.
 func (c *Client) post(ctx context.Context, endpoint string, payload interface{}) (*Response, error) {
+	req := describe(payload)
+	ctx, span := tracer.Start(ctx, "vyos "+endpoint, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(req.spanAttributes(c.name, endpoint)...))
+	defer span.End()
+
+	start := time.Now()
+	var out *Response
+	var err error
+	attempts := 0
+	for {
+		attempts++
+		out, err = c.attempt(ctx, endpoint, payload)
+		delay, ok := c.retryDelay(ctx, endpoint, attempts, err)
+		if !ok {
+			break
+		}
+		span.AddEvent("retry", trace.WithAttributes(attribute.Int("vyos.attempt", attempts),
+			attribute.String("vyos.error", ErrorClass(err))))
+		logctx.From(ctx).Info("retrying vyos request", append(req.logArgs(c.name, endpoint),
+			"attempt", attempts, "delay_ms", delay.Milliseconds(), "error_class", ErrorClass(err), "error", err)...)
+		if sleep(ctx, delay) != nil {
+			break
+		}
+	}
+	elapsed := time.Since(start)
+
+	span.SetAttributes(attribute.Bool("vyos.success", err == nil))
+	logArgs := append(req.logArgs(c.name, endpoint), "duration_ms", elapsed.Milliseconds())
+	if attempts > 1 {
+		span.SetAttributes(attribute.Int("vyos.attempts", attempts))
+		logArgs = append(logArgs, "attempts", attempts)
+	}
+	if err != nil {
+		span.SetAttributes(attribute.String("vyos.error", ErrorClass(err)))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, Message(err))
+		logctx.From(ctx).Warn("vyos request failed", append(logArgs, "error_class", ErrorClass(err), "error", err)...)
+	} else {
+		logctx.From(ctx).Debug("vyos request", logArgs...)
+	}
+	return out, err
+}
+
+// attempt sends one request, unless the circuit breaker is open, and reports
+// it to the breaker and the observer.
+func (c *Client) attempt(ctx context.Context, endpoint string, payload interface{}) (*Response, error) {
+	var trial bool
+	if c.breaker != nil {
+		var err error
+		if trial, err = c.breaker.allow(endpoint); err != nil {
+			return nil, err
+		}
+	}
+	start := time.Now()
+	out, err := c.send(ctx, endpoint, payload)
+	if c.breaker != nil {
+		c.breaker.done(ctx, trial, err)
+	}
+	if c.observe != nil {
+		c.observe(endpoint, time.Since(start), err)
+	}
+	return out, err
+}
+
+// request describes a payload for spans and logs, with secrets redacted
+// (see RedactPath).
+type request struct {
+	op      string
+	path    []string // single operations
+	ops     []string // batches, one "op path..." string per operation
+	confirm int
+	file    string
+}
+
+func describe(payload interface{}) request {
+	var req request
+	batch := func(ops []Op) {
+		req.op = "batch"
+		req.ops = make([]string, len(ops))
+		for i, op := range ops {
+			req.ops[i] = strings.TrimSpace(op.Op + " " + strings.Join(RedactPath(op.Path), " "))
+		}
+	}
+	switch p := payload.(type) {
+	case []Op:
+		batch(p)
+	case map[string]interface{}:
+		if ops, ok := p["commands"].([]Op); ok {
+			batch(ops)
+			req.confirm, _ = p["confirm_time"].(int)
+			break
+		}
+		req.op, _ = p["op"].(string)
+		if path, ok := p["path"].([]string); ok {
+			req.path = RedactPath(path)
+		}
+		req.file, _ = p["file"].(string)
+	}
+	return req
+}
+
+// spanAttributes returns the trace span attributes for req: the device, the
+// endpoint, and the operation with its path, or every operation of a batch.
+func (req request) spanAttributes(device, endpoint string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.String("vyos.endpoint", endpoint)}
+	if device != "" {
+		attrs = append(attrs, attribute.String("vyos.device", device))
+	}
+	if req.op != "" {
+		attrs = append(attrs, attribute.String("vyos.op", req.op))
+	}
+	if req.path != nil {
+		attrs = append(attrs, attribute.StringSlice("vyos.path", req.path))
+	}
+	if req.ops != nil {
+		attrs = append(attrs, attribute.Int("vyos.op_count", len(req.ops)), attribute.StringSlice("vyos.ops", req.ops))
+	}
+	if req.confirm != 0 {
+		attrs = append(attrs, attribute.Int("vyos.confirm_minutes", req.confirm))
+	}
+	if req.file != "" {
+		attrs = append(attrs, attribute.String("vyos.file", req.file))
+	}
+	return attrs
+}
+
+// logArgs returns the slog key-value pairs for req.
+func (req request) logArgs(device, endpoint string) []any {
+	args := []any{"device", device, "endpoint", endpoint, "op", req.op}
+	if req.path != nil {
+		args = append(args, "path", strings.Join(req.path, " "))
+	}
+	if req.ops != nil {
+		args = append(args, "ops", req.ops)
+	}
+	if req.confirm != 0 {
+		args = append(args, "confirm_minutes", req.confirm)
+	}
+	if req.file != "" {
+		args = append(args, "file", req.file)
+	}
+	return args
+}
+
+func (c *Client) send(ctx context.Context, endpoint string, payload interface{}) (*Response, error) {
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return nil, err
@@ -88,65 +291,118 @@ func (c *Client) post(ctx context.Context, endpoint string, payload interface{})
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	resp, err := c.http.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, &TransportError{Endpoint: endpoint, Err: err}
 	}
 	defer resp.Body.Close()
 
 	var out Response
 	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return nil, err
+		// An auth failure is reported even if the body is not an envelope.
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return nil, classify(endpoint, resp.StatusCode, nil)
+		}
+		return nil, &TransportError{Endpoint: endpoint, Status: resp.StatusCode, Err: err}
 	}
-	if resp.StatusCode != http.StatusOK {
-		return &out, &httpStatusError{code: resp.StatusCode}
+	if !out.Success || resp.StatusCode != http.StatusOK {
+		if out.Success {
+			// A non-200 status with success=true is not a VyOS answer.
+			return nil, &TransportError{Endpoint: endpoint, Status: resp.StatusCode, Err: fmt.Errorf("unexpected status %d", resp.StatusCode)}
+		}
+		return &out, classify(endpoint, resp.StatusCode, out.Error)
 	}
 	return &out, nil
 }
 
-type httpStatusError struct{ code int }
-
-func (e *httpStatusError) Error() string {
-	return "vyos api: unexpected status " + strconv.Itoa(e.code)
-}
-
 // Get retrieves configuration at the given space-separated path.
 // The third argument is ignored (for API compatibility).
+//
+// Deprecated: the path is split on whitespace, so values containing spaces
+// cannot be addressed. Use GetPath.
 func (conf *Conf) Get(ctx context.Context, path string, _ interface{}) (*Response, interface{}, error) {
-	pathArr := pathToArr(path)
-	out, err := conf.client.post(ctx, "/retrieve", map[string]interface{}{
-		"op":   "showConfig",
-		"path": pathArr,
-	})
-	if err != nil {
-		return nil, nil, err
-	}
-	return out, nil, nil
+	out, err := conf.GetPath(ctx, pathToArr(path))
+	return out, nil, err
 }
 
 // Set applies the given space-separated path (including value as path segments).
+//
+// Deprecated: the path is split on whitespace, so values containing spaces
+// are sent as several segments. Use SetPath.
 func (conf *Conf) Set(ctx context.Context, path string) (*Response, interface{}, error) {
-	pathArr := pathToArr(path)
-	out, err := conf.client.post(ctx, "/configure", map[string]interface{}{
-		"op":   "set",
-		"path": pathArr,
-	})
-	if err != nil {
-		return nil, nil, err
-	}
-	return out, nil, nil
+	out, err := conf.SetPath(ctx, pathToArr(path))
+	return out, nil, err
 }
 
 // Delete removes the node at the given space-separated path.
+//
+// Deprecated: the path is split on whitespace. Use DeletePath.
 func (conf *Conf) Delete(ctx context.Context, path string) (*Response, interface{}, error) {
-	pathArr := pathToArr(path)
-	out, err := conf.client.post(ctx, "/configure", map[string]interface{}{
+	out, err := conf.DeletePath(ctx, pathToArr(path))
+	return out, nil, err
+}
+
+// GetPath retrieves configuration at the given path. Each element is sent as
+// a single segment, so values may contain spaces, quotes or any unicode.
+func (conf *Conf) GetPath(ctx context.Context, path []string) (*Response, error) {
+	return conf.client.post(ctx, "/retrieve", map[string]interface{}{
+		"op":   "showConfig",
+		"path": nonNil(path),
+	})
+}
+
+// SetPath applies the given path. The value, if any, is the final element and
+// is sent verbatim as one segment.
+func (conf *Conf) SetPath(ctx context.Context, path []string) (*Response, error) {
+	return conf.client.post(ctx, "/configure", map[string]interface{}{
+		"op":   "set",
+		"path": nonNil(path),
+	})
+}
+
+// DeletePath removes the node at the given path.
+func (conf *Conf) DeletePath(ctx context.Context, path []string) (*Response, error) {
+	return conf.client.post(ctx, "/configure", map[string]interface{}{
 		"op":   "delete",
-		"path": pathArr,
+		"path": nonNil(path),
 	})
-	if err != nil {
-		return nil, nil, err
+}
+
+// Confirm accepts a pending commit-confirm (see Batch.CommitConfirm), so the
+// device keeps the new configuration instead of reverting it.
+func (conf *Conf) Confirm(ctx context.Context) (*Response, error) {
+	return conf.client.post(ctx, "/configure", map[string]interface{}{
+		"op": "confirm",
+	})
+}
+
+// nonNil returns path, or an empty slice if path is nil, so that the JSON
+// payload always carries an array rather than null.
+func nonNil(path []string) []string {
+	if path == nil {
+		return []string{}
+	}
+	return path
+}
+
+// Save writes the running configuration to file on the device. An empty file
+// saves to the boot configuration (/config/config.boot), so the running config
+// survives a reboot.
+func (cf *ConfigFile) Save(ctx context.Context, file string) (*Response, error) {
+	payload := map[string]interface{}{"op": "save"}
+	if file != "" {
+		payload["file"] = file
 	}
-	return out, nil, nil
+	return cf.client.post(ctx, "/config-file", payload)
+}
+
+// Load replaces the running configuration with the contents of file on the
+// device and commits it.
+func (cf *ConfigFile) Load(ctx context.Context, file string) (*Response, error) {
+	return cf.client.post(ctx, "/config-file", map[string]interface{}{
+		"op":   "load",
+		"file": file,
+	})
 }
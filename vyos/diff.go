@@ -0,0 +1,100 @@
+package vyos
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// Diff returns the operations that turn from, the configuration at path, into
+// to, deletes first. Either may be nil for a node that does not exist. A node
+// missing from to is deleted whole rather than value by value, and a node
+// missing from from is set from its leaves. A changed value is deleted before
+// the new one is set, which replaces single values and multi-value nodes
+// alike.
+func Diff(path []string, from, to interface{}) []Op {
+	var deletes, sets []Op
+	diffTree(path, from, to, &deletes, &sets)
+	return append(deletes, sets...)
+}
+
+func diffTree(path []string, from, to interface{}, deletes, sets *[]Op) {
+	fm, fromNode := from.(map[string]interface{})
+	tm, toNode := to.(map[string]interface{})
+	switch {
+	case from == nil && to == nil:
+	case from == nil:
+		setTree(path, to, sets)
+	case to == nil:
+		*deletes = append(*deletes, Op{Op: "delete", Path: nonNil(path)})
+	case fromNode && toNode:
+		for _, k := range sortedKeys(fm, tm) {
+			diffTree(subPath(path, k), fm[k], tm[k], deletes, sets)
+		}
+	case fromNode || toNode:
+		*deletes = append(*deletes, Op{Op: "delete", Path: nonNil(path)})
+		setTree(path, to, sets)
+	default:
+		fv, tv := leafValues(from), leafValues(to)
+		for _, v := range fv {
+			if !slices.Contains(tv, v) {
+				*deletes = append(*deletes, Op{Op: "delete", Path: subPath(path, v)})
+			}
+		}
+		for _, v := range tv {
+			if !slices.Contains(fv, v) {
+				*sets = append(*sets, Op{Op: "set", Path: subPath(path, v)})
+			}
+		}
+	}
+}
+
+// setTree queues the set operations that create v at path.
+func setTree(path []string, v interface{}, sets *[]Op) {
+	if m, ok := v.(map[string]interface{}); ok {
+		if len(m) == 0 {
+			*sets = append(*sets, Op{Op: "set", Path: nonNil(path)})
+			return
+		}
+		for _, k := range sortedKeys(m, nil) {
+			setTree(subPath(path, k), m[k], sets)
+		}
+		return
+	}
+	for _, val := range leafValues(v) {
+		*sets = append(*sets, Op{Op: "set", Path: subPath(path, val)})
+	}
+}
+
+// leafValues returns the values of a leaf node: one for a single value, or
+// each element of a multi-value node.
+func leafValues(v interface{}) []string {
+	if list, ok := v.([]interface{}); ok {
+		out := make([]string, 0, len(list))
+		for _, e := range list {
+			out = append(out, fmt.Sprint(e))
+		}
+		return out
+	}
+	return []string{fmt.Sprint(v)}
+}
+
+func sortedKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func subPath(base []string, segs ...string) []string {
+	out := make([]string, 0, len(base)+len(segs))
+	out = append(out, base...)
+	return append(out, segs...)
+}
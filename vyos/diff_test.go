@@ -0,0 +1,51 @@
+package vyos
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	type tree = map[string]interface{}
+	from := tree{
+		"vrf": tree{"name": tree{
+			"BLUE": tree{"table": "100", "description": "old"},
+			"RED":  tree{"table": "200"},
+		}},
+		"interfaces": tree{"ethernet": tree{"eth1": tree{
+			"address": []interface{}{"10.0.0.1/24", "10.0.1.1/24"},
+			"disable": tree{},
+		}}},
+	}
+	to := tree{
+		"vrf": tree{"name": tree{
+			"BLUE":  tree{"table": "100", "description": "new"},
+			"GREEN": tree{"table": "300"},
+		}},
+		"interfaces": tree{"ethernet": tree{"eth1": tree{
+			"address": []interface{}{"10.0.1.1/24", "10.0.2.1/24"},
+		}}},
+	}
+
+	want := []Op{
+		deleteOp("interfaces", "ethernet", "eth1", "address", "10.0.0.1/24"),
+		deleteOp("interfaces", "ethernet", "eth1", "disable"),
+		deleteOp("vrf", "name", "BLUE", "description", "old"),
+		deleteOp("vrf", "name", "RED"),
+		setOp("interfaces", "ethernet", "eth1", "address", "10.0.2.1/24"),
+		setOp("vrf", "name", "BLUE", "description", "new"),
+		setOp("vrf", "name", "GREEN", "table", "300"),
+	}
+	got := Diff(nil, from, to)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff =\n%v\nwant\n%v", got, want)
+	}
+
+	// Applying the diff to from yields to.
+	if after := Predict(nil, from, got); !reflect.DeepEqual(after, to) {
+		t.Errorf("Predict(Diff) = %v, want %v", after, to)
+	}
+	if ops := Diff(nil, to, to); len(ops) != 0 {
+		t.Errorf("Diff of equal trees = %v, want none", ops)
+	}
+}
@@ -0,0 +1,128 @@
+package vyos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Sentinel error kinds. A device-side failure is returned as an *Error whose
+// Kind is one of these, so callers test it with errors.Is:
+//
+//	if errors.Is(err, vyos.ErrPathNotFound) { ... }
+var (
+	// ErrPathNotFound means a read addressed a config path that has no
+	// configuration under it.
+	ErrPathNotFound = errors.New("path not found")
+	// ErrAuth means the device refused the API key.
+	ErrAuth = errors.New("authentication failed")
+	// ErrCommitFailed means /configure rejected the change. VyOS discards
+	// the whole session, so nothing was applied.
+	ErrCommitFailed = errors.New("commit failed")
+	// ErrConfigLocked means another configuration session holds the lock.
+	ErrConfigLocked = errors.New("configuration locked")
+	// ErrRejected is any other request the device answered with
+	// success=false.
+	ErrRejected = errors.New("request rejected")
+)
+
+// Error is a request the device received and refused. Message is the device's
+// own error text.
+type Error struct {
+	Kind    error
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return "vyos: " + e.Kind.Error()
+	}
+	return "vyos: " + e.Kind.Error() + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Kind }
+
+// TransportError is a failure to reach the device or to read its response:
+// connection refused, timeout, TLS failure, or a body that is not a VyOS
+// response envelope.
+type TransportError struct {
+	Endpoint string
+	// Status is the HTTP status of a response that was not a VyOS answer,
+	// e.g. from a proxy in front of the API; zero if there was none.
+	Status int
+	Err    error
+}
+
+func (e *TransportError) Error() string {
+	return "vyos " + e.Endpoint + ": " + e.Err.Error()
+}
+
+func (e *TransportError) Unwrap() error { return e.Err }
+
+// Message returns the device's error text for err, or err's own text if it
+// did not come from the device.
+func Message(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Message
+	}
+	return err.Error()
+}
+
+// ErrorClass names the kind of err for logs and metrics: "" for nil,
+// "transport", "auth", "path_not_found", "commit_failed", "config_locked",
+// "rejected", "circuit_open", or "other" for errors that did not come from a
+// request.
+func ErrorClass(err error) string {
+	var te *TransportError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	case errors.As(err, &te):
+		return "transport"
+	case errors.Is(err, ErrAuth):
+		return "auth"
+	case errors.Is(err, ErrPathNotFound):
+		return "path_not_found"
+	case errors.Is(err, ErrCommitFailed):
+		return "commit_failed"
+	case errors.Is(err, ErrConfigLocked):
+		return "config_locked"
+	case errors.Is(err, ErrRejected):
+		return "rejected"
+	}
+	return "other"
+}
+
+// classify builds the *Error for a refused request to endpoint.
+func classify(endpoint string, status int, msg interface{}) *Error {
+	text := ""
+	if msg != nil {
+		text = fmt.Sprint(msg)
+	}
+	e := &Error{Kind: ErrRejected, Status: status, Message: text}
+	lower := strings.ToLower(text)
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		e.Kind = ErrAuth
+	case strings.Contains(lower, "locked") || strings.Contains(lower, "lock is held"):
+		e.Kind = ErrConfigLocked
+	case endpoint == "/configure":
+		e.Kind = ErrCommitFailed
+	case endpoint == "/retrieve" && isNotFound(lower):
+		e.Kind = ErrPathNotFound
+	}
+	return e
+}
+
+// isNotFound matches the ways VyOS reports a read of an absent path, e.g.
+// "Configuration under specified path is empty" or "... does not exist".
+func isNotFound(lower string) bool {
+	return strings.Contains(lower, "empty") ||
+		strings.Contains(lower, "does not exist") ||
+		strings.Contains(lower, "not found")
+}
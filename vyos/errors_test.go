@@ -0,0 +1,121 @@
+package vyos
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a Client whose device answers every request with
+// status and body.
+func newTestClient(t *testing.T, status int, body string) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body)) //nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return NewClient(nil).WithURL(srv.URL)
+}
+
+func TestErrors_Classification(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		call   func(c *Client) error
+		want   error
+	}{
+		{"retrieve empty path", 400, `{"success":false,"error":"Configuration under specified path is empty","data":null}`,
+			func(c *Client) error { _, err := c.Conf.GetPath(ctx, []string{"nat"}); return err }, ErrPathNotFound},
+		{"retrieve other", 400, `{"success":false,"error":"Internal error","data":null}`,
+			func(c *Client) error { _, err := c.Conf.GetPath(ctx, []string{"nat"}); return err }, ErrRejected},
+		{"configure rejected", 400, `{"success":false,"error":"Nothing to delete","data":null}`,
+			func(c *Client) error { _, err := c.Conf.DeletePath(ctx, []string{"vrf"}); return err }, ErrCommitFailed},
+		{"configure locked", 400, `{"success":false,"error":"Configuration is locked by another session","data":null}`,
+			func(c *Client) error { _, err := c.Conf.SetPath(ctx, []string{"vrf"}); return err }, ErrConfigLocked},
+		{"bad key", 401, `{"success":false,"error":"Valid API key is required","data":null}`,
+			func(c *Client) error { _, err := c.Conf.GetPath(ctx, nil); return err }, ErrAuth},
+		{"bad key, non-JSON body", 403, `Forbidden`,
+			func(c *Client) error { _, err := c.Conf.GetPath(ctx, nil); return err }, ErrAuth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(newTestClient(t, tt.status, tt.body))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			var e *Error
+			if !errors.As(err, &e) || e.Status != tt.status {
+				t.Errorf("err = %#v, want *Error with status %d", err, tt.status)
+			}
+		})
+	}
+}
+
+func TestErrors_RejectionKeepsEnvelope(t *testing.T) {
+	c := newTestClient(t, 400, `{"success":false,"error":"Configuration under specified path is empty","data":null}`)
+	out, err := c.Conf.GetPath(context.Background(), []string{"nat"})
+	if out == nil || out.Success {
+		t.Fatalf("out = %+v, want the failed envelope", out)
+	}
+	if got := Message(err); got != "Configuration under specified path is empty" {
+		t.Errorf("Message = %q", got)
+	}
+}
+
+func TestErrors_Transport(t *testing.T) {
+	c := newTestClient(t, 502, `<html>bad gateway</html>`)
+	_, err := c.Conf.GetPath(context.Background(), nil)
+	var te *TransportError
+	if !errors.As(err, &te) {
+		t.Fatalf("err = %#v, want *TransportError", err)
+	}
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	_, err = NewClient(nil).WithURL(srv.URL).Conf.GetPath(context.Background(), nil)
+	if !errors.As(err, &te) {
+		t.Fatalf("err = %#v, want *TransportError for a closed server", err)
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{&TransportError{Endpoint: "/retrieve", Err: errors.New("refused")}, "transport"},
+		{&Error{Kind: ErrAuth}, "auth"},
+		{&Error{Kind: ErrPathNotFound}, "path_not_found"},
+		{&Error{Kind: ErrCommitFailed}, "commit_failed"},
+		{&Error{Kind: ErrConfigLocked}, "config_locked"},
+		{&Error{Kind: ErrRejected}, "rejected"},
+		{errors.New("marshal"), "other"},
+	}
+	for _, tt := range tests {
+		if got := ErrorClass(tt.err); got != tt.want {
+			t.Errorf("ErrorClass(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestObserver(t *testing.T) {
+	var endpoints []string
+	var errs []error
+	c := newTestClient(t, 400, `{"success":false,"error":"Nothing to delete","data":null}`).
+		WithObserver(func(endpoint string, _ time.Duration, err error) {
+			endpoints = append(endpoints, endpoint)
+			errs = append(errs, err)
+		})
+
+	c.Conf.DeletePath(context.Background(), []string{"vrf"}) //nolint:errcheck
+	if len(endpoints) != 1 || endpoints[0] != "/configure" || !errors.Is(errs[0], ErrCommitFailed) {
+		t.Errorf("observed %v %v, want one /configure commit failure", endpoints, errs)
+	}
+}
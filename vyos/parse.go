@@ -0,0 +1,299 @@
+package vyos
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Parsers for the text output of common operational-mode commands. They are
+// lenient: lines they do not recognise are skipped rather than reported, since
+// the exact layout varies slightly between VyOS releases.
+
+// InterfaceState is one row of "show interfaces".
+type InterfaceState struct {
+	Name        string   `json:"name"`
+	Addresses   []string `json:"addresses"`
+	AdminUp     bool     `json:"admin_up"`
+	LinkUp      bool     `json:"link_up"`
+	Description string   `json:"description,omitempty"`
+}
+
+// ParseInterfaces parses the output of "show interfaces":
+//
+//	Interface    IP Address                        S/L  Description
+//	---------    ----------                        ---  -----------
+//	eth0         192.168.1.1/24                    u/u  WAN
+//	             2001:db8::1/64
+//	eth1         -                                 A/D
+//
+// Extra addresses of an interface are printed on continuation lines.
+func ParseInterfaces(text string) []InterfaceState {
+	out := []InterfaceState{}
+	for _, line := range tableRows(text) {
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		// Continuation line: an indented extra address.
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(out) > 0 && f[0] != "-" {
+				last := &out[len(out)-1]
+				last.Addresses = append(last.Addresses, f[0])
+			}
+			continue
+		}
+		if len(f) < 3 {
+			continue
+		}
+		iface := InterfaceState{Name: f[0], Addresses: []string{}}
+		if f[1] != "-" {
+			iface.Addresses = append(iface.Addresses, f[1])
+		}
+		if admin, link, ok := strings.Cut(f[2], "/"); ok {
+			iface.AdminUp = admin == "u"
+			iface.LinkUp = link == "u"
+		}
+		iface.Description = strings.Join(f[3:], " ")
+		out = append(out, iface)
+	}
+	return out
+}
+
+// RouteState is one prefix of "show ip route".
+type RouteState struct {
+	// Protocol is the route code: K kernel, C connected, S static, O OSPF,
+	// B BGP, and so on.
+	Protocol string `json:"protocol"`
+	Prefix   string `json:"prefix"`
+	Selected bool   `json:"selected"`
+	// Installed reports whether the route is in the FIB.
+	Installed bool      `json:"installed"`
+	Distance  string    `json:"distance,omitempty"`
+	Metric    string    `json:"metric,omitempty"`
+	NextHops  []NextHop `json:"next_hops"`
+	Age       string    `json:"age,omitempty"`
+}
+
+// NextHop is a gateway and/or outgoing interface of a route. Via is empty for
+// directly connected routes.
+type NextHop struct {
+	Via       string `json:"via,omitempty"`
+	Interface string `json:"interface,omitempty"`
+}
+
+var (
+	// S>* 0.0.0.0/0 [1/0] via 192.168.1.254, eth0, weight 1, 00:10:11
+	// C>* 192.168.1.0/24 is directly connected, eth0, 00:10:12
+	routeLine = regexp.MustCompile(`^([A-Za-z])([>*=qrbto ]*?)\s*(\S+/\d+)(?:\s+\[(\d+)/(\d+)\])?\s+(.*)$`)
+	// Additional ECMP next hop: "  *                        via 10.0.0.2, eth1, weight 1, 00:10:11"
+	nextHopLine = regexp.MustCompile(`^\s+([>*=qrbto ]*?)\s*(via .*|is directly connected.*)$`)
+	// Route age: "00:10:11", "1d02h03m", "02w3d04h". Interface names never
+	// start with a digit.
+	routeAge = regexp.MustCompile(`^[0-9][0-9:wdhms]*$`)
+)
+
+// ParseRoutes parses the output of "show ip route" (or "show ipv6 route").
+// The legend at the top of the output is skipped.
+func ParseRoutes(text string) []RouteState {
+	out := []RouteState{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if m := routeLine.FindStringSubmatch(line); m != nil {
+			r := RouteState{
+				Protocol:  m[1],
+				Prefix:    m[3],
+				Selected:  strings.Contains(m[2], ">"),
+				Installed: strings.Contains(m[2], "*"),
+				Distance:  m[4],
+				Metric:    m[5],
+			}
+			hop, age := parseNextHop(m[6])
+			r.NextHops = []NextHop{hop}
+			r.Age = age
+			out = append(out, r)
+			continue
+		}
+		if m := nextHopLine.FindStringSubmatch(line); m != nil && len(out) > 0 {
+			hop, _ := parseNextHop(m[2])
+			last := &out[len(out)-1]
+			last.NextHops = append(last.NextHops, hop)
+		}
+	}
+	return out
+}
+
+// parseNextHop splits the tail of a route line, e.g. "via 10.0.0.1, eth0,
+// weight 1, 00:10:11" or "is directly connected, eth0, 00:10:12".
+func parseNextHop(s string) (NextHop, string) {
+	parts := strings.Split(s, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	var hop NextHop
+	if v, ok := strings.CutPrefix(parts[0], "via "); ok {
+		hop.Via = v
+	}
+	var age string
+	for _, p := range parts[1:] {
+		switch {
+		case strings.HasPrefix(p, "weight "), strings.HasPrefix(p, "label "):
+		case routeAge.MatchString(p):
+			age = p
+		case hop.Interface == "":
+			hop.Interface = p
+		}
+	}
+	return hop, age
+}
+
+// DHCPLease is one row of "show dhcp server leases".
+type DHCPLease struct {
+	IP         string `json:"ip"`
+	MAC        string `json:"mac"`
+	State      string `json:"state,omitempty"`
+	Start      string `json:"start,omitempty"`
+	Expiration string `json:"expiration,omitempty"`
+	Remaining  string `json:"remaining,omitempty"`
+	Pool       string `json:"pool,omitempty"`
+	Hostname   string `json:"hostname,omitempty"`
+}
+
+// ParseDHCPLeases parses the output of "show dhcp server leases". Columns are
+// located by the dashed rule under the header, so optional columns (such as
+// Origin on newer releases) and empty cells are handled.
+func ParseDHCPLeases(text string) []DHCPLease {
+	out := []DHCPLease{}
+	for _, row := range parseTable(text) {
+		l := DHCPLease{
+			IP:         row["ip address"],
+			MAC:        row["mac address"],
+			State:      row["state"],
+			Start:      row["lease start"],
+			Expiration: row["lease expiration"],
+			Remaining:  row["remaining"],
+			Pool:       row["pool"],
+			Hostname:   row["hostname"],
+		}
+		if l.IP == "" {
+			continue
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+// VersionInfo is the parsed output of "show version".
+type VersionInfo struct {
+	Version        string `json:"version"`
+	ReleaseTrain   string `json:"release_train,omitempty"`
+	BuiltOn        string `json:"built_on,omitempty"`
+	Architecture   string `json:"architecture,omitempty"`
+	SystemType     string `json:"system_type,omitempty"`
+	HardwareVendor string `json:"hardware_vendor,omitempty"`
+	HardwareModel  string `json:"hardware_model,omitempty"`
+	// Fields holds every "Key: value" line, keyed as printed.
+	Fields map[string]string `json:"fields"`
+}
+
+// ParseVersion parses the "Key:   value" lines of "show version".
+func ParseVersion(text string) VersionInfo {
+	v := VersionInfo{Fields: map[string]string{}}
+	for _, line := range strings.Split(text, "\n") {
+		k, val, ok := strings.Cut(line, ":")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" || strings.HasPrefix(line, " ") {
+			continue
+		}
+		v.Fields[k] = strings.TrimSpace(val)
+	}
+	v.Version = v.Fields["Version"]
+	v.ReleaseTrain = v.Fields["Release train"]
+	v.BuiltOn = v.Fields["Built on"]
+	v.Architecture = v.Fields["Architecture"]
+	v.SystemType = v.Fields["System type"]
+	v.HardwareVendor = v.Fields["Hardware vendor"]
+	v.HardwareModel = v.Fields["Hardware model"]
+	return v
+}
+
+// tableRows returns the lines after the dashed rule of a tabular output, or
+// nil if there is no rule.
+func tableRows(text string) []string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r", ""), "\n")
+	for i, line := range lines {
+		if isRule(line) {
+			return lines[i+1:]
+		}
+	}
+	return nil
+}
+
+// parseTable splits a fixed-width table into rows keyed by lower-cased column
+// header. Column boundaries are taken from the dashed rule under the header;
+// the last column extends to the end of the line.
+func parseTable(text string) []map[string]string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r", ""), "\n")
+	ruleAt := -1
+	for i, line := range lines {
+		if i > 0 && isRule(line) {
+			ruleAt = i
+			break
+		}
+	}
+	if ruleAt < 0 {
+		return nil
+	}
+
+	type col struct{ start, end int }
+	var cols []col
+	rule := lines[ruleAt]
+	for i := 0; i < len(rule); {
+		if rule[i] != '-' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(rule) && rule[j] == '-' {
+			j++
+		}
+		cols = append(cols, col{i, j})
+		i = j
+	}
+	cols[len(cols)-1].end = -1
+
+	cell := func(line string, c col) string {
+		if c.start >= len(line) {
+			return ""
+		}
+		end := c.end
+		if end < 0 || end > len(line) {
+			end = len(line)
+		}
+		return strings.TrimSpace(line[c.start:end])
+	}
+
+	header := lines[ruleAt-1]
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = strings.ToLower(cell(header, c))
+	}
+
+	var rows []map[string]string
+	for _, line := range lines[ruleAt+1:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		row := make(map[string]string, len(cols))
+		for i, c := range cols {
+			row[names[i]] = cell(line, c)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// isRule reports whether line is a header underline made of dash runs.
+func isRule(line string) bool {
+	t := strings.TrimSpace(line)
+	return t != "" && strings.Trim(t, "- ") == "" && strings.HasPrefix(t, "--")
+}
@@ -0,0 +1,102 @@
+package vyos
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseInterfaces(t *testing.T) {
+	text := `Codes: S - State, L - Link, u - Up, D - Down, A - Admin Down
+Interface    IP Address                        S/L  Description
+---------    ----------                        ---  -----------
+eth0         192.168.1.1/24                    u/u  WAN uplink
+             2001:db8::1/64
+eth1         -                                 A/D
+lo           127.0.0.1/8                       u/u
+             ::1/128
+`
+	got := ParseInterfaces(text)
+	want := []InterfaceState{
+		{Name: "eth0", Addresses: []string{"192.168.1.1/24", "2001:db8::1/64"}, AdminUp: true, LinkUp: true, Description: "WAN uplink"},
+		{Name: "eth1", Addresses: []string{}},
+		{Name: "lo", Addresses: []string{"127.0.0.1/8", "::1/128"}, AdminUp: true, LinkUp: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	text := `Codes: K - kernel route, C - connected, S - static, R - RIP,
+       O - OSPF, I - IS-IS, B - BGP, E - EIGRP, N - NHRP,
+       > - selected route, * - FIB route, q - queued, r - rejected, b - backup
+
+S>* 0.0.0.0/0 [1/0] via 192.168.1.254, eth0, weight 1, 00:10:11
+S>* 10.0.0.0/8 [1/0] via 10.1.0.1, eth1, weight 1, 1d02h03m
+  *                  via 10.2.0.1, eth2, weight 1, 1d02h03m
+C>* 192.168.1.0/24 is directly connected, eth0, 00:10:12
+`
+	got := ParseRoutes(text)
+	want := []RouteState{
+		{Protocol: "S", Prefix: "0.0.0.0/0", Selected: true, Installed: true, Distance: "1", Metric: "0",
+			NextHops: []NextHop{{Via: "192.168.1.254", Interface: "eth0"}}, Age: "00:10:11"},
+		{Protocol: "S", Prefix: "10.0.0.0/8", Selected: true, Installed: true, Distance: "1", Metric: "0",
+			NextHops: []NextHop{{Via: "10.1.0.1", Interface: "eth1"}, {Via: "10.2.0.1", Interface: "eth2"}}, Age: "1d02h03m"},
+		{Protocol: "C", Prefix: "192.168.1.0/24", Selected: true, Installed: true,
+			NextHops: []NextHop{{Interface: "eth0"}}, Age: "00:10:12"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseDHCPLeases(t *testing.T) {
+	text := `IP Address      MAC address        State    Lease start          Lease expiration     Remaining    Pool    Hostname
+--------------  -----------------  -------  -------------------  -------------------  -----------  ------  ----------
+192.168.1.100   00:50:56:aa:bb:cc  active   2024/01/01 10:00:00  2024/01/02 10:00:00  23:59:10     LAN     laptop-01
+192.168.1.101   00:50:56:aa:bb:dd  active   2024/01/01 11:00:00  2024/01/02 11:00:00  1:00:00      LAN
+`
+	got := ParseDHCPLeases(text)
+	if len(got) != 2 {
+		t.Fatalf("got %d leases, want 2", len(got))
+	}
+	want := DHCPLease{
+		IP: "192.168.1.100", MAC: "00:50:56:aa:bb:cc", State: "active",
+		Start: "2024/01/01 10:00:00", Expiration: "2024/01/02 10:00:00",
+		Remaining: "23:59:10", Pool: "LAN", Hostname: "laptop-01",
+	}
+	if got[0] != want {
+		t.Errorf("got  %+v\nwant %+v", got[0], want)
+	}
+	if got[1].Hostname != "" || got[1].Pool != "LAN" {
+		t.Errorf("second lease = %+v, want pool LAN and no hostname", got[1])
+	}
+}
+
+func TestParseDHCPLeases_NoLeases(t *testing.T) {
+	if got := ParseDHCPLeases("No DHCP leases found\n"); len(got) != 0 {
+		t.Errorf("got %+v, want none", got)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	text := `Version:          VyOS 1.4.0
+Release train:    sagitta
+
+Built by:         autobuild@vyos.net
+Built on:         Mon 15 Jan 2024 10:00 UTC
+Architecture:     x86_64
+System type:      KVM guest
+Hardware vendor:  QEMU
+`
+	got := ParseVersion(text)
+	if got.Version != "VyOS 1.4.0" || got.ReleaseTrain != "sagitta" || got.Architecture != "x86_64" {
+		t.Errorf("got %+v", got)
+	}
+	if got.BuiltOn != "Mon 15 Jan 2024 10:00 UTC" {
+		t.Errorf("built_on = %q, want the full value including colons", got.BuiltOn)
+	}
+	if got.Fields["Built by"] != "autobuild@vyos.net" {
+		t.Errorf("fields = %+v", got.Fields)
+	}
+}
@@ -0,0 +1,207 @@
+package vyos
+
+// Predict returns the configuration at path after applying ops to before, the
+// configuration Conf.GetPath returned for path (nil if it did not exist). It
+// returns nil if ops remove the node. before is not modified.
+//
+// The prediction follows how VyOS shows configuration without knowing its
+// schema: a set of a node that has no value yet makes it a leaf, a second
+// value replaces the first except on multi-value nodes such as interface
+// addresses, and a delete that leaves a node empty removes it. It can differ
+// from the device for paths that are neither created nor read this way, and
+// it does not check that the ops are valid.
+func Predict(path []string, before interface{}, ops []Op) interface{} {
+	root := map[string]interface{}{}
+	if before != nil {
+		if len(path) == 0 {
+			m, ok := cloneTree(before).(map[string]interface{})
+			if !ok {
+				return before
+			}
+			root = m
+		} else {
+			walk(root, path[:len(path)-1])[path[len(path)-1]] = cloneTree(before)
+		}
+	}
+
+	for _, op := range ops {
+		switch op.Op {
+		case "set":
+			setNode(root, op.Path)
+		case "delete":
+			removeNode(root, op.Path)
+		}
+	}
+
+	var v interface{} = root
+	for _, seg := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if v, ok = m[seg]; !ok {
+			return nil
+		}
+	}
+	if m, ok := v.(map[string]interface{}); ok && len(m) == 0 && len(path) == 0 {
+		return nil
+	}
+	return v
+}
+
+// multiValue reports whether the leaf node at path, the path of a set
+// without its value, keeps every value set on it instead of the last.
+func multiValue(path []string) bool {
+	n := len(path)
+	switch {
+	case n > 0 && path[n-1] == "name-server":
+		return true
+	case n > 0 && path[n-1] == "address":
+		// Firewall and NAT match and translate a single address.
+		if n < 2 {
+			return true
+		}
+		switch path[n-2] {
+		case "source", "destination", "translation":
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// walk returns the node at path under m, creating missing nodes. A leaf on
+// the way becomes a node holding its values, as when a tag node such as
+// "vif 10" is given children.
+func walk(m map[string]interface{}, path []string) map[string]interface{} {
+	for _, seg := range path {
+		switch c := m[seg].(type) {
+		case map[string]interface{}:
+			m = c
+		case string:
+			n := map[string]interface{}{c: map[string]interface{}{}}
+			m[seg] = n
+			m = n
+		case []interface{}:
+			n := make(map[string]interface{}, len(c))
+			for _, v := range c {
+				if s, ok := v.(string); ok {
+					n[s] = map[string]interface{}{}
+				}
+			}
+			m[seg] = n
+			m = n
+		default:
+			n := map[string]interface{}{}
+			m[seg] = n
+			m = n
+		}
+	}
+	return m
+}
+
+func setNode(root map[string]interface{}, path []string) {
+	n := len(path)
+	if n == 0 {
+		return
+	}
+	if n == 1 {
+		if _, ok := root[path[0]]; !ok {
+			root[path[0]] = map[string]interface{}{}
+		}
+		return
+	}
+	parent := walk(root, path[:n-2])
+	node, value := path[n-2], path[n-1]
+	switch c := parent[node].(type) {
+	case map[string]interface{}:
+		if _, ok := c[value]; !ok {
+			c[value] = map[string]interface{}{}
+		}
+	case string:
+		if c == value {
+			return
+		}
+		if multiValue(path[:n-1]) {
+			parent[node] = []interface{}{c, value}
+		} else {
+			parent[node] = value
+		}
+	case []interface{}:
+		for _, v := range c {
+			if v == value {
+				return
+			}
+		}
+		parent[node] = append(c, value)
+	default:
+		parent[node] = value
+	}
+}
+
+// removeNode deletes the node or value at path from m, then any node the
+// deletion left empty. It reports whether anything was deleted.
+func removeNode(m map[string]interface{}, path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	seg := path[0]
+	if len(path) == 1 {
+		_, ok := m[seg]
+		delete(m, seg)
+		return ok
+	}
+	switch c := m[seg].(type) {
+	case map[string]interface{}:
+		ok := removeNode(c, path[1:])
+		if ok && len(c) == 0 {
+			delete(m, seg)
+		}
+		return ok
+	case string:
+		if len(path) == 2 && c == path[1] {
+			delete(m, seg)
+			return true
+		}
+	case []interface{}:
+		if len(path) != 2 {
+			return false
+		}
+		var rest []interface{}
+		for _, v := range c {
+			if v != path[1] {
+				rest = append(rest, v)
+			}
+		}
+		switch len(rest) {
+		case len(c):
+			return false
+		case 0:
+			delete(m, seg)
+		case 1:
+			m[seg] = rest[0]
+		default:
+			m[seg] = rest
+		}
+		return true
+	}
+	return false
+}
+
+func cloneTree(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, child := range t {
+			out[k] = cloneTree(child)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, child := range t {
+			out[i] = cloneTree(child)
+		}
+		return out
+	}
+	return v
+}
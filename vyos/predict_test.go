@@ -0,0 +1,90 @@
+package vyos
+
+import (
+	"reflect"
+	"testing"
+)
+
+func setOp(path ...string) Op    { return Op{Op: "set", Path: path} }
+func deleteOp(path ...string) Op { return Op{Op: "delete", Path: path} }
+
+func TestPredict(t *testing.T) {
+	type tree = map[string]interface{}
+	tests := []struct {
+		name   string
+		path   []string
+		before interface{}
+		ops    []Op
+		want   interface{}
+	}{
+		{
+			name: "new leaf",
+			path: []string{"vrf", "name"},
+			ops:  []Op{setOp("vrf", "name", "BLUE", "table", "100")},
+			want: tree{"BLUE": tree{"table": "100"}},
+		},
+		{
+			name:   "replace value",
+			path:   []string{"vrf", "name", "BLUE"},
+			before: tree{"table": "100", "description": "old"},
+			ops:    []Op{setOp("vrf", "name", "BLUE", "description", "new")},
+			want:   tree{"table": "100", "description": "new"},
+		},
+		{
+			name:   "multi-value node",
+			path:   []string{"interfaces", "ethernet", "eth1"},
+			before: tree{"address": "10.0.0.1/24"},
+			ops:    []Op{setOp("interfaces", "ethernet", "eth1", "address", "10.0.1.1/24")},
+			want:   tree{"address": []interface{}{"10.0.0.1/24", "10.0.1.1/24"}},
+		},
+		{
+			name:   "tag node gains children",
+			path:   []string{"interfaces", "ethernet", "eth1"},
+			before: tree{"description": "LAN"},
+			ops: []Op{
+				setOp("interfaces", "ethernet", "eth1", "vif", "10"),
+				setOp("interfaces", "ethernet", "eth1", "vif", "10", "address", "10.10.0.1/24"),
+			},
+			want: tree{"description": "LAN", "vif": tree{"10": tree{"address": "10.10.0.1/24"}}},
+		},
+		{
+			name:   "valueless node",
+			path:   []string{"firewall", "name"},
+			before: tree{"WAN_IN": tree{"default-action": "drop"}},
+			ops:    []Op{setOp("firewall", "name", "WAN_IN", "disable")},
+			want:   tree{"WAN_IN": tree{"default-action": "drop", "disable": tree{}}},
+		},
+		{
+			name:   "delete one value",
+			path:   []string{"firewall", "group", "address-group", "SERVERS"},
+			before: tree{"address": []interface{}{"10.0.0.1", "10.0.0.2"}},
+			ops:    []Op{deleteOp("firewall", "group", "address-group", "SERVERS", "address", "10.0.0.1")},
+			want:   tree{"address": "10.0.0.2"},
+		},
+		{
+			name:   "delete last node",
+			path:   []string{"vrf", "name"},
+			before: tree{"BLUE": tree{"table": "100"}},
+			ops:    []Op{deleteOp("vrf", "name", "BLUE")},
+			want:   nil,
+		},
+		{
+			name:   "delete missing node",
+			path:   []string{"vrf", "name"},
+			before: tree{"BLUE": tree{"table": "100", "disable": tree{}}},
+			ops:    []Op{deleteOp("vrf", "name", "BLUE", "disable", "x"), deleteOp("vrf", "name", "RED")},
+			want:   tree{"BLUE": tree{"table": "100", "disable": tree{}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := cloneTree(tt.before)
+			if got := Predict(tt.path, tt.before, tt.ops); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Predict = %#v, want %#v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.before, orig) {
+				t.Errorf("Predict modified before: %#v", tt.before)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package vyos
+
+import "strings"
+
+// Redacted replaces secret values in paths returned by RedactPath.
+const Redacted = "<redacted>"
+
+// secretNodes are the config nodes whose value is a secret, e.g.
+// "plaintext-password" in "system login user alice authentication
+// plaintext-password <value>", "key" in "service https api keys id
+// admin key <value>" or "md5-key" in "protocols ospf interface eth0
+// authentication md5 key-id 1 md5-key <value>".
+var secretNodes = map[string]bool{
+	"key":                true,
+	"md5-key":            true,
+	"auth-key":           true,
+	"authentication-key": true,
+	"preshared-key":      true,
+	"password":           true,
+	"plaintext-password": true,
+	"encrypted-password": true,
+	"secret":             true,
+	"pre-shared-secret":  true,
+	"private-key":        true,
+	"shared-secret-key":  true,
+	"passphrase":         true,
+	"community":          true,
+}
+
+// RedactPath returns a copy of path, safe to log, with everything that
+// follows the first secret node replaced by Redacted, since the secret may
+// sit below a type node (e.g. "protocols isis area-password md5 <value>").
+// Node names containing "password" or "secret" are treated as secret as
+// well.
+func RedactPath(path []string) []string {
+	if path == nil {
+		return nil
+	}
+	out := make([]string, len(path))
+	copy(out, path)
+	for i := range out {
+		if isSecretNode(out[i]) {
+			for j := i + 1; j < len(out); j++ {
+				out[j] = Redacted
+			}
+			break
+		}
+	}
+	return out
+}
+
+func isSecretNode(node string) bool {
+	return secretNodes[node] || strings.Contains(node, "password") || strings.Contains(node, "secret")
+}
+
+// RedactConfig returns a copy of v, a configuration tree as returned by
+// Conf.GetPath for path, with the value of every secret node replaced by
+// Redacted. If path is at or below a secret node, all of v is.
+func RedactConfig(path []string, v interface{}) interface{} {
+	for _, node := range path {
+		if isSecretNode(node) {
+			return Redacted
+		}
+	}
+	return redactTree(v)
+}
+
+func redactTree(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, child := range t {
+			if isSecretNode(k) {
+				// The value may itself be a map keyed by secrets, such as
+				// SNMP community names, so none of it is kept.
+				out[k] = Redacted
+			} else {
+				out[k] = redactTree(child)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, child := range t {
+			out[i] = redactTree(child)
+		}
+		return out
+	}
+	return v
+}
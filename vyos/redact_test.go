@@ -0,0 +1,103 @@
+package vyos
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/valueiron/vyos-api/logctx"
+)
+
+func TestRedactPath(t *testing.T) {
+	tests := []struct {
+		path, want []string
+	}{
+		{[]string{"system", "login", "user", "alice", "authentication", "plaintext-password", "hunter2"},
+			[]string{"system", "login", "user", "alice", "authentication", "plaintext-password", Redacted}},
+		{[]string{"service", "https", "api", "keys", "id", "admin", "key", "abc"},
+			[]string{"service", "https", "api", "keys", "id", "admin", "key", Redacted}},
+		{[]string{"protocols", "bgp", "neighbor", "10.0.0.1", "password", "p"},
+			[]string{"protocols", "bgp", "neighbor", "10.0.0.1", "password", Redacted}},
+		{[]string{"vpn", "ipsec", "authentication", "psk", "peer1", "secret", "s3"},
+			[]string{"vpn", "ipsec", "authentication", "psk", "peer1", "secret", Redacted}},
+		{[]string{"protocols", "ospf", "interface", "eth0", "authentication", "md5", "key-id", "1", "md5-key", "k1"},
+			[]string{"protocols", "ospf", "interface", "eth0", "authentication", "md5", "key-id", "1", "md5-key", Redacted}},
+		{[]string{"high-availability", "vrrp", "group", "g1", "authentication", "auth-key", "k2"},
+			[]string{"high-availability", "vrrp", "group", "g1", "authentication", "auth-key", Redacted}},
+		{[]string{"protocols", "bgp", "neighbor", "10.0.0.1", "authentication-key", "k3"},
+			[]string{"protocols", "bgp", "neighbor", "10.0.0.1", "authentication-key", Redacted}},
+		{[]string{"interfaces", "wireguard", "wg0", "peer", "p1", "preshared-key", "k4"},
+			[]string{"interfaces", "wireguard", "wg0", "peer", "p1", "preshared-key", Redacted}},
+		{[]string{"protocols", "isis", "area-password", "md5", "k5"},
+			[]string{"protocols", "isis", "area-password", Redacted, Redacted}},
+		{[]string{"interfaces", "ethernet", "eth0", "address", "10.0.0.1/24"},
+			[]string{"interfaces", "ethernet", "eth0", "address", "10.0.0.1/24"}},
+		{[]string{"system", "login", "user", "alice", "authentication", "plaintext-password"},
+			[]string{"system", "login", "user", "alice", "authentication", "plaintext-password"}},
+	}
+	for _, tt := range tests {
+		orig := append([]string(nil), tt.path...)
+		if got := RedactPath(tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("RedactPath(%v) = %v, want %v", tt.path, got, tt.want)
+		}
+		if !reflect.DeepEqual(tt.path, orig) {
+			t.Errorf("RedactPath modified its argument: %v", tt.path)
+		}
+	}
+}
+
+func TestPost_LogsRedactedOperation(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := logctx.With(context.Background(), slog.New(slog.NewJSONHandler(&buf, nil)).With("request_id", "req-1"))
+	c := newTestClient(t, 400, `{"success":false,"error":"Set failed","data":null}`).WithName("router1")
+
+	c.Conf.SetPath(ctx, []string{"system", "login", "user", "alice", "authentication", "plaintext-password", "hunter2"}) //nolint:errcheck
+	line := buf.String()
+	if strings.Contains(line, "hunter2") {
+		t.Errorf("secret logged: %s", line)
+	}
+	for _, want := range []string{`"request_id":"req-1"`, `"device":"router1"`, `"op":"set"`, `"error_class":"commit_failed"`,
+		`"path":"system login user alice authentication plaintext-password ` + Redacted + `"`} {
+		if !strings.Contains(line, want) {
+			t.Errorf("log line lacks %s: %s", want, line)
+		}
+	}
+}
+
+func TestRedactConfig(t *testing.T) {
+	tree := map[string]interface{}{
+		"address": []interface{}{"10.0.0.1/24"},
+		"authentication": map[string]interface{}{
+			"plaintext-password": "hunter2",
+			"public-keys":        map[string]interface{}{"laptop": map[string]interface{}{"type": "ssh-ed25519"}},
+		},
+		"community": map[string]interface{}{"s3cret": map[string]interface{}{"authorization": "ro"}},
+		"md5":       map[string]interface{}{"key-id": map[string]interface{}{"1": map[string]interface{}{"md5-key": "k1"}}},
+		"vrrp":      map[string]interface{}{"auth-key": "k2", "authentication-key": "k3", "preshared-key": "k4"},
+	}
+	want := map[string]interface{}{
+		"address": []interface{}{"10.0.0.1/24"},
+		"authentication": map[string]interface{}{
+			"plaintext-password": Redacted,
+			"public-keys":        map[string]interface{}{"laptop": map[string]interface{}{"type": "ssh-ed25519"}},
+		},
+		"community": Redacted,
+		"md5":       map[string]interface{}{"key-id": map[string]interface{}{"1": map[string]interface{}{"md5-key": Redacted}}},
+		"vrrp":      map[string]interface{}{"auth-key": Redacted, "authentication-key": Redacted, "preshared-key": Redacted},
+	}
+	if got := RedactConfig([]string{"system"}, tree); !reflect.DeepEqual(got, want) {
+		t.Errorf("RedactConfig = %v, want %v", got, want)
+	}
+	if tree["community"] == Redacted {
+		t.Error("RedactConfig modified its argument")
+	}
+	if got := RedactConfig([]string{"protocols", "bgp", "neighbor", "10.0.0.1", "password"}, "p"); got != Redacted {
+		t.Errorf("secret leaf = %v, want %q", got, Redacted)
+	}
+	if got := RedactConfig([]string{"protocols", "isis", "area-password", "md5"}, "k5"); got != Redacted {
+		t.Errorf("below secret node = %v, want %q", got, Redacted)
+	}
+}
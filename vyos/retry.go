@@ -0,0 +1,194 @@
+package vyos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the device while its circuit
+// breaker is open (see WithBreaker).
+var ErrCircuitOpen = errors.New("circuit open")
+
+// RetryPolicy controls how a Client retries a failed request. Reads (/retrieve
+// and /show) are retried after any transport error, a 5xx answer or a config
+// lock. Other requests change the device, so they are only retried when it
+// cannot have acted on them: the connection was refused, a proxy in front of
+// the API answered 502 or 503, or the config lock was held.
+type RetryPolicy struct {
+	// Attempts is the most tries per request, including the first. Zero or
+	// one disables retries.
+	Attempts int
+	// Backoff is the delay before the first retry; it doubles for each
+	// further retry, up to MaxBackoff. Each delay is jittered down by up to
+	// half.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// BreakerPolicy controls a Client's circuit breaker.
+type BreakerPolicy struct {
+	// Threshold is how many requests in a row must fail to reach the
+	// device before the circuit opens. Zero disables the breaker.
+	Threshold int
+	// Cooldown is how long the circuit stays open before one trial request
+	// is let through. If it succeeds the circuit closes; otherwise it opens
+	// for another Cooldown.
+	Cooldown time.Duration
+}
+
+// CircuitState is the state of a Client's circuit breaker.
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// WithRetry sets the retry policy. By default requests are not retried.
+func (c *Client) WithRetry(p RetryPolicy) *Client {
+	c.retry = p
+	return c
+}
+
+// WithBreaker gives the client a circuit breaker, so that once the device is
+// clearly down requests fail fast with ErrCircuitOpen instead of each waiting
+// for a timeout.
+func (c *Client) WithBreaker(p BreakerPolicy) *Client {
+	c.breaker = nil
+	if p.Threshold > 0 {
+		c.breaker = &breaker{policy: p, now: time.Now}
+	}
+	return c
+}
+
+// Circuit returns the state of the client's circuit breaker; always
+// CircuitClosed without one.
+func (c *Client) Circuit() CircuitState {
+	if c.breaker == nil {
+		return CircuitClosed
+	}
+	return c.breaker.state()
+}
+
+// retryDelay returns how long to wait before retrying a request to endpoint
+// that failed with err on the given attempt (counting from 1), or false if it
+// should not be retried.
+func (c *Client) retryDelay(ctx context.Context, endpoint string, attempt int, err error) (time.Duration, bool) {
+	if err == nil || attempt >= c.retry.Attempts || ctx.Err() != nil || !retryable(endpoint, err) {
+		return 0, false
+	}
+	d := c.retry.Backoff << (attempt - 1)
+	if c.retry.MaxBackoff > 0 && (d > c.retry.MaxBackoff || d <= 0) {
+		d = c.retry.MaxBackoff
+	}
+	if d > 1 {
+		d -= rand.N(d / 2)
+	}
+	return d, true
+}
+
+func retryable(endpoint string, err error) bool {
+	if errors.Is(err, ErrConfigLocked) {
+		return true
+	}
+	if endpoint == "/retrieve" || endpoint == "/show" {
+		var te *TransportError
+		var e *Error
+		return errors.As(err, &te) || (errors.As(err, &e) && e.Status >= 500)
+	}
+	var te *TransportError
+	if !errors.As(err, &te) {
+		return false
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		te.Status == http.StatusBadGateway || te.Status == http.StatusServiceUnavailable
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// unreachable reports whether err means the device could not be reached or
+// could not serve the request, as opposed to refusing it.
+func unreachable(err error) bool {
+	var te *TransportError
+	var e *Error
+	return errors.As(err, &te) || (errors.As(err, &e) && e.Status >= 500)
+}
+
+type breaker struct {
+	policy BreakerPolicy
+	now    func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time // zero while closed
+	trial    bool      // a half-open trial request is in flight
+}
+
+func (b *breaker) state() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.openedAt.IsZero():
+		return CircuitClosed
+	case b.trial || b.now().Sub(b.openedAt) >= b.policy.Cooldown:
+		return CircuitHalfOpen
+	}
+	return CircuitOpen
+}
+
+// allow returns an error wrapping ErrCircuitOpen if a request may not be sent
+// now. Otherwise the caller must report the outcome with done, passing on
+// whether the request is the half-open trial.
+func (b *breaker) allow(endpoint string) (trial bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		return false, nil
+	}
+	retryAt := b.openedAt.Add(b.policy.Cooldown)
+	if b.trial || b.now().Before(retryAt) {
+		return false, fmt.Errorf("vyos %s: %w after %d failed requests, retrying after %s",
+			endpoint, ErrCircuitOpen, b.failures, retryAt.Format(time.RFC3339))
+	}
+	b.trial = true
+	return true, nil
+}
+
+// done records the outcome of a request allow let through. A cancelled
+// request says nothing about the device and is not counted.
+func (b *breaker) done(ctx context.Context, trial bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if trial {
+		b.trial = false
+	}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return
+	case err != nil && unreachable(err):
+		b.failures++
+		if trial || (b.openedAt.IsZero() && b.failures >= b.policy.Threshold) {
+			b.openedAt = b.now()
+		}
+	default:
+		b.failures = 0
+		b.openedAt = time.Time{}
+	}
+}
@@ -0,0 +1,142 @@
+package vyos
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const okBody = `{"success":true,"data":null,"error":null}`
+
+// sequenceServer answers the nth request with statuses[n] and bodies[n],
+// repeating the last pair, and counts the requests.
+func sequenceServer(t *testing.T, statuses []int, bodies []string) (*httptest.Server, *int32) {
+	t.Helper()
+	var n int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(atomic.AddInt32(&n, 1)) - 1
+		if i >= len(statuses) {
+			i = len(statuses) - 1
+		}
+		w.WriteHeader(statuses[i])
+		w.Write([]byte(bodies[i])) //nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &n
+}
+
+var fastRetry = RetryPolicy{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	locked := `{"success":false,"error":"Configuration is locked by another session","data":null}`
+	tests := []struct {
+		name     string
+		statuses []int
+		bodies   []string
+		write    bool
+		wantErr  bool
+		wantHits int32
+	}{
+		{"read retried after 5xx", []int{500, 500, 200}, []string{"oops", "oops", okBody}, false, false, 3},
+		{"read gives up", []int{502}, []string{"bad gateway"}, false, true, 3},
+		{"write not retried after 500", []int{500, 200}, []string{"oops", okBody}, true, true, 1},
+		{"write retried after 503", []int{503, 200}, []string{"unavailable", okBody}, true, false, 2},
+		{"write retried while locked", []int{400, 200}, []string{locked, okBody}, true, false, 2},
+		{"rejection not retried", []int{400}, []string{`{"success":false,"error":"Set failed","data":null}`}, true, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, hits := sequenceServer(t, tt.statuses, tt.bodies)
+			c := NewClient(nil).WithURL(srv.URL).WithRetry(fastRetry)
+			var err error
+			if tt.write {
+				_, err = c.Conf.SetPath(ctx, []string{"system", "host-name", "r1"})
+			} else {
+				_, err = c.Conf.GetPath(ctx, []string{"system"})
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(hits); got != tt.wantHits {
+				t.Errorf("device got %d requests, want %d", got, tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestRetry_ConnectionRefused(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	c := NewClient(nil).WithURL(srv.URL).WithRetry(fastRetry)
+	_, err := c.Conf.SetPath(context.Background(), []string{"system"})
+	if !retryable("/configure", err) {
+		t.Errorf("connection refused is not retryable for writes: %v", err)
+	}
+}
+
+func TestRetry_StopsOnCancel(t *testing.T) {
+	srv, hits := sequenceServer(t, []int{500}, []string{"oops"})
+	c := NewClient(nil).WithURL(srv.URL).WithRetry(RetryPolicy{Attempts: 5, Backoff: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.Conf.GetPath(ctx, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := atomic.LoadInt32(hits); got != 1 {
+		t.Errorf("device got %d requests, want 1", got)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	ctx := context.Background()
+	srv, hits := sequenceServer(t, []int{502, 502, 200}, []string{"down", "down", okBody})
+	c := NewClient(nil).WithURL(srv.URL).WithBreaker(BreakerPolicy{Threshold: 2, Cooldown: time.Minute})
+	now := time.Now()
+	c.breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Conf.GetPath(ctx, nil); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("request %d failed fast before the threshold", i)
+		}
+	}
+	if c.Circuit() != CircuitOpen {
+		t.Fatalf("circuit = %s after 2 failures, want open", c.Circuit())
+	}
+	_, err := c.Conf.GetPath(ctx, nil)
+	if !errors.Is(err, ErrCircuitOpen) || ErrorClass(err) != "circuit_open" {
+		t.Errorf("open circuit: err = %v (%s), want ErrCircuitOpen", err, ErrorClass(err))
+	}
+	if got := atomic.LoadInt32(hits); got != 2 {
+		t.Errorf("device got %d requests, want 2", got)
+	}
+
+	// After the cooldown one trial request goes through and closes it.
+	now = now.Add(time.Minute)
+	if c.Circuit() != CircuitHalfOpen {
+		t.Errorf("circuit = %s after cooldown, want half_open", c.Circuit())
+	}
+	if _, err := c.Conf.GetPath(ctx, nil); err != nil {
+		t.Errorf("trial request: %v", err)
+	}
+	if c.Circuit() != CircuitClosed {
+		t.Errorf("circuit = %s after a successful trial, want closed", c.Circuit())
+	}
+}
+
+func TestBreaker_RefusalsDoNotOpen(t *testing.T) {
+	srv, _ := sequenceServer(t, []int{401}, []string{"unauthorized"})
+	c := NewClient(nil).WithURL(srv.URL).WithBreaker(BreakerPolicy{Threshold: 1, Cooldown: time.Minute})
+	for i := 0; i < 3; i++ {
+		if _, err := c.Conf.GetPath(context.Background(), nil); !errors.Is(err, ErrAuth) {
+			t.Fatalf("err = %v, want ErrAuth", err)
+		}
+	}
+	if c.Circuit() != CircuitClosed {
+		t.Errorf("circuit = %s, want closed", c.Circuit())
+	}
+}
@@ -0,0 +1,34 @@
+package vyos
+
+import (
+	"context"
+	"fmt"
+)
+
+// Show exposes operational-mode commands (the /show endpoint).
+type Show struct {
+	client *Client
+}
+
+// Run executes the operational-mode command "show <path...>", e.g.
+// []string{"interfaces"} or []string{"ip", "route"}. On success the command's
+// text output is in Data; see Text and the Parse* functions.
+func (s *Show) Run(ctx context.Context, path []string) (*Response, error) {
+	return s.client.post(ctx, "/show", map[string]interface{}{
+		"op":   "show",
+		"path": nonNil(path),
+	})
+}
+
+// Text returns the response data as text, as produced by /show. It returns
+// "" when there is no data.
+func (r *Response) Text() string {
+	switch d := r.Data.(type) {
+	case nil:
+		return ""
+	case string:
+		return d
+	default:
+		return fmt.Sprint(d)
+	}
+}
@@ -0,0 +1,157 @@
+package vyos
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TLSConfig describes how a Client verifies a device's certificate and
+// authenticates itself. The zero value verifies the device against the
+// system root CAs.
+type TLSConfig struct {
+	// CAFile is a PEM bundle of CAs trusted to sign the device certificate,
+	// used instead of the system roots.
+	CAFile string
+	// Fingerprint pins the SHA-256 fingerprint of the device's leaf
+	// certificate, as hex with or without colons. Without CAFile the pin
+	// replaces chain verification, which suits VyOS's self-signed default
+	// certificate; with CAFile both must pass.
+	Fingerprint string
+	// CertFile and KeyFile are a PEM client certificate and key presented
+	// to the device. Both or neither must be set.
+	CertFile string
+	KeyFile  string
+	// CA, Cert and Key are inline PEM alternatives to CAFile, CertFile and
+	// KeyFile. The CA, and the certificate and key pair, are each given
+	// either as files or inline.
+	CA   string
+	Cert string
+	Key  string
+	// ServerName overrides the name checked against the certificate, for
+	// devices addressed by IP whose certificate carries a hostname.
+	ServerName string
+	// Insecure disables all verification. It must be set explicitly and
+	// cannot be combined with CAFile or Fingerprint.
+	Insecure bool
+}
+
+// Mode summarises the verification in effect: "insecure", "pinned", or
+// "verify".
+func (t TLSConfig) Mode() string {
+	switch {
+	case t.Insecure:
+		return "insecure"
+	case t.Fingerprint != "":
+		return "pinned"
+	default:
+		return "verify"
+	}
+}
+
+// Build returns the crypto/tls configuration for t. It reads the CA and
+// client certificate files, so errors here are configuration errors.
+func (t TLSConfig) Build() (*tls.Config, error) {
+	if t.Insecure && (t.CAFile != "" || t.CA != "" || t.Fingerprint != "") {
+		return nil, errors.New("tls: insecure cannot be combined with a CA or fingerprint")
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") || (t.Cert == "") != (t.Key == "") {
+		return nil, errors.New("tls: client certificate and key must be set together")
+	}
+	if (t.CAFile != "" && t.CA != "") || (t.CertFile != "" && t.Cert != "") {
+		return nil, errors.New("tls: a CA or client certificate is given both as a file and inline")
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: t.ServerName,
+	}
+	if t.Insecure {
+		cfg.InsecureSkipVerify = true
+	}
+
+	caPEM, caName := []byte(t.CA), "inline CA"
+	if t.CAFile != "" {
+		var err error
+		if caPEM, err = os.ReadFile(t.CAFile); err != nil {
+			return nil, fmt.Errorf("tls: read CA file: %w", err)
+		}
+		caName = t.CAFile
+	}
+	if len(caPEM) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("tls: no certificates found in %s", caName)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.Cert != "" {
+		var cert tls.Certificate
+		var err error
+		if t.CertFile != "" {
+			cert, err = tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		} else {
+			cert, err = tls.X509KeyPair([]byte(t.Cert), []byte(t.Key))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tls: load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if t.Fingerprint != "" {
+		pin, err := parseFingerprint(t.Fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		// Without a CA the pin is the only check, so the default chain
+		// verification (which a self-signed certificate would fail) is
+		// replaced by VerifyConnection.
+		if t.CAFile == "" && t.CA == "" {
+			cfg.InsecureSkipVerify = true
+		}
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("tls: device presented no certificate")
+			}
+			sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+			if sum != pin {
+				return fmt.Errorf("tls: certificate fingerprint %s does not match pinned fingerprint", hex.EncodeToString(sum[:]))
+			}
+			return nil
+		}
+	}
+	return cfg, nil
+}
+
+// parseFingerprint decodes a SHA-256 fingerprint written as hex, optionally
+// separated by colons (as printed by openssl x509 -fingerprint).
+func parseFingerprint(s string) ([32]byte, error) {
+	var pin [32]byte
+	b, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(s), ":", ""))
+	if err != nil || len(b) != len(pin) {
+		return pin, fmt.Errorf("tls: fingerprint must be a hex SHA-256 digest, got %q", s)
+	}
+	copy(pin[:], b)
+	return pin, nil
+}
+
+// WithTLS configures the HTTP client to use t. It replaces any transport set
+// by NewClient or Insecure.
+func (c *Client) WithTLS(t TLSConfig) (*Client, error) {
+	cfg, err := t.Build()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	c.http = &http.Client{Transport: transport, Timeout: c.http.Timeout}
+	return c, nil
+}
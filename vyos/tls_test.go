@@ -0,0 +1,202 @@
+package vyos
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTLSDevice starts a TLS server that answers every request with success.
+func newTLSDevice(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":true,"data":null,"error":null}`)) //nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func get(t *testing.T, srv *httptest.Server, cfg TLSConfig) error {
+	t.Helper()
+	c, err := NewClient(nil).WithURL(srv.URL).WithTLS(cfg)
+	if err != nil {
+		t.Fatalf("WithTLS: %v", err)
+	}
+	_, err = c.Conf.GetPath(context.Background(), nil)
+	return err
+}
+
+func TestTLS_DefaultVerifiesCertificate(t *testing.T) {
+	srv := newTLSDevice(t)
+	if err := get(t, srv, TLSConfig{}); err == nil {
+		t.Fatal("self-signed device accepted without CA, pin or insecure")
+	}
+}
+
+func TestTLS_Pinned(t *testing.T) {
+	srv := newTLSDevice(t)
+	pin := fingerprint(srv.Certificate())
+	if err := get(t, srv, TLSConfig{Fingerprint: pin}); err != nil {
+		t.Errorf("matching pin: %v", err)
+	}
+
+	wrong := make([]byte, 32)
+	if err := get(t, srv, TLSConfig{Fingerprint: hex.EncodeToString(wrong)}); err == nil {
+		t.Error("mismatched pin accepted")
+	}
+}
+
+func TestTLS_PinWithColons(t *testing.T) {
+	srv := newTLSDevice(t)
+	pin := fingerprint(srv.Certificate())
+	var colons string
+	for i := 0; i < len(pin); i += 2 {
+		if i > 0 {
+			colons += ":"
+		}
+		colons += pin[i : i+2]
+	}
+	if err := get(t, srv, TLSConfig{Fingerprint: colons}); err != nil {
+		t.Errorf("colon-separated pin: %v", err)
+	}
+}
+
+func TestTLS_CAFile(t *testing.T) {
+	srv := newTLSDevice(t)
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	writePEM(t, ca, "CERTIFICATE", srv.Certificate().Raw)
+
+	if err := get(t, srv, TLSConfig{CAFile: ca}); err != nil {
+		t.Errorf("trusted CA: %v", err)
+	}
+	if err := get(t, srv, TLSConfig{CAFile: ca, ServerName: "wrong.invalid"}); err == nil {
+		t.Error("server name override not checked")
+	}
+}
+
+func TestTLS_Insecure(t *testing.T) {
+	srv := newTLSDevice(t)
+	if err := get(t, srv, TLSConfig{Insecure: true}); err != nil {
+		t.Errorf("insecure: %v", err)
+	}
+}
+
+func TestTLS_ClientCertificate(t *testing.T) {
+	var gotClientCert bool
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotClientCert = r.TLS != nil && len(r.TLS.PeerCertificates) > 0
+		w.Write([]byte(`{"success":true,"data":null,"error":null}`)) //nolint:errcheck
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	writeClientCert(t, certFile, keyFile)
+
+	cfg := TLSConfig{Fingerprint: fingerprint(srv.Certificate()), CertFile: certFile, KeyFile: keyFile}
+	if err := get(t, srv, cfg); err != nil {
+		t.Fatalf("with client cert: %v", err)
+	}
+	if !gotClientCert {
+		t.Error("device did not receive a client certificate")
+	}
+}
+
+func TestTLS_InlinePEM(t *testing.T) {
+	var gotClientCert bool
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotClientCert = r.TLS != nil && len(r.TLS.PeerCertificates) > 0
+		w.Write([]byte(`{"success":true,"data":null,"error":null}`)) //nolint:errcheck
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	writeClientCert(t, certFile, keyFile)
+	cert, _ := os.ReadFile(certFile)
+	key, _ := os.ReadFile(keyFile)
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	if err := get(t, srv, TLSConfig{CA: string(ca), Cert: string(cert), Key: string(key)}); err != nil {
+		t.Fatalf("inline CA and client cert: %v", err)
+	}
+	if !gotClientCert {
+		t.Error("device did not receive a client certificate")
+	}
+}
+
+func TestTLS_InvalidConfig(t *testing.T) {
+	tests := map[string]TLSConfig{
+		"insecure with pin":    {Insecure: true, Fingerprint: "00"},
+		"cert without key":     {CertFile: "client.pem"},
+		"short fingerprint":    {Fingerprint: "abcd"},
+		"non-hex fingerprint":  {Fingerprint: "zz"},
+		"missing CA file":      {CAFile: filepath.Join(t.TempDir(), "nope.pem")},
+		"insecure with CA set": {Insecure: true, CAFile: "ca.pem"},
+		"insecure with inline": {Insecure: true, CA: "x"},
+		"CA file and inline":   {CAFile: "ca.pem", CA: "x"},
+		"inline cert no key":   {Cert: "x"},
+		"cert file and inline": {CertFile: "c.pem", KeyFile: "k.pem", Cert: "x", Key: "y"},
+		"bad inline CA":        {CA: "not pem"},
+	}
+	for name, cfg := range tests {
+		if _, err := cfg.Build(); err == nil {
+			t.Errorf("%s: Build succeeded, want error", name)
+		}
+	}
+}
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeClientCert(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "vyos-api"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+}